@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	rt "github.com/finwarman/raytracer/raytracer"
+)
+
+// edits are the changes made with the control panel (toggled with C), applied
+// to each frame as it's rendered
+var edits = struct {
+	sync.Mutex
+	spheres  []*rt.Sphere // the demo's spheres and lights, as edited
+	lights   []*rt.Light
+	glass    rt.Sphere // the glass sphere, with its Centre the offset from where the timeline puts it
+	floor    rt.Box
+	maxDepth int
+	scale    float64 // pixels per pixel in image
+}{
+	maxDepth: rt.MaxRayRecursionDepth,
+	scale:    3.0,
+}
+
+// shown is the last frame's scene and size, for picking objects in
+var shown struct {
+	sync.Mutex
+	scene *rt.Scene
+	rect  image.Rectangle
+}
+
+// frameRect returns the size to render a width x height window at, at the
+// edited resolution scale
+func frameRect(width, height int) image.Rectangle {
+	edits.Lock()
+	defer edits.Unlock()
+	return image.Rect(0, 0, int(float64(width)/edits.scale), int(float64(height)/edits.scale))
+}
+
+// editDemo starts the edits from the demo scene
+func editDemo(demo *rt.Scene) {
+	edits.Lock()
+	defer edits.Unlock()
+	edits.spheres, edits.lights = demo.Spheres, demo.Lights
+	if glass := demoGlass(demo); glass != nil {
+		edits.glass = rt.Sphere{Radius: glass.Radius, Material: glass.Material}
+	}
+	if floor, ok := demo.Shapes[1].(*rt.Box); ok {
+		edits.floor = *floor
+	}
+}
+
+// demoGlass returns the demo's (animated) glass sphere, Shapes[0]
+func demoGlass(scene *rt.Scene) *rt.Sphere {
+	if moving, ok := scene.Shapes[0].(*rt.Moving); ok {
+		if glass, ok := moving.Shape.(*rt.Sphere); ok {
+			return glass
+		}
+	}
+	return nil
+}
+
+// frameScene returns the demo scene at frame, with the edits (copied, so they
+// can carry on being edited while it renders)
+func frameScene(envmap *image.NRGBA, timeline *rt.Timeline, frame float64) *rt.Scene {
+	scene := rt.DemoScene(envmap, camera)
+
+	edits.Lock()
+	scene.Spheres = make([]*rt.Sphere, len(edits.spheres))
+	for i, s := range edits.spheres {
+		sphere := *s
+		scene.Spheres[i] = &sphere
+	}
+	scene.Lights = make([]*rt.Light, len(edits.lights))
+	for i, l := range edits.lights {
+		light := *l
+		scene.Lights[i] = &light
+	}
+	glassEdits := edits.glass
+	floor := edits.floor
+	scene.Shapes[1] = &floor
+	scene.MaxDepth = edits.maxDepth
+	edits.Unlock()
+
+	if err := timeline.Apply(scene, camera, frame); err != nil {
+		fmt.Println("Cannot animate scene:", err)
+	}
+	// (after the timeline, which moves the glass sphere)
+	if glass := demoGlass(scene); glass != nil {
+		glass.Centre = glass.Centre.Add(glassEdits.Centre)
+		glass.Radius, glass.Material = glassEdits.Radius, glassEdits.Material
+	}
+	return scene
+}
+
+// newControlPanel returns the control panel, and a function that selects an
+// object in it (numbered as Hit.Object, 0 for nothing)
+func newControlPanel() (fyne.CanvasObject, func(object int)) {
+	editor := container.NewVBox()
+
+	// listed in the scene's object order (spheres, then the glass sphere and
+	// the floor, as the demo has no planes), so Hit.Object indexes them
+	var names []string
+	controls := make(map[string]func() []fyne.CanvasObject)
+	for i, s := range edits.spheres {
+		s := s
+		name := fmt.Sprintf("Sphere %d", i+1)
+		names = append(names, name)
+		controls[name] = func() []fyne.CanvasObject { return sphereControls(s) }
+	}
+	names = append(names, "Glass sphere", "Floor")
+	controls["Glass sphere"] = glassControls
+	controls["Floor"] = floorControls
+	objectCount := len(names)
+	for i, l := range edits.lights {
+		l := l
+		name := fmt.Sprintf("Light %d", i+1)
+		names = append(names, name)
+		controls[name] = func() []fyne.CanvasObject { return lightControls(l) }
+	}
+	status := widget.NewLabel("")
+	objects := widget.NewSelect(names, func(name string) {
+		status.SetText("")
+		editor.Objects = controls[name]()
+		editor.Refresh()
+	})
+	objects.PlaceHolder = "(or click on an object)"
+
+	panel := container.NewVBox(
+		widget.NewLabelWithStyle("Camera", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		slider("FOV", 10, 120, 1, camera.FOV*180/math.Pi, "%.0f°", func(v float64) {
+			camera.FOV = v * math.Pi / 180
+		}),
+		slider("Recursion depth", 1, 10, 1, float64(edits.maxDepth), "%.0f", func(v float64) {
+			edits.Lock()
+			edits.maxDepth = int(v)
+			edits.Unlock()
+		}),
+		slider("Resolution scale", 1, 8, 0.5, edits.scale, "%.1f pixels per pixel", func(v float64) {
+			edits.Lock()
+			edits.scale = v
+			edits.Unlock()
+		}),
+		widget.NewSeparator(),
+		widget.NewLabelWithStyle("Objects", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		objects,
+		status,
+		editor,
+	)
+	scroll := container.NewVScroll(panel)
+	scroll.SetMinSize(fyne.NewSize(260, 0))
+
+	pick := func(object int) {
+		if object < 1 || object > objectCount {
+			objects.ClearSelected()
+			editor.Objects = nil
+			editor.Refresh()
+			status.SetText("Nothing to edit there")
+			return
+		}
+		objects.SetSelected(names[object-1])
+	}
+	return scroll, pick
+}
+
+func sphereControls(s *rt.Sphere) []fyne.CanvasObject {
+	return []fyne.CanvasObject{
+		vectorSlider("X", -20, 20, &s.Centre.X),
+		vectorSlider("Y", -20, 20, &s.Centre.Y),
+		vectorSlider("Z", -40, 0, &s.Centre.Z),
+		vectorSlider("Radius", 0.1, 10, &s.Radius),
+		materialSelect(&s.Material),
+	}
+}
+
+// glassControls edit the glass sphere, whose position is an offset from
+// where the animation puts it
+func glassControls() []fyne.CanvasObject {
+	return []fyne.CanvasObject{
+		widget.NewLabel("(moved relative to its animation)"),
+		vectorSlider("X offset", -10, 10, &edits.glass.Centre.X),
+		vectorSlider("Y offset", -10, 10, &edits.glass.Centre.Y),
+		vectorSlider("Z offset", -10, 10, &edits.glass.Centre.Z),
+		vectorSlider("Radius", 0.1, 10, &edits.glass.Radius),
+		materialSelect(&edits.glass.Material),
+	}
+}
+
+func floorControls() []fyne.CanvasObject {
+	floor := &edits.floor
+	return []fyne.CanvasObject{
+		slider("Height", -10, 5, 0.1, floor.Max.Y, "%.1f", func(v float64) {
+			edits.Lock()
+			thickness := floor.Max.Y - floor.Min.Y
+			floor.Max.Y, floor.Min.Y = v, v-thickness
+			edits.Unlock()
+		}),
+		materialSelect(&floor.Material),
+	}
+}
+
+// materialSelect switches *m between the material presets (under the edits lock)
+func materialSelect(m *rt.Material) fyne.CanvasObject {
+	var presets []string
+	for name := range rt.MaterialPresets {
+		presets = append(presets, name)
+	}
+	sort.Strings(presets)
+	material := widget.NewSelect(presets, func(name string) {
+		edits.Lock()
+		*m = rt.MaterialPresets[name]
+		edits.Unlock()
+	})
+	material.PlaceHolder = "(material preset)"
+	return material
+}
+
+func lightControls(l *rt.Light) []fyne.CanvasObject {
+	return []fyne.CanvasObject{
+		vectorSlider("X", -60, 60, &l.Position.X),
+		vectorSlider("Y", -60, 60, &l.Position.Y),
+		vectorSlider("Z", -60, 60, &l.Position.Z),
+		vectorSlider("Intensity", 0, 5, &l.Intensity),
+	}
+}
+
+// vectorSlider is a slider editing *v (under the edits lock)
+func vectorSlider(name string, min, max float64, v *float64) fyne.CanvasObject {
+	return slider(name, min, max, 0.1, *v, "%.1f", func(value float64) {
+		edits.Lock()
+		*v = value
+		edits.Unlock()
+	})
+}
+
+// slider returns a labelled slider from min to max, calling set as it moves
+func slider(name string, min, max, step, value float64, format string, set func(float64)) fyne.CanvasObject {
+	label := widget.NewLabel("")
+	show := func(v float64) {
+		label.SetText(name + ": " + fmt.Sprintf(format, v))
+	}
+	s := widget.NewSlider(min, max)
+	s.Step = step
+	s.Value = value
+	s.OnChanged = func(v float64) {
+		show(v)
+		set(v)
+	}
+	show(value)
+	return container.NewVBox(label, s)
+}
+
+// tappableImage is the rendered image, reporting where it's clicked
+type tappableImage struct {
+	widget.BaseWidget
+	image    *canvas.Image
+	onTapped func(x, y float64) // where, as a fraction of the image's width and height
+}
+
+func newTappableImage(img *canvas.Image, onTapped func(x, y float64)) *tappableImage {
+	t := &tappableImage{image: img, onTapped: onTapped}
+	t.ExtendBaseWidget(t)
+	return t
+}
+
+func (t *tappableImage) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(t.image)
+}
+
+func (t *tappableImage) Tapped(event *fyne.PointEvent) {
+	if t.image.Image == nil {
+		return
+	}
+	bounds := t.image.Image.Bounds()
+	if bounds.Empty() {
+		return
+	}
+
+	// the image is drawn as large as fits, centred (ImageFillContain)
+	size := t.Size()
+	aspect := float32(bounds.Dx()) / float32(bounds.Dy())
+	w := size.Width
+	if size.Height*aspect < w {
+		w = size.Height * aspect
+	}
+	h := w / aspect
+	x := (event.Position.X - (size.Width-w)/2) / w
+	y := (event.Position.Y - (size.Height-h)/2) / h
+	if x < 0 || x >= 1 || y < 0 || y >= 1 {
+		return
+	}
+	t.onTapped(float64(x), float64(y))
+}
@@ -0,0 +1,413 @@
+// render draws frames of the demo animation to numbered pngs, optionally
+// muxing them into an animated gif or apng
+//
+//	go run ./cmd/render -start 0 -end 90 -out frames -gif anim.gif
+//
+// -cpuprofile, -memprofile and -trace write profiles of the whole run (for
+// go tool pprof and go tool trace), and -stats reports each frame's work
+//
+// -scene renders a scene file rather than the demo, and can be split across
+// worker processes (sharing the scene's files), each started with -worker:
+//
+//	go run ./cmd/render -worker :7000 &
+//	go run ./cmd/render -worker :7001 &
+//	go run ./cmd/render -scene files/scene.json -workers :7000,:7001
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strings"
+	"time"
+
+	rt "github.com/finwarman/raytracer/raytracer"
+)
+
+func main() {
+	start := flag.Int("start", 0, "first frame to render")
+	end := flag.Int("end", -1, "last frame to render (default: the end of the timeline)")
+	width := flag.Int("width", 341, "image width")
+	height := flag.Int("height", 256, "image height")
+	samples := flag.Int("samples", 1, "samples per pixel (the minimum, with -max-samples)")
+	maxSamples := flag.Int("max-samples", 0, "sample noisy pixels adaptively, up to this many samples")
+	noise := flag.Float64("noise", 0.01, "with -max-samples, stop sampling a pixel once its noise (standard error, 0 to 1) is below this")
+	seed := flag.Uint64("seed", 0, "offset each pixel's samples by a random amount from this seed (0 for the same pattern everywhere)")
+	shutter := flag.Float64("shutter", 0, "fraction of each frame the shutter is open, for motion blur")
+	out := flag.String("out", "frames", "directory for the numbered pngs")
+	envmapPath := flag.String("envmap", "files/envmap-coast.jpg", "skybox image")
+	gifPath := flag.String("gif", "", "also write the frames to this animated gif")
+	apngPath := flag.String("apng", "", "also write the frames to this animated png")
+	fps := flag.Float64("fps", 30, "frame rate of the gif/apng")
+	fov := flag.Float64("fov", 60, "vertical field of view (degrees)")
+	projectionName := flag.String("projection", "perspective", "perspective, orthographic, equidistant, equisolid or equirectangular")
+	stereoName := flag.String("stereo", "", "render a stereo pair: sbs (side by side) or tb (top/bottom)")
+	ipd := flag.Float64("ipd", rt.DefaultInterpupillaryDistance, "distance between the eyes of a stereo pair")
+	aovNames := flag.String("aov", "", "comma separated AOVs to write alongside each frame (or all)")
+	writeEXR := flag.Bool("exr", false, "also write each frame (and its AOVs, as layers) to an OpenEXR file")
+	fullFloat := flag.Bool("float", false, "write 32 bit floats to the EXR files, rather than halves")
+	writePFM := flag.Bool("pfm", false, "also write each frame (and its AOVs) as portable float maps")
+	denoise := flag.Float64("denoise", 0, "denoise each frame with this strength (0 to 1, 0 for off)")
+	postSpec := flag.String("post", "", "post-processing effects for the pngs/gif/apng, in order, e.g. \"bloom:threshold=1; vignette:strength=0.4; lut:file=grade.cube\"")
+	cpuProfile := flag.String("cpuprofile", "", "write a cpu profile to this file")
+	memProfile := flag.String("memprofile", "", "write a heap profile to this file, after rendering")
+	tracePath := flag.String("trace", "", "write an execution trace to this file")
+	showStats := flag.Bool("stats", false, "report the rays cast, intersection tests and tile times for each frame")
+	scenePath := flag.String("scene", "", "render this scene file (json), rather than the demo, at its own size if it has one")
+	workerAddr := flag.String("worker", "", "serve tiles to a coordinator (run with -workers) on this address, rather than rendering")
+	workers := flag.String("workers", "", "with -scene, render across these comma separated worker addresses (with the scene file's own camera settings)")
+	tileSize := flag.Int("tile", 32, "with -workers, size of the tiles handed to each worker")
+	flag.Parse()
+
+	if *workerAddr != "" {
+		l, err := net.Listen("tcp", *workerAddr)
+		if err != nil {
+			exit(err)
+		}
+		fmt.Printf("worker listening on %v\n", l.Addr())
+		exit(rt.ServeWorker(l))
+	}
+
+	stop, err := startProfiling(*cpuProfile, *tracePath)
+	if err != nil {
+		exit(err)
+	}
+	stopProfiling = stop
+
+	post, err := rt.ParsePostStack(*postSpec)
+	if err != nil {
+		exit(err)
+	}
+
+	aovs, err := parseAOVs(*aovNames)
+	if err != nil {
+		exit(err)
+	}
+
+	projection, ok := rt.ParseProjection(*projectionName)
+	if !ok {
+		exit(fmt.Errorf("unknown projection %q", *projectionName))
+	}
+	stereo := rt.Mono
+	switch *stereoName {
+	case "":
+	case "sbs":
+		stereo = rt.SideBySide
+	case "tb":
+		stereo = rt.TopBottom
+	default:
+		exit(fmt.Errorf("unknown stereo layout %q", *stereoName))
+	}
+
+	var coordinator *rt.Coordinator
+	var sceneData []byte
+	var sceneFile *rt.SceneFile
+	sceneDir := ""
+	timeline := rt.DemoTimeline()
+	if *scenePath != "" {
+		if sceneData, err = os.ReadFile(*scenePath); err != nil {
+			exit(err)
+		}
+		if sceneFile, err = rt.ParseSceneFile(sceneData); err != nil {
+			exit(err)
+		}
+		if sceneDir, err = filepath.Abs(filepath.Dir(*scenePath)); err != nil {
+			exit(err)
+		}
+		*envmapPath = sceneFile.EnvMapPath(sceneDir)
+		if sceneFile.Width > 0 && sceneFile.Height > 0 {
+			*width, *height = sceneFile.Width, sceneFile.Height
+		}
+		timeline = &rt.Timeline{} // (the file's own is applied by Build)
+		if *end < 0 {
+			*end = int(math.Ceil(sceneFile.End()))
+		}
+	}
+	if *workers != "" {
+		if sceneFile == nil {
+			exit(fmt.Errorf("-workers needs a -scene"))
+		}
+		if len(aovs) > 0 || *writeEXR || *writePFM || *denoise > 0 || len(post) > 0 || *showStats {
+			exit(fmt.Errorf("-workers only renders colour, without -aov, -exr, -pfm, -denoise, -post or -stats"))
+		}
+		// the workers render with the scene file's camera, as it is
+		var cameraFlags []string
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "samples", "max-samples", "noise", "seed", "shutter", "fov", "projection", "stereo", "ipd":
+				cameraFlags = append(cameraFlags, "-"+f.Name)
+			}
+		})
+		if len(cameraFlags) > 0 {
+			exit(fmt.Errorf("-workers uses the scene file's camera, so can't take %s", strings.Join(cameraFlags, ", ")))
+		}
+		coordinator = &rt.Coordinator{
+			Workers:  strings.Split(*workers, ","),
+			TileSize: *tileSize,
+			Logf: func(format string, args ...interface{}) {
+				fmt.Fprintf(os.Stderr, "render: "+format+"\n", args...)
+			},
+		}
+	}
+
+	envmap, err := rt.LoadImage(*envmapPath)
+	if err != nil {
+		exit(err)
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		exit(err)
+	}
+
+	if *end < 0 {
+		*end = int(math.Ceil(timeline.End()))
+	}
+
+	var frames []*image.NRGBA
+	for frame := *start; frame <= *end; frame++ {
+		began := time.Now()
+
+		camera := &rt.Camera{
+			FOV:                    *fov * math.Pi / 180,
+			FocalDistance:          16.0,
+			Projection:             projection,
+			Stereo:                 stereo,
+			InterpupillaryDistance: *ipd,
+			Samples:                *samples,
+			MaxSamples:             *maxSamples,
+			NoiseThreshold:         *noise,
+			ShutterClose:           *shutter,
+			Seed:                   *seed,
+			Frame:                  frame,
+		}
+		scene := rt.DemoScene(envmap, camera)
+		if sceneFile != nil {
+			// the file's camera, with the stereo and sampling options from the flags
+			fileScene, fileCamera, err := sceneFile.Build(envmap, float64(frame))
+			if err != nil {
+				exit(err)
+			}
+			fileCamera.Stereo, fileCamera.InterpupillaryDistance = camera.Stereo, camera.InterpupillaryDistance
+			fileCamera.MaxSamples, fileCamera.NoiseThreshold, fileCamera.Seed = camera.MaxSamples, camera.NoiseThreshold, camera.Seed
+			if fileCamera.Samples == 0 {
+				fileCamera.Samples = camera.Samples
+			}
+			scene, camera = fileScene, fileCamera
+		}
+		if err := timeline.Apply(scene, camera, float64(frame)); err != nil {
+			exit(err)
+		}
+		if *showStats {
+			scene.Stats = &rt.RenderStats{}
+		}
+
+		if coordinator != nil {
+			img, err := coordinator.RenderFrame(sceneData, sceneDir, float64(frame), *width, *height)
+			if err != nil {
+				exit(err)
+			}
+			path := filepath.Join(*out, fmt.Sprintf("frame%04d.png", frame))
+			if err := savePNG(path, img); err != nil {
+				exit(err)
+			}
+			fmt.Printf("%s (%v, %d workers)\n", path, time.Since(began).Round(time.Millisecond), len(coordinator.Workers))
+			if *gifPath != "" || *apngPath != "" {
+				frames = append(frames, img)
+			}
+			continue
+		}
+
+		img := image.NewNRGBA(image.Rect(0, 0, *width, *height))
+		var passes *rt.Passes
+		if len(aovs) > 0 || *writeEXR || *writePFM || *denoise > 0 || len(post) > 0 {
+			passes = rt.NewPasses(*width, *height, aovs...)
+		}
+		// the denoiser's guides (only written out if asked for)
+		var guides []rt.AOV
+		if *denoise > 0 {
+			for _, aov := range rt.DenoiseAOVs {
+				if passes.AOVs[aov] == nil {
+					passes.AOVs[aov] = rt.NewFloatImage(*width, *height)
+					guides = append(guides, aov)
+				}
+			}
+		}
+		rt.RenderPasses(img, *width, *height, camera, scene, passes)
+		if *denoise > 0 {
+			passes.Colour = rt.Denoise(passes, *denoise)
+			img = passes.Colour.NRGBA()
+			for _, aov := range guides {
+				delete(passes.AOVs, aov)
+			}
+		}
+		// (the float outputs are left ungraded, for compositing)
+		if len(post) > 0 {
+			img = post.Apply(passes.Colour).NRGBA()
+		}
+
+		path := filepath.Join(*out, fmt.Sprintf("frame%04d.png", frame))
+		if err := savePNG(path, img); err != nil {
+			exit(err)
+		}
+		for _, aov := range aovs {
+			aovPath := filepath.Join(*out, fmt.Sprintf("frame%04d.%s.png", frame, aov))
+			if err := savePNG(aovPath, rt.AOVPreview(aov, passes.AOVs[aov])); err != nil {
+				exit(err)
+			}
+		}
+		if *writeEXR {
+			exrPath := filepath.Join(*out, fmt.Sprintf("frame%04d.exr", frame))
+			err := writeFile(exrPath, func(f *os.File) error {
+				return rt.EncodeEXR(f, rt.PassesEXRLayers(passes), *fullFloat)
+			})
+			if err != nil {
+				exit(err)
+			}
+		}
+		if *writePFM {
+			if err := savePFMs(*out, frame, passes); err != nil {
+				exit(err)
+			}
+		}
+		fmt.Printf("%s (%v)\n", path, time.Since(began).Round(time.Millisecond))
+		if scene.Stats != nil {
+			fmt.Printf("  %s\n", strings.ReplaceAll(scene.Stats.String(), "\n", "\n  "))
+		}
+
+		if *gifPath != "" || *apngPath != "" {
+			frames = append(frames, img)
+		}
+	}
+
+	delay := time.Duration(float64(time.Second) / *fps)
+	if *gifPath != "" {
+		if err := writeFile(*gifPath, func(f *os.File) error { return rt.EncodeGIF(f, frames, delay) }); err != nil {
+			exit(err)
+		}
+	}
+	if *apngPath != "" {
+		if err := writeFile(*apngPath, func(f *os.File) error { return rt.EncodeAPNG(f, frames, delay) }); err != nil {
+			exit(err)
+		}
+	}
+
+	stopProfiling()
+	if *memProfile != "" {
+		runtime.GC() // so the profile is of what's still in use
+		if err := writeFile(*memProfile, func(f *os.File) error { return pprof.WriteHeapProfile(f) }); err != nil {
+			exit(err)
+		}
+	}
+}
+
+// startProfiling starts cpu profiling and/or tracing to the given files (if
+// not ""), returning a function that stops them and closes the files
+func startProfiling(cpuPath, tracePath string) (func(), error) {
+	var files []*os.File
+	stop := func() {
+		pprof.StopCPUProfile()
+		trace.Stop()
+		for _, f := range files {
+			f.Close()
+		}
+	}
+
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+		if err := pprof.StartCPUProfile(f); err != nil {
+			stop()
+			return nil, err
+		}
+	}
+	if tracePath != "" {
+		f, err := os.Create(tracePath)
+		if err != nil {
+			stop()
+			return nil, err
+		}
+		files = append(files, f)
+		if err := trace.Start(f); err != nil {
+			stop()
+			return nil, err
+		}
+	}
+	return stop, nil
+}
+
+// parseAOVs parses a comma separated list of AOV names
+func parseAOVs(names string) ([]rt.AOV, error) {
+	if names == "" {
+		return nil, nil
+	}
+	if names == "all" {
+		return rt.AllAOVs(), nil
+	}
+	var aovs []rt.AOV
+	for _, name := range strings.Split(names, ",") {
+		aov, ok := rt.ParseAOV(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown AOV %q", name)
+		}
+		aovs = append(aovs, aov)
+	}
+	return aovs, nil
+}
+
+// savePFMs writes the colour and each AOV of a frame as portable float maps
+// (single channel AOVs in greyscale)
+func savePFMs(dir string, frame int, passes *rt.Passes) error {
+	path := filepath.Join(dir, fmt.Sprintf("frame%04d.pfm", frame))
+	if err := writeFile(path, func(f *os.File) error { return rt.EncodePFM(f, passes.Colour, false) }); err != nil {
+		return err
+	}
+	for aov, img := range passes.AOVs {
+		grey := false
+		switch aov {
+		case rt.AOVDepth, rt.AOVObjectID, rt.AOVMaterialID, rt.AOVShadow, rt.AOVSamples:
+			grey = true
+		}
+		path := filepath.Join(dir, fmt.Sprintf("frame%04d.%s.pfm", frame, aov))
+		if err := writeFile(path, func(f *os.File) error { return rt.EncodePFM(f, img, grey) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stopProfiling stops any profiling, flushing the profiles (on exit too, so
+// a failed run can still be looked into)
+var stopProfiling = func() {}
+
+func exit(err error) {
+	stopProfiling()
+	fmt.Fprintln(os.Stderr, "render:", err)
+	os.Exit(1)
+}
+
+func savePNG(path string, img image.Image) error {
+	return writeFile(path, func(f *os.File) error { return png.Encode(f, img) })
+}
+
+// writeFile creates path and fills it with write
+func writeFile(path string, write func(f *os.File) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
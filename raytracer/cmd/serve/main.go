@@ -0,0 +1,43 @@
+// serve renders scene files POSTed to it over http, streaming each render's
+// progress as it converges (see raytracer.RenderServer for the api)
+//
+//	go run ./cmd/serve -addr :8080 -dir files &
+//	curl -X POST --data-binary @files/scene.json 'localhost:8080/jobs?samples=64'
+//
+// and then open localhost:8080/jobs/{id}/stream in a browser to watch it
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	rt "github.com/finwarman/raytracer/raytracer"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to serve on")
+	dir := flag.String("dir", "files", "directory scene files' envmaps are loaded from")
+	jobs := flag.Int("jobs", 1, "jobs rendered at once")
+	queue := flag.Int("queue", 16, "jobs waiting their turn before more are turned away")
+	maxSamples := flag.Int("max-samples", 1024, "most samples per pixel a job can ask for")
+	maxDepth := flag.Int("max-depth", 16, "deepest ray recursion a scene file can ask for")
+	maxFinished := flag.Int("max-finished", 16, "finished jobs kept (with their images), before the oldest are forgotten")
+	flag.Parse()
+
+	server := &rt.RenderServer{
+		Dir:         *dir,
+		MaxJobs:     *jobs,
+		MaxQueue:    *queue,
+		MaxSamples:  *maxSamples,
+		MaxDepth:    *maxDepth,
+		MaxFinished: *maxFinished,
+	}
+	log.Printf("serving on %v", *addr)
+	if err := http.ListenAndServe(*addr, server); err != nil {
+		fmt.Fprintln(os.Stderr, "serve:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,226 @@
+// term is a viewer for terminals (say, over ssh), drawing two pixels per
+// character with upper half blocks, in 24 bit colour where the terminal
+// supports it ($COLORTERM is truecolor or 24bit) and xterm's 256 colours where not
+//
+//	go run ./cmd/term [-scene files/scene.json]
+//
+// WASD moves and the arrow keys look around, as in the window viewer, and Q
+// or Esc quits
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nsf/termbox-go"
+
+	rt "github.com/finwarman/raytracer/raytracer"
+)
+
+func main() {
+	scenePath := flag.String("scene", "", "view this scene file (json), rather than the demo")
+	envmapPath := flag.String("envmap", "files/envmap-coast.jpg", "skybox image (for the demo)")
+	colours256 := flag.Bool("256", false, "use 256 colours, even if the terminal supports 24 bit colour")
+	fps := flag.Float64("fps", 15, "target frame rate")
+	flag.Parse()
+
+	// the scene (rebuilt each frame, so it can be animated), and the camera
+	// (which persists, so it can be moved)
+	var build func(frame float64) (*rt.Scene, *rt.Camera, error)
+	var end float64
+	if *scenePath != "" {
+		file, err := rt.LoadSceneFile(*scenePath)
+		if err != nil {
+			exit(err)
+		}
+		dir, err := filepath.Abs(filepath.Dir(*scenePath))
+		if err != nil {
+			exit(err)
+		}
+		*envmapPath = file.EnvMapPath(dir)
+		end = file.End()
+		build = func(frame float64) (*rt.Scene, *rt.Camera, error) {
+			return file.Build(envmap, frame)
+		}
+	} else {
+		timeline := rt.DemoTimeline()
+		end = timeline.End()
+		build = func(frame float64) (*rt.Scene, *rt.Camera, error) {
+			camera := &rt.Camera{FOV: math.Pi / 3.0, FocalDistance: 16.0}
+			scene := rt.DemoScene(envmap, camera)
+			return scene, camera, timeline.Apply(scene, camera, frame)
+		}
+	}
+	var err error
+	if envmap, err = rt.LoadImage(*envmapPath); err != nil {
+		exit(err)
+	}
+	_, camera, err := build(0)
+	if err != nil {
+		exit(err)
+	}
+
+	if err := termbox.Init(); err != nil {
+		exit(err)
+	}
+	defer termbox.Close()
+	truecolor := !*colours256 && (os.Getenv("COLORTERM") == "truecolor" || os.Getenv("COLORTERM") == "24bit")
+	if truecolor {
+		termbox.SetOutputMode(termbox.OutputRGB)
+	} else {
+		termbox.SetOutputMode(termbox.Output256)
+	}
+
+	events := make(chan termbox.Event, 16)
+	go func() {
+		for {
+			events <- termbox.PollEvent()
+		}
+	}()
+
+	frametime := time.Duration(float64(time.Second) / *fps)
+	fpsRolling := 0.0
+	for frame := 0.0; ; frame = math.Mod(frame+1, end+1) {
+		start := time.Now()
+
+		// handle the keys pressed since the last frame
+		for more := true; more; {
+			select {
+			case event := <-events:
+				if event.Type == termbox.EventError {
+					exit(event.Err)
+				}
+				if event.Type == termbox.EventKey && !handleKey(event, camera) {
+					return
+				}
+			default:
+				more = false
+			}
+		}
+
+		scene, animated, err := build(frame)
+		if err != nil {
+			exit(err)
+		}
+		// the timeline can animate the camera too, but moving it takes over
+		if !moved {
+			*camera = *animated
+		}
+
+		draw(scene, camera, truecolor, fmt.Sprintf("%-4.1f fps  camera %.1f, %.1f°  position %.2f, %.1f, %.1f",
+			fpsRolling, camera.Pitch*(180/math.Pi), camera.Yaw*(180/math.Pi),
+			camera.Position.X, camera.Position.Y, camera.Position.Z))
+
+		time.Sleep(frametime - time.Since(start))
+		fpsRolling = 0.8*fpsRolling + 0.2/time.Since(start).Seconds()
+	}
+}
+
+// envmap is the scene's skybox
+var envmap *image.NRGBA
+
+// moved is set once the camera's been moved by hand
+var moved = false
+
+// handleKey moves the camera as the window viewer does, returning false to quit
+func handleKey(event termbox.Event, camera *rt.Camera) bool {
+	// 1 degree
+	deltaAngle := math.Pi / 180
+
+	movementVector := rt.Vector3f{
+		X: math.Sin(camera.Yaw),
+		Y: 0,
+		Z: -math.Cos(camera.Yaw),
+	}
+	strafeVector := rt.Vector3f{
+		X: -movementVector.Z,
+		Y: 0,
+		Z: movementVector.X,
+	}
+
+	switch event.Key {
+	case termbox.KeyEsc, termbox.KeyCtrlC:
+		return false
+	case termbox.KeyArrowDown:
+		camera.Pitch += deltaAngle
+	case termbox.KeyArrowUp:
+		camera.Pitch -= deltaAngle
+	case termbox.KeyArrowRight:
+		camera.Yaw += deltaAngle
+	case termbox.KeyArrowLeft:
+		camera.Yaw -= deltaAngle
+	default:
+		// wasd keys
+		// (only move along X-Z, not y)
+		switch event.Ch {
+		case 'q', 'Q':
+			return false
+		case 's', 'S':
+			camera.Position = camera.Position.Sub(movementVector)
+		case 'w', 'W':
+			camera.Position = camera.Position.Add(movementVector)
+		case 'd', 'D':
+			camera.Position = camera.Position.Add(strafeVector)
+		case 'a', 'A':
+			camera.Position = camera.Position.Sub(strafeVector)
+		default:
+			return true
+		}
+	}
+	moved = true
+	return true
+}
+
+// draw renders the scene to fill the terminal (but for a status line at the
+// bottom), two pixels to a character
+func draw(scene *rt.Scene, camera *rt.Camera, truecolor bool, status string) {
+	columns, rows := termbox.Size()
+	rows-- // for the status line
+	if columns <= 0 || rows <= 0 {
+		return
+	}
+
+	// (terminal characters are about twice as tall as they're wide, so the
+	// pixels come out roughly square)
+	width, height := columns, rows*2
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	rt.Render(img, width, height, camera, scene)
+
+	attribute := func(x, y int) termbox.Attribute {
+		c := img.NRGBAAt(x, y)
+		if truecolor {
+			return termbox.RGBToAttribute(c.R, c.G, c.B)
+		}
+		return termbox.Attribute(rt.Xterm256(c)) + 1 // (0 is the default colour)
+	}
+	for y := 0; y < rows; y++ {
+		for x := 0; x < columns; x++ {
+			termbox.SetCell(x, y, '▀', attribute(x, 2*y), attribute(x, 2*y+1))
+		}
+	}
+
+	text := []rune(status)
+	for x := 0; x < columns; x++ {
+		ch := ' '
+		if x < len(text) {
+			ch = text[x]
+		}
+		termbox.SetCell(x, rows, ch, termbox.ColorDefault, termbox.ColorDefault)
+	}
+	termbox.Flush()
+}
+
+// exit reports err and exits, first giving the terminal back (if termbox has
+// it), as deferred functions don't run on os.Exit
+func exit(err error) {
+	if termbox.IsInit {
+		termbox.Close()
+	}
+	fmt.Fprintln(os.Stderr, "term:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,44 @@
+package raytracer
+
+import "math"
+
+// minAdaptiveSamples is the fewest samples an adaptive pixel takes before its
+// noise is estimated (fewer can agree by chance, e.g. all missing a small light)
+const minAdaptiveSamples = 4
+
+// pixelVariance keeps the running mean and variance of a pixel's sample
+// brightnesses (with welford's algorithm)
+type pixelVariance struct {
+	n        int
+	mean, m2 float64
+}
+
+func (v *pixelVariance) add(x float64) {
+	v.n++
+	d := x - v.mean
+	v.mean += d / float64(v.n)
+	v.m2 += d * (x - v.mean)
+}
+
+// stdError returns the estimated standard error of the mean
+func (v *pixelVariance) stdError() float64 {
+	if v.n < 2 {
+		return math.Inf(1)
+	}
+	return math.Sqrt(v.m2 / float64(v.n-1) / float64(v.n))
+}
+
+// moreSamples reports whether a pixel that's taken s samples needs another
+func moreSamples(camera *Camera, s int, variance *pixelVariance) bool {
+	min := camera.SampleCount()
+	if s < min {
+		return true
+	}
+	if !camera.Adaptive() || s >= camera.MaxSamples {
+		return false
+	}
+	if s < minAdaptiveSamples {
+		return true
+	}
+	return variance.stdError() > camera.NoiseThreshold
+}
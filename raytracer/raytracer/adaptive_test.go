@@ -0,0 +1,58 @@
+package raytracer
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestPixelVariance(t *testing.T) {
+	var v pixelVariance
+	if e := v.stdError(); !math.IsInf(e, 1) {
+		t.Errorf("error of no samples = %v, want +inf", e)
+	}
+	for _, x := range []float64{1, 2, 3, 4} {
+		v.add(x)
+	}
+	// sample variance 5/3, over 4 samples
+	if !near(v.mean, 2.5) || !near(v.stdError(), math.Sqrt(5.0/3/4)) {
+		t.Errorf("mean, error = %v, %v, want 2.5, %v", v.mean, v.stdError(), math.Sqrt(5.0/3/4))
+	}
+}
+
+func TestAdaptiveSampling(t *testing.T) {
+	camera := &Camera{FOV: math.Pi / 3, Samples: 2, MaxSamples: 32, NoiseThreshold: 0.01}
+	if !camera.Adaptive() {
+		t.Fatal("camera isn't adaptive")
+	}
+	width, height := 17, 17
+	passes := NewPasses(width, height, AOVSamples)
+	RenderPasses(image.NewNRGBA(image.Rect(0, 0, width, height)), width, height, camera, testScene(), passes)
+	samples := passes.AOVs[AOVSamples]
+
+	// flat areas stop as soon as the noise can be estimated
+	for _, p := range [][2]int{{0, 0}, {8, 8}} {
+		if n := samples.At(p[0], p[1]).X; n != minAdaptiveSamples {
+			t.Errorf("samples at %v = %v, want %v", p, n, minAdaptiveSamples)
+		}
+	}
+
+	// the sphere's edge is noisy, and takes more (but never too many)
+	most := 0.0
+	for _, v := range samples.Pix {
+		most = math.Max(most, v.X)
+	}
+	if most <= minAdaptiveSamples || most > float64(camera.MaxSamples) {
+		t.Errorf("most samples = %v, want in (%v, %v]", most, minAdaptiveSamples, camera.MaxSamples)
+	}
+
+	// without a maximum, every pixel takes Samples
+	camera = &Camera{FOV: math.Pi / 3, Samples: 3}
+	passes = NewPasses(width, height, AOVSamples)
+	RenderPasses(image.NewNRGBA(image.Rect(0, 0, width, height)), width, height, camera, testScene(), passes)
+	for _, v := range passes.AOVs[AOVSamples].Pix {
+		if v.X != 3 {
+			t.Fatalf("samples = %v, want 3", v.X)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package raytracer
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"image"
+	"math"
+)
+
+// AOV is an arbitrary output variable: something about what each pixel
+// sees, rendered alongside the colour image for compositing
+type AOV int
+
+const (
+	AOVDepth      AOV = iota // distance along the camera's view direction (0 where nothing was hit)
+	AOVNormal                // world space shading normal, each component in [-1,1]
+	AOVAlbedo                // surface colour, in [0,1]
+	AOVObjectID              // which object was hit (see Scene.Intersect, 0 for nothing)
+	AOVMaterialID            // hash of the material's properties, the same for copies of a material (0 for nothing)
+	AOVShadow                // fraction of the lights' intensity blocked from the surface
+
+	// lighting, weighted by the material's Albedo[0..3] (before fog, so these
+	// add up to the colour image wherever there isn't any)
+	AOVDiffuse
+	AOVSpecular
+	AOVReflection
+	AOVRefraction
+
+	AOVSamples // number of samples taken (which varies with adaptive sampling)
+
+	aovCount
+)
+
+var aovNames = [aovCount]string{
+	"depth", "normal", "albedo", "object_id", "material_id", "shadow",
+	"diffuse", "specular", "reflection", "refraction",
+	"samples",
+}
+
+func (a AOV) String() string {
+	if a >= 0 && a < aovCount {
+		return aovNames[a]
+	}
+	return "unknown"
+}
+
+// ParseAOV returns the AOV with the given name (as from String)
+func ParseAOV(name string) (AOV, bool) {
+	for i, n := range aovNames {
+		if n == name {
+			return AOV(i), true
+		}
+	}
+	return 0, false
+}
+
+// AllAOVs returns every AOV
+func AllAOVs() []AOV {
+	aovs := make([]AOV, aovCount)
+	for i := range aovs {
+		aovs[i] = AOV(i)
+	}
+	return aovs
+}
+
+// Passes are the float images a render writes alongside its 8 bit image
+type Passes struct {
+	Colour *FloatImage // the colour image, unclamped (highlights can be brighter than 1)
+	AOVs   map[AOV]*FloatImage
+}
+
+// NewPasses returns width x height images for the colour and each of aovs
+func NewPasses(width, height int, aovs ...AOV) *Passes {
+	p := &Passes{Colour: NewFloatImage(width, height), AOVs: make(map[AOV]*FloatImage)}
+	for _, aov := range aovs {
+		p.AOVs[aov] = NewFloatImage(width, height)
+	}
+	return p
+}
+
+// aovSample is what a primary ray saw
+type aovSample struct {
+	radiance                                  Vector3f // colour before clamping, 0 to 255 (or more)
+	hit                                       bool
+	point, normal, albedo                     Vector3f
+	object                                    int
+	material                                  uint32
+	shadow                                    float64
+	diffuse, specular, reflection, refraction Vector3f
+}
+
+func (a *aovSample) value(aov AOV, camera *Camera) Vector3f {
+	switch aov {
+	case AOVDepth:
+		d := a.point.Sub(camera.Position).Dot(camera.Forward())
+		return Vector3f{X: d, Y: d, Z: d}
+	case AOVNormal:
+		return a.normal
+	case AOVAlbedo:
+		return a.albedo
+	case AOVObjectID:
+		id := float64(a.object)
+		return Vector3f{X: id, Y: id, Z: id}
+	case AOVMaterialID:
+		id := float64(a.material)
+		return Vector3f{X: id, Y: id, Z: id}
+	case AOVShadow:
+		return Vector3f{X: a.shadow, Y: a.shadow, Z: a.shadow}
+	case AOVDiffuse:
+		return a.diffuse
+	case AOVSpecular:
+		return a.specular
+	case AOVReflection:
+		return a.reflection
+	case AOVRefraction:
+		return a.refraction
+	}
+	return Vector3f{}
+}
+
+// aovPixel accumulates the AOVs of a pixel's samples
+type aovPixel struct {
+	sums     [aovCount]Vector3f
+	radiance Vector3f
+	samples  int
+	hits     int
+	first    aovSample
+}
+
+func (p *aovPixel) add(a *aovSample, passes *Passes, camera *Camera) {
+	if p.samples == 0 {
+		p.first = *a
+	}
+	p.samples++
+	p.radiance = p.radiance.Add(a.radiance)
+	if !a.hit {
+		return
+	}
+	p.hits++
+	for aov := range passes.AOVs {
+		p.sums[aov] = p.sums[aov].Add(a.value(aov, camera))
+	}
+}
+
+// write sets pixel (i, j) of each AOV: ids are taken from the first sample (as
+// they can't be blended), surface properties averaged over the samples that
+// hit something, and lighting over all of them
+func (p *aovPixel) write(i, j int, passes *Passes, camera *Camera) {
+	for aov, img := range passes.AOVs {
+		var v Vector3f
+		switch aov {
+		case AOVObjectID, AOVMaterialID:
+			if p.first.hit {
+				v = p.first.value(aov, camera)
+			}
+		case AOVSamples:
+			n := float64(p.samples)
+			v = Vector3f{X: n, Y: n, Z: n}
+		case AOVDepth, AOVNormal, AOVAlbedo, AOVShadow:
+			if p.hits > 0 {
+				v = p.sums[aov].Multiply(1 / float64(p.hits))
+			}
+		default:
+			v = p.sums[aov].Multiply(1 / float64(p.samples))
+		}
+		img.Set(i, j, v)
+	}
+}
+
+// id returns a hash of the material's properties (ignoring textures), in
+// [1, 2^24) so it fits exactly in a 32 bit float
+func (m *Material) id() uint32 {
+	h := fnv.New32a()
+	c := m.DiffuseColour
+	h.Write([]byte{c.R, c.G, c.B, c.A})
+	for _, f := range []float64{m.SpecularExponent, m.Albedo[0], m.Albedo[1], m.Albedo[2], m.Albedo[3], m.RefractiveIndex} {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(f))
+		h.Write(b[:])
+	}
+	return h.Sum32()%(1<<24-1) + 1
+}
+
+// AOVPreview returns an 8 bit image of an AOV for viewing: depth with the
+// nearest surfaces brightest, normals mapped from [-1,1], a colour per id, and
+// sample counts as a heatmap (from blue for the fewest to red for the most)
+func AOVPreview(aov AOV, img *FloatImage) *image.NRGBA {
+	preview := NewFloatImage(img.Width, img.Height)
+
+	switch aov {
+	case AOVDepth:
+		near, far := math.Inf(1), 0.0
+		for _, v := range img.Pix {
+			if v.X > 0 {
+				near, far = math.Min(near, v.X), math.Max(far, v.X)
+			}
+		}
+		for i, v := range img.Pix {
+			if v.X > 0 {
+				d := 1 - 0.9*(v.X-near)/math.Max(far-near, 1e-9)
+				preview.Pix[i] = Vector3f{X: d, Y: d, Z: d}
+			}
+		}
+	case AOVNormal:
+		for i, v := range img.Pix {
+			preview.Pix[i] = v.Multiply(0.5).Add(Vector3f{X: 0.5, Y: 0.5, Z: 0.5})
+		}
+	case AOVObjectID, AOVMaterialID:
+		for i, v := range img.Pix {
+			if v.X > 0 {
+				preview.Pix[i] = idColour(uint32(v.X))
+			}
+		}
+	case AOVSamples:
+		least, most := math.Inf(1), 0.0
+		for _, v := range img.Pix {
+			least, most = math.Min(least, v.X), math.Max(most, v.X)
+		}
+		for i, v := range img.Pix {
+			preview.Pix[i] = heatmapColour((v.X - least) / math.Max(most-least, 1))
+		}
+	default:
+		copy(preview.Pix, img.Pix)
+	}
+	return preview.NRGBA()
+}
+
+// heatmapColour maps t in [0,1] from blue, through cyan, green and yellow, to red
+func heatmapColour(t float64) Vector3f {
+	t = math.Max(0, math.Min(1, t)) * 4
+	switch {
+	case t < 1:
+		return Vector3f{Y: t, Z: 1}
+	case t < 2:
+		return Vector3f{Y: 1, Z: 2 - t}
+	case t < 3:
+		return Vector3f{X: t - 2, Y: 1}
+	default:
+		return Vector3f{X: 1, Y: 4 - t}
+	}
+}
+
+// idColour returns a bright colour for an id, different for neighbouring ids
+func idColour(id uint32) Vector3f {
+	// golden ratio hues
+	hue := math.Mod(float64(id)*0.618033988749895, 1) * 6
+	x := 1 - math.Abs(math.Mod(hue, 2)-1)
+	switch int(hue) {
+	case 0:
+		return Vector3f{X: 1, Y: x}
+	case 1:
+		return Vector3f{X: x, Y: 1}
+	case 2:
+		return Vector3f{Y: 1, Z: x}
+	case 3:
+		return Vector3f{Y: x, Z: 1}
+	case 4:
+		return Vector3f{X: x, Z: 1}
+	default:
+		return Vector3f{X: 1, Z: x}
+	}
+}
@@ -0,0 +1,103 @@
+package raytracer
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func testScene() *Scene {
+	return &Scene{
+		EnvMap: image.NewNRGBA(image.Rect(0, 0, 4, 2)),
+		Lights: []*Light{
+			{Position: Vector3f{X: 0, Y: 0, Z: 10}, Intensity: 1},
+			{Position: Vector3f{X: 0, Y: 0, Z: -30}, Intensity: 3}, // behind the sphere
+		},
+		Spheres: []*Sphere{
+			{Centre: Vector3f{Z: -10}, Radius: 2, Material: RedRubber},
+		},
+	}
+}
+
+func TestRenderAOVs(t *testing.T) {
+	camera := &Camera{FOV: math.Pi / 3}
+	width, height := 9, 9
+	passes := NewPasses(width, height, AllAOVs()...)
+	RenderPasses(image.NewNRGBA(image.Rect(0, 0, width, height)), width, height, camera, testScene(), passes)
+
+	at := func(aov AOV, x, y int) Vector3f { return passes.AOVs[aov].At(x, y) }
+
+	// the centre pixel sees the front of the sphere
+	if d := at(AOVDepth, 4, 4).X; !near(d, 8) {
+		t.Errorf("centre depth = %v, want 8", d)
+	}
+	if n := at(AOVNormal, 4, 4); !nearVec(n, Vector3f{Z: 1}) {
+		t.Errorf("centre normal = %v, want (0, 0, 1)", n)
+	}
+	if id := at(AOVObjectID, 4, 4).X; id != 1 {
+		t.Errorf("centre object = %v, want 1", id)
+	}
+	if id := at(AOVMaterialID, 4, 4).X; id != float64(RedRubber.id()) || id == float64(Ivory.id()) {
+		t.Errorf("centre material = %v, want red rubber's %v", id, RedRubber.id())
+	}
+	// the light behind the sphere is blocked
+	if s := at(AOVShadow, 4, 4).X; !near(s, 0.75) {
+		t.Errorf("centre shadow = %v, want 0.75", s)
+	}
+	if a := at(AOVAlbedo, 4, 4); !near(a.X, float64(RedRubber.DiffuseColour.R)/0xff) {
+		t.Errorf("centre albedo = %v", a)
+	}
+
+	// without fog, the lighting adds up to the colour
+	sum := at(AOVDiffuse, 4, 4).Add(at(AOVSpecular, 4, 4)).Add(at(AOVReflection, 4, 4)).Add(at(AOVRefraction, 4, 4))
+	if c := passes.Colour.At(4, 4); sum.Sub(c).Norm() > 2.0/0xff {
+		t.Errorf("lighting adds up to %v, colour is %v", sum, c)
+	}
+
+	// the corners see nothing
+	if d, id := at(AOVDepth, 0, 0).X, at(AOVObjectID, 0, 0).X; d != 0 || id != 0 {
+		t.Errorf("corner depth, object = %v, %v, want 0, 0", d, id)
+	}
+}
+
+func TestParseAOV(t *testing.T) {
+	for _, aov := range AllAOVs() {
+		if got, ok := ParseAOV(aov.String()); !ok || got != aov {
+			t.Errorf("ParseAOV(%q) = %v, %v", aov.String(), got, ok)
+		}
+	}
+}
+
+func TestColourPassUnclamped(t *testing.T) {
+	// a mirror in front of the camera, reflecting a white sphere behind it,
+	// lit far brighter than white by a light between the two
+	white := Material{DiffuseColour: FloatToRGB(1, 1, 1), Albedo: [4]float64{1, 0, 0, 0}, SpecularExponent: 1, RefractiveIndex: 1}
+	scene := &Scene{
+		EnvMap: image.NewNRGBA(image.Rect(0, 0, 4, 2)),
+		Lights: []*Light{{Position: Vector3f{Z: 5}, Intensity: 4}},
+		Spheres: []*Sphere{
+			{Centre: Vector3f{Z: 10}, Radius: 2, Material: white},
+		},
+		Shapes: []Shape{
+			&Box{Min: Vector3f{X: -20, Y: -20, Z: -10.1}, Max: Vector3f{X: 20, Y: 20, Z: -10}, Material: Mirror},
+		},
+	}
+	camera := &Camera{FOV: math.Pi / 3}
+	width, height := 9, 9
+	passes := NewPasses(width, height, AOVReflection)
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	RenderPasses(img, width, height, camera, scene, passes)
+
+	// the reflection keeps its brightness (4 x white, times the mirror's albedo)
+	want := 4 * Mirror.Albedo[2]
+	if r := passes.AOVs[AOVReflection].At(4, 4); !near(r.X, want) || !near(r.Z, want) {
+		t.Errorf("reflection = %v, want %v", r, want)
+	}
+	if c := passes.Colour.At(4, 4); c.X <= 1 || c.Y <= 1 || c.Z <= 1 {
+		t.Errorf("colour = %v, want above 1", c)
+	}
+	// while the image is clamped
+	if c := img.NRGBAAt(4, 4); c.R != 0xff || c.G != 0xff || c.B != 0xff {
+		t.Errorf("pixel = %v, want white", c)
+	}
+}
@@ -0,0 +1,135 @@
+package raytracer
+
+import "math"
+
+// Box is an axis-aligned box
+type Box struct {
+	Min, Max Vector3f
+	Material Material
+}
+
+func (b *Box) Intersect(ray Ray, tMax float64) (float64, Hit, bool) {
+	origin, direction := ray.Origin, ray.Direction
+	t, hit, ok := boxIntersect(b.Min, b.Max, origin, direction, tMax)
+	if !ok {
+		return 0, Hit{}, false
+	}
+	hit.Local = hit.Point.Sub(b.Min)
+	hit.Material = &b.Material
+	return t, hit, true
+}
+
+func (b *Box) Bounds() AABB {
+	return AABB{Min: b.Min, Max: b.Max}
+}
+
+// OrientedBox is a box centred on Centre, rotated to line up with Axes
+type OrientedBox struct {
+	Centre   Vector3f
+	Axes     [3]Vector3f // local x, y, z (unit length, mutually perpendicular)
+	HalfSize Vector3f    // half the box's extent along each axis
+	Material Material
+}
+
+func (b *OrientedBox) toLocal(v Vector3f) Vector3f {
+	return Vector3f{X: v.Dot(b.Axes[0]), Y: v.Dot(b.Axes[1]), Z: v.Dot(b.Axes[2])}
+}
+
+func (b *OrientedBox) toWorld(v Vector3f) Vector3f {
+	return b.Axes[0].Multiply(v.X).Add(b.Axes[1].Multiply(v.Y)).Add(b.Axes[2].Multiply(v.Z))
+}
+
+func (b *OrientedBox) Intersect(ray Ray, tMax float64) (float64, Hit, bool) {
+	origin, direction := ray.Origin, ray.Direction
+	// rotation preserves length, so t is the same in the box's space
+	o := b.toLocal(origin.Sub(b.Centre))
+	d := b.toLocal(direction)
+	t, hit, ok := boxIntersect(b.HalfSize.Multiply(-1), b.HalfSize, o, d, tMax)
+	if !ok {
+		return 0, Hit{}, false
+	}
+
+	hit.Local = hit.Point
+	hit.Point = origin.Add(direction.Multiply(t))
+	hit.Normal = b.toWorld(hit.Normal)
+	hit.Tangent = b.toWorld(hit.Tangent)
+	hit.Bitangent = b.toWorld(hit.Bitangent)
+	hit.Material = &b.Material
+	return t, hit, true
+}
+
+func (b *OrientedBox) Bounds() AABB {
+	// extent along each world axis is the sum of the projected half-axes
+	var e Vector3f
+	for i, h := range []float64{b.HalfSize.X, b.HalfSize.Y, b.HalfSize.Z} {
+		a := b.Axes[i]
+		e = e.Add(Vector3f{X: math.Abs(a.X) * h, Y: math.Abs(a.Y) * h, Z: math.Abs(a.Z) * h})
+	}
+	return AABB{Min: b.Centre.Sub(e), Max: b.Centre.Add(e)}
+}
+
+// boxIntersect intersects a ray with the axis-aligned box [min, max] (slab
+// method), using the exit point if the ray starts inside
+// the hit's Point is in the same space as origin
+func boxIntersect(min, max, origin, direction Vector3f, tMax float64) (float64, Hit, bool) {
+	tNear, tFar := math.Inf(-1), math.Inf(1)
+	nearAxis, farAxis := 0, 0
+	for a := 0; a < 3; a++ {
+		o, d := axis(origin, a), axis(direction, a)
+		lo, hi := axis(min, a), axis(max, a)
+		if math.Abs(d) < 1e-12 {
+			// parallel to this slab, must already be inside it
+			if o < lo || o > hi {
+				return 0, Hit{}, false
+			}
+			continue
+		}
+		t0, t1 := (lo-o)/d, (hi-o)/d
+		if t0 > t1 {
+			t0, t1 = t1, t0
+		}
+		if t0 > tNear {
+			tNear, nearAxis = t0, a
+		}
+		if t1 < tFar {
+			tFar, farAxis = t1, a
+		}
+	}
+	if tNear > tFar || tFar <= 1e-9 {
+		return 0, Hit{}, false
+	}
+
+	t, a := tNear, nearAxis
+	if t <= 1e-9 {
+		t, a = tFar, farAxis // starting inside the box
+	}
+	if t >= tMax {
+		return 0, Hit{}, false
+	}
+
+	point := origin.Add(direction.Multiply(t))
+	centre := min.Add(max).Multiply(0.5)
+	var n Vector3f
+	if axis(point, a) > axis(centre, a) {
+		n.Set(a, 1)
+	} else {
+		n.Set(a, -1)
+	}
+
+	// uvs run across the face, along the other two axes
+	ua, va := (a+1)%3, (a+2)%3
+	var tangent, bitangent Vector3f
+	tangent.Set(ua, 1)
+	bitangent.Set(va, 1)
+	u := (axis(point, ua) - axis(min, ua)) / (axis(max, ua) - axis(min, ua))
+	v := (axis(point, va) - axis(min, va)) / (axis(max, va) - axis(min, va))
+
+	return t, Hit{
+		Point:     point,
+		Normal:    n,
+		Tangent:   tangent,
+		Bitangent: bitangent,
+		U:         u,
+		V:         v,
+	}, true
+}
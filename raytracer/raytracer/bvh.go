@@ -0,0 +1,261 @@
+package raytracer
+
+import (
+	"math"
+	"sort"
+)
+
+// AABB is an axis-aligned bounding box
+type AABB struct {
+	Min, Max Vector3f
+}
+
+// EmptyAABB returns a box containing nothing, ready to be extended
+func EmptyAABB() AABB {
+	inf := math.Inf(1)
+	return AABB{
+		Min: Vector3f{X: inf, Y: inf, Z: inf},
+		Max: Vector3f{X: -inf, Y: -inf, Z: -inf},
+	}
+}
+
+// InfiniteAABB returns a box containing everything (for unbounded shapes like planes)
+func InfiniteAABB() AABB {
+	inf := math.Inf(1)
+	return AABB{
+		Min: Vector3f{X: -inf, Y: -inf, Z: -inf},
+		Max: Vector3f{X: inf, Y: inf, Z: inf},
+	}
+}
+
+// IsInfinite reports whether the box is unbounded in any direction
+func (b AABB) IsInfinite() bool {
+	return math.IsInf(b.Min.X, -1) || math.IsInf(b.Min.Y, -1) || math.IsInf(b.Min.Z, -1) ||
+		math.IsInf(b.Max.X, 1) || math.IsInf(b.Max.Y, 1) || math.IsInf(b.Max.Z, 1)
+}
+
+// Extend returns the box grown to contain p
+func (b AABB) Extend(p Vector3f) AABB {
+	return AABB{
+		Min: Vector3f{X: math.Min(b.Min.X, p.X), Y: math.Min(b.Min.Y, p.Y), Z: math.Min(b.Min.Z, p.Z)},
+		Max: Vector3f{X: math.Max(b.Max.X, p.X), Y: math.Max(b.Max.Y, p.Y), Z: math.Max(b.Max.Z, p.Z)},
+	}
+}
+
+// Union returns the box containing both b and c
+func (b AABB) Union(c AABB) AABB {
+	return b.Extend(c.Min).Extend(c.Max)
+}
+
+// Overlap returns the box contained by both b and c
+func (b AABB) Overlap(c AABB) AABB {
+	return AABB{
+		Min: Vector3f{X: math.Max(b.Min.X, c.Min.X), Y: math.Max(b.Min.Y, c.Min.Y), Z: math.Max(b.Min.Z, c.Min.Z)},
+		Max: Vector3f{X: math.Min(b.Max.X, c.Max.X), Y: math.Min(b.Max.Y, c.Max.Y), Z: math.Min(b.Max.Z, c.Max.Z)},
+	}
+}
+
+func (b AABB) Centroid() Vector3f {
+	return b.Min.Add(b.Max).Multiply(0.5)
+}
+
+// axis returns the component of v along axis 0, 1 or 2 (x, y, z)
+func axis(v Vector3f, a int) float64 {
+	switch a {
+	case 0:
+		return v.X
+	case 1:
+		return v.Y
+	default:
+		return v.Z
+	}
+}
+
+// RayIntersect checks if the ray hits the box before tMax (slab test)
+// invDir is 1/direction, per component
+func (b AABB) RayIntersect(origin, invDir Vector3f, tMax float64) bool {
+	tMin := 0.0
+	for a := 0; a < 3; a++ {
+		o, inv := axis(origin, a), axis(invDir, a)
+		t0 := (axis(b.Min, a) - o) * inv
+		t1 := (axis(b.Max, a) - o) * inv
+		if inv < 0 {
+			t0, t1 = t1, t0
+		}
+		// written so NaNs (0 * inf, for rays in the slab plane) don't cull the box
+		if t0 > tMin {
+			tMin = t0
+		}
+		if t1 < tMax {
+			tMax = t1
+		}
+		if tMax < tMin {
+			return false
+		}
+	}
+	return true
+}
+
+// Shape is anything that can be hit by a ray
+type Shape interface {
+	// Intersect finds the nearest hit along the ray (direction must be
+	// normalised) closer than tMax, returning its distance and surface
+	Intersect(ray Ray, tMax float64) (float64, Hit, bool)
+	// Bounds returns a box containing the shape
+	Bounds() AABB
+}
+
+// BVH is a bounding volume hierarchy over a set of shapes, so rays only test
+// the shapes whose boxes they pass through
+type BVH struct {
+	nodes     []bvhNode
+	shapes    []Shape
+	unbounded []Shape // shapes with infinite bounds are always tested
+}
+
+// bvhNode is either an interior node (count == 0, children at index+1 and
+// right), or a leaf holding shapes[start:start+count]
+type bvhNode struct {
+	bounds       AABB
+	right        int
+	start, count int
+}
+
+const bvhLeafSize = 4
+
+// NewBVH builds a hierarchy over shapes, splitting at the median centroid
+// along the longest axis
+func NewBVH(shapes []Shape) *BVH {
+	b := &BVH{}
+	for _, s := range shapes {
+		if s.Bounds().IsInfinite() {
+			b.unbounded = append(b.unbounded, s)
+		} else {
+			b.shapes = append(b.shapes, s)
+		}
+	}
+
+	bounds := make([]AABB, len(b.shapes))
+	for i, s := range b.shapes {
+		bounds[i] = s.Bounds()
+	}
+	if len(b.shapes) > 0 {
+		b.build(bounds, 0, len(b.shapes))
+	}
+	return b
+}
+
+// build appends the node for shapes[start:end] (and its children), returning its index
+func (b *BVH) build(bounds []AABB, start, end int) int {
+	idx := len(b.nodes)
+	b.nodes = append(b.nodes, bvhNode{})
+
+	box, centroids := EmptyAABB(), EmptyAABB()
+	for i := start; i < end; i++ {
+		box = box.Union(bounds[i])
+		centroids = centroids.Extend(bounds[i].Centroid())
+	}
+	b.nodes[idx].bounds = box
+
+	if end-start <= bvhLeafSize {
+		b.nodes[idx].start, b.nodes[idx].count = start, end-start
+		return idx
+	}
+
+	// split along the axis where centroids are most spread out
+	extent := centroids.Max.Sub(centroids.Min)
+	split := 0
+	if extent.Y > extent.X {
+		split = 1
+	}
+	if extent.Z > axis(extent, split) {
+		split = 2
+	}
+	sort.Sort(&bvhSorter{bvh: b, bounds: bounds[start:end], offset: start, axis: split})
+
+	mid := (start + end) / 2
+	b.build(bounds, start, mid)
+	b.nodes[idx].right = b.build(bounds, mid, end)
+	return idx
+}
+
+// bvhSorter sorts a range of shapes (and their cached bounds) by centroid
+type bvhSorter struct {
+	bvh    *BVH
+	bounds []AABB
+	offset int
+	axis   int
+}
+
+func (s *bvhSorter) Len() int { return len(s.bounds) }
+
+func (s *bvhSorter) Less(i, j int) bool {
+	return axis(s.bounds[i].Centroid(), s.axis) < axis(s.bounds[j].Centroid(), s.axis)
+}
+
+func (s *bvhSorter) Swap(i, j int) {
+	s.bounds[i], s.bounds[j] = s.bounds[j], s.bounds[i]
+	shapes := s.bvh.shapes
+	shapes[s.offset+i], shapes[s.offset+j] = shapes[s.offset+j], shapes[s.offset+i]
+}
+
+func (b *BVH) Intersect(ray Ray, tMax float64) (float64, Hit, bool) {
+	var nearest Hit
+	found := false
+
+	for _, s := range b.unbounded {
+		if t, hit, ok := s.Intersect(ray, tMax); ok {
+			tMax, nearest, found = t, hit, true
+		}
+	}
+	if ray.stats != nil {
+		ray.stats.ShapeTests += int64(len(b.unbounded))
+	}
+	if len(b.nodes) == 0 {
+		return tMax, nearest, found
+	}
+
+	origin, direction := ray.Origin, ray.Direction
+	invDir := Vector3f{X: 1 / direction.X, Y: 1 / direction.Y, Z: 1 / direction.Z}
+	var stack [64]int
+	sp := 0
+	stack[sp] = 0
+	sp++
+	for sp > 0 {
+		sp--
+		idx := stack[sp]
+		node := &b.nodes[idx]
+		if ray.stats != nil {
+			ray.stats.BoxTests++
+		}
+		if !node.bounds.RayIntersect(origin, invDir, tMax) {
+			continue
+		}
+		if node.count > 0 {
+			if ray.stats != nil {
+				ray.stats.ShapeTests += int64(node.count)
+			}
+			for _, s := range b.shapes[node.start : node.start+node.count] {
+				if t, hit, ok := s.Intersect(ray, tMax); ok {
+					tMax, nearest, found = t, hit, true
+				}
+			}
+			continue
+		}
+		// the left child immediately follows its parent
+		stack[sp], stack[sp+1] = node.right, idx+1
+		sp += 2
+	}
+	return tMax, nearest, found
+}
+
+func (b *BVH) Bounds() AABB {
+	box := EmptyAABB()
+	if len(b.nodes) > 0 {
+		box = b.nodes[0].bounds
+	}
+	for _, s := range b.unbounded {
+		box = box.Union(s.Bounds())
+	}
+	return box
+}
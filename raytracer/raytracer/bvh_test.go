@@ -0,0 +1,46 @@
+package raytracer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBVHMatchesLinearScan(t *testing.T) {
+	r := NewRNG(1, 2)
+	random := func(scale float64) Vector3f {
+		return Vector3f{X: r.Float64() - 0.5, Y: r.Float64() - 0.5, Z: r.Float64() - 0.5}.Multiply(scale)
+	}
+
+	// overlapping spheres and boxes of all sizes, and a plane (unbounded)
+	var shapes []Shape
+	for i := 0; i < 200; i++ {
+		c := random(20)
+		if i%2 == 0 {
+			shapes = append(shapes, &Sphere{Centre: c, Radius: 0.1 + r.Float64(), Material: Ivory})
+		} else {
+			size := Vector3f{X: r.Float64(), Y: r.Float64(), Z: r.Float64()}
+			shapes = append(shapes, &Box{Min: c, Max: c.Add(size), Material: Ivory})
+		}
+	}
+	shapes = append(shapes, &Plane{Point: Vector3f{Y: -8}, Normal: Vector3f{Y: 1}, Material: Ivory})
+	bvh := NewBVH(shapes)
+
+	for i := 0; i < 2000; i++ {
+		ray := Ray{Origin: random(30), Direction: random(1).Normalised()}
+		tMax := math.MaxFloat64
+		if i%4 == 0 {
+			tMax = r.Float64() * 20
+		}
+
+		wantT, want, wantOK := 0.0, Hit{}, false
+		for _, s := range shapes {
+			if t, hit, ok := s.Intersect(ray, tMax); ok && (!wantOK || t < wantT) {
+				wantT, want, wantOK = t, hit, true
+			}
+		}
+		gotT, got, gotOK := bvh.Intersect(ray, tMax)
+		if gotOK != wantOK || (wantOK && (!near(gotT, wantT) || !nearVec(got.Normal, want.Normal))) {
+			t.Fatalf("ray %v: bvh hit %v at %v, linear scan %v at %v", ray, gotOK, gotT, wantOK, wantT)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package raytracer
+
+import "math"
+
+// Projection is how a camera maps the image onto directions
+type Projection int
+
+const (
+	Perspective  Projection = iota
+	Orthographic            // parallel rays, no perspective
+	// fisheyes fit FOV across the image height (and can go past 180°), with a circular image
+	FisheyeEquidistant // angle from the centre proportional to distance from the centre
+	FisheyeEquisolid   // equal areas in the image cover equal solid angles
+	Equirectangular    // full 360° x 180° panorama, laid out like the skybox envmaps
+)
+
+var projectionNames = []string{"perspective", "orthographic", "equidistant", "equisolid", "equirectangular"}
+
+func (p Projection) String() string {
+	if int(p) < len(projectionNames) {
+		return projectionNames[p]
+	}
+	return "unknown"
+}
+
+// ParseProjection returns the projection with the given name (as from String)
+func ParseProjection(name string) (Projection, bool) {
+	for i, n := range projectionNames {
+		if n == name {
+			return Projection(i), true
+		}
+	}
+	return 0, false
+}
+
+// Stereo is how a camera lays out a pair of images, one per eye
+type Stereo int
+
+const (
+	Mono       Stereo = iota
+	SideBySide        // left eye on the left half of the image
+	TopBottom         // left eye on the top half of the image
+)
+
+// DefaultInterpupillaryDistance is the distance between the eyes when a
+// stereo camera doesn't set one
+const DefaultInterpupillaryDistance = 0.065
+
+// Camera is a thin-lens camera, with zero aperture it is a pinhole camera
+type Camera struct {
+	Position Vector3f
+	Pitch    float64 // rotation around the x-axis (radians, positive looks down)
+	Yaw      float64 // rotation around the y-axis (radians, positive looks right)
+	FOV      float64 // vertical field of view (radians)
+
+	Projection  Projection
+	OrthoHeight float64 // height of the orthographic view, 0 to match the perspective view at the focal distance
+
+	Stereo                 Stereo
+	InterpupillaryDistance float64 // distance between the eyes of a stereo camera
+
+	ApertureRadius   float64 // lens radius, 0 for everything in focus
+	FocalDistance    float64 // distance along the view direction that is in focus
+	ApertureBlades   int     // number of aperture blades for polygonal bokeh, 0 for a circular aperture
+	ApertureRotation float64 // rotation of the polygonal aperture (radians)
+	Autofocus        bool    // focus on whatever is under the centre of the image each frame
+
+	Samples int // rays per pixel (defaults to 1)
+
+	// adaptive sampling: with MaxSamples above Samples, pixels keep being
+	// sampled (up to MaxSamples) until the standard error of their mean
+	// brightness, in [0,1], falls to NoiseThreshold
+	MaxSamples     int
+	NoiseThreshold float64
+
+	// anything random about a sample comes from its RNG, keyed by Seed, Frame,
+	// the pixel and the sample (so every render of a frame is the same); a
+	// non-zero Seed also offsets each pixel's sample pattern differently, so
+	// neighbouring pixels' errors don't line up into visible structure (lens
+	// samples are always offset, whatever the Seed)
+	Seed  uint64
+	Frame int
+
+	// rays are spread over the time the shutter is open, so anything moving
+	// in that time is blurred
+	ShutterOpen, ShutterClose float64
+	Motion                    Motion // movement of the camera, relative to Position (optional)
+}
+
+// rotate applies the camera's pitch then yaw to a camera-space vector
+func (c *Camera) rotate(v Vector3f) Vector3f {
+	// rotation matrix around x-axis
+	rotationMatrixX := Matrix4x4{
+		{1, 0, 0, 0},
+		{0, math.Cos(c.Pitch), math.Sin(c.Pitch), 0},
+		{0, -math.Sin(c.Pitch), math.Cos(c.Pitch), 0},
+		{0, 0, 0, 1},
+	}
+
+	// rotation matrix around y-axis
+	rotationMatrixY := Matrix4x4{
+		{math.Cos(c.Yaw), 0, -math.Sin(c.Yaw), 0},
+		{0, 1, 0, 0},
+		{math.Sin(c.Yaw), 0, math.Cos(c.Yaw), 0},
+		{0, 0, 0, 1},
+	}
+
+	return v.MultiplyMatrix4x4(rotationMatrixX).MultiplyMatrix4x4(rotationMatrixY)
+}
+
+// Forward returns the direction the camera is looking in
+func (c *Camera) Forward() Vector3f {
+	return c.rotate(Vector3f{X: 0, Y: 0, Z: -1}).Normalised()
+}
+
+// SampleCount returns the number of rays to trace per pixel
+func (c *Camera) SampleCount() int {
+	if c.Samples < 1 {
+		return 1
+	}
+	return c.Samples
+}
+
+// Adaptive reports whether pixels are sampled until they're below the
+// noise threshold, rather than SampleCount times
+func (c *Camera) Adaptive() bool {
+	return c.MaxSamples > c.SampleCount()
+}
+
+// Ray returns sample s (of SampleCount, or MaxSamples if adaptive) through
+// pixel (i, j) of a width x height image
+// samples are spread over the pixel, lens and shutter interval with
+// low-discrepancy sequences, so the same sample always gives the same ray
+func (c *Camera) Ray(i, j, width, height, s int) Ray {
+	n := c.SampleCount()
+
+	// position within the pixel, and time (the middle of both, for a single sample)
+	px, py := 0.5, 0.5
+	shutter := 0.5
+	switch {
+	case c.Adaptive():
+		// (a hammersley set needs to know how many samples there'll be, but
+		// any prefix of the halton sequence is well spread)
+		px, py = halton(s+1, 2), halton(s+1, 11)
+		shutter = halton(s+1, 7)
+	case n > 1:
+		px, py = hammersley(s, n)
+		shutter = halton(s+1, 7)
+	}
+	// use different bases for the lens than the pixel, so the two aren't
+	// correlated (and the centre of the lens, for a single sample)
+	lu, lv := 0.5, 0.5
+	if c.Adaptive() || n > 1 {
+		lu, lv = halton(s+1, 3), halton(s+1, 5)
+	}
+
+	if c.Seed != 0 || c.ApertureRadius > 0 {
+		// cranley-patterson rotation: shift the whole pattern by a per pixel
+		// amount (wrapping around), which keeps it just as well spread. the
+		// lens is always shifted, so neighbouring pixels look through
+		// different parts of it and anything out of focus blurs (rather than
+		// the whole image shifting) however few samples there are
+		r := c.RNG(i, j, -1)
+		dx, dy := r.Float64(), r.Float64()
+		lu, lv = wrap(lu+r.Float64()), wrap(lv+r.Float64())
+		if c.Seed != 0 {
+			px, py = wrap(px+dx), wrap(py+dy)
+			shutter = wrap(shutter + r.Float64())
+		}
+	}
+	time := c.ShutterOpen + (c.ShutterClose-c.ShutterOpen)*shutter
+
+	i, j, width, height, eye := c.eye(i, j, width, height)
+	origin, direction, _ := c.lensRay(i, j, width, height, eye, px, py, lu, lv)
+
+	if c.Motion != nil {
+		// move the camera around its own position
+		m := c.Motion.At(time)
+		origin = c.Position.Add(m.Point(origin.Sub(c.Position)))
+		direction = m.Direction(direction).Normalised()
+	}
+	return Ray{Origin: origin, Direction: direction, Time: time}
+}
+
+// RNG returns the random number generator for sample s of pixel (i, j) (or,
+// for s = -1, the pixel's own)
+func (c *Camera) RNG(i, j, s int) RNG {
+	return SampleRNG(c.Seed, c.Frame, i, j, s)
+}
+
+// Visible reports whether pixel (i, j) of a width x height image shows
+// anything (fisheye images are a circle, with nothing outside it)
+func (c *Camera) Visible(i, j, width, height int) bool {
+	i, j, width, height, eye := c.eye(i, j, width, height)
+	_, _, ok := c.lensRay(i, j, width, height, eye, 0.5, 0.5, 0, 0)
+	return ok
+}
+
+// eye returns which eye (-1 left, 1 right, 0 for mono) sees pixel (i, j) of
+// a width x height image, and the pixel within that eye's image
+func (c *Camera) eye(i, j, width, height int) (int, int, int, int, float64) {
+	switch c.Stereo {
+	case SideBySide:
+		width /= 2
+		if i >= width {
+			return i - width, j, width, height, 1
+		}
+		return i, j, width, height, -1
+	case TopBottom:
+		height /= 2
+		if j >= height {
+			return i, j - height, width, height, 1
+		}
+		return i, j, width, height, -1
+	}
+	return i, j, width, height, 0
+}
+
+// lensRay returns the ray through point (px, py) within pixel (i, j) and
+// point (lu, lv) on the lens (all in [0,1)) as seen by eye, and whether that
+// point is within the image
+func (c *Camera) lensRay(i, j, width, height int, eye, px, py, lu, lv float64) (Vector3f, Vector3f, bool) {
+	u := (float64(i) + px) / float64(width)
+	v := (float64(j) + py) / float64(height)
+	offset, dir, ok := c.project(u, v, float64(width)/float64(height))
+
+	if eye != 0 {
+		// eyes either side of the view direction (for panoramas, either side of
+		// each direction, so every way you look is in stereo)
+		right := Vector3f{X: 1}
+		if c.Projection == Equirectangular {
+			right = Vector3f{X: -dir.Z, Z: dir.X}
+			if n := right.Norm(); n > 0 {
+				right = right.Multiply(1 / n)
+			}
+		}
+		ipd := c.InterpupillaryDistance
+		if ipd == 0 {
+			ipd = DefaultInterpupillaryDistance
+		}
+		offset = offset.Add(right.Multiply(eye * ipd / 2))
+	}
+
+	origin := c.Position.Add(c.rotate(offset))
+	direction := c.rotate(dir).Normalised()
+
+	if c.Projection != Perspective || c.ApertureRadius <= 0 || c.FocalDistance <= 0 {
+		return origin, direction, ok
+	}
+
+	// thin lens: every ray through the lens for this pixel meets at the same
+	// point on the focal plane, so only things at the focal distance are sharp
+	focus := origin.Add(direction.Multiply(c.FocalDistance / direction.Dot(c.Forward())))
+
+	lx, ly := c.sampleAperture(lu, lv)
+	origin = origin.Add(c.rotate(Vector3f{X: lx, Y: ly}.Multiply(c.ApertureRadius)))
+
+	return origin, focus.Sub(origin).Normalised(), ok
+}
+
+// project maps (u, v) across the image (in [0,1], v downwards) to a camera space
+// ray origin and direction, and whether it is within the image
+func (c *Camera) project(u, v, aspect float64) (Vector3f, Vector3f, bool) {
+	x := (2*u - 1) * aspect
+	y := -1.0 * (2*v - 1)
+
+	switch c.Projection {
+	case Orthographic:
+		h := c.OrthoHeight
+		if h <= 0 {
+			h = 2 * c.FocalDistance * math.Tan(c.FOV/2.0)
+		}
+		return Vector3f{X: x * h / 2, Y: y * h / 2}, Vector3f{X: 0, Y: 0, Z: -1}, true
+
+	case FisheyeEquidistant, FisheyeEquisolid:
+		r := math.Hypot(x, y)
+		var theta float64
+		if c.Projection == FisheyeEquidistant {
+			theta = r * c.FOV / 2
+		} else {
+			theta = 2 * math.Asin(math.Min(1, r*math.Sin(c.FOV/4)))
+		}
+		ok := r <= 1 && theta <= math.Pi
+		theta = math.Min(theta, math.Pi)
+		phi := math.Atan2(y, x)
+		return Vector3f{}, Vector3f{
+			X: math.Sin(theta) * math.Cos(phi),
+			Y: math.Sin(theta) * math.Sin(phi),
+			Z: -math.Cos(theta),
+		}, ok
+
+	case Equirectangular:
+		// the inverse of the skybox lookup in castRay
+		longitude := (u - 0.5) * 2 * math.Pi
+		latitude := (0.5 - v) * math.Pi
+		return Vector3f{}, Vector3f{
+			X: math.Cos(latitude) * math.Cos(longitude),
+			Y: math.Sin(latitude),
+			Z: math.Cos(latitude) * math.Sin(longitude),
+		}, true
+	}
+
+	x *= math.Tan(c.FOV / 2.0)
+	y *= math.Tan(c.FOV / 2.0)
+	return Vector3f{}, Vector3f{X: x, Y: y, Z: -1}.Normalised(), true
+}
+
+// sampleAperture maps (u, v) in [0,1)^2 to a point on the unit aperture
+func (c *Camera) sampleAperture(u, v float64) (float64, float64) {
+	if c.ApertureBlades < 3 {
+		// concentric disc mapping (shirley-chiu), keeps samples evenly spread
+		a, b := 2*u-1, 2*v-1
+		if a == 0 && b == 0 {
+			return 0, 0
+		}
+		var r, phi float64
+		if math.Abs(a) > math.Abs(b) {
+			r, phi = a, (math.Pi/4)*(b/a)
+		} else {
+			r, phi = b, math.Pi/2-(math.Pi/4)*(a/b)
+		}
+		return r * math.Cos(phi), r * math.Sin(phi)
+	}
+
+	// regular polygon: pick one of its triangles (from the centre), then a
+	// uniformly distributed point within it
+	n := float64(c.ApertureBlades)
+	k := math.Floor(u * n)
+	u = u*n - k
+	a0 := c.ApertureRotation + 2*math.Pi*k/n
+	a1 := a0 + 2*math.Pi/n
+
+	su := math.Sqrt(u)
+	b1, b2 := su*(1-v), su*v
+	return b1*math.Cos(a0) + b2*math.Cos(a1), b1*math.Sin(a0) + b2*math.Sin(a1)
+}
+
+// hammersley returns point i of an n point hammersley set in [0,1)^2
+func hammersley(i, n int) (float64, float64) {
+	return (float64(i) + 0.5) / float64(n), radicalInverse(uint32(i))
+}
+
+// halton returns element i of the halton sequence in the given (prime) base
+func halton(i, base int) float64 {
+	f, r := 1.0, 0.0
+	for ; i > 0; i /= base {
+		f /= float64(base)
+		r += f * float64(i%base)
+	}
+	return r
+}
+
+// wrap returns the fractional part of x >= 0, so [0,2) wraps around to [0,1)
+func wrap(x float64) float64 {
+	return x - math.Floor(x)
+}
+
+// radicalInverse mirrors the binary digits of i around the decimal point (van der corput)
+func radicalInverse(i uint32) float64 {
+	i = (i << 16) | (i >> 16)
+	i = ((i & 0x55555555) << 1) | ((i & 0xAAAAAAAA) >> 1)
+	i = ((i & 0x33333333) << 2) | ((i & 0xCCCCCCCC) >> 2)
+	i = ((i & 0x0F0F0F0F) << 4) | ((i & 0xF0F0F0F0) >> 4)
+	i = ((i & 0x00FF00FF) << 8) | ((i & 0xFF00FF00) >> 8)
+	return float64(i) / (1 << 32)
+}
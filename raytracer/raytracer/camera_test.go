@@ -0,0 +1,189 @@
+package raytracer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCameraThinLensFocus(t *testing.T) {
+	c := &Camera{
+		Position:       Vector3f{X: 1, Y: 2, Z: 3},
+		Yaw:            0.3,
+		Pitch:          -0.2,
+		FOV:            math.Pi / 3,
+		ApertureRadius: 0.5,
+		FocalDistance:  10,
+		Samples:        16,
+	}
+
+	// every lens sample for a pixel passes through the same pixel-sized patch
+	// of the focal plane (pixel jitter moves it, but by no more than a pixel)
+	pixel := math.Sqrt2 * 2 * c.FocalDistance * math.Tan(c.FOV/2) / 48
+	var focus Vector3f
+	for s := 0; s < c.Samples; s++ {
+		ray := c.Ray(31, 17, 64, 48, s)
+		origin, direction := ray.Origin, ray.Direction
+		// distance along the ray to the focal plane
+		plane := c.Position.Add(c.Forward().Multiply(c.FocalDistance))
+		tFocus := plane.Sub(origin).Dot(c.Forward()) / direction.Dot(c.Forward())
+		p := origin.Add(direction.Multiply(tFocus))
+
+		if origin.Sub(c.Position).Norm() > c.ApertureRadius+testEpsilon {
+			t.Errorf("sample %d: origin %v outside the aperture", s, origin)
+		}
+		if s == 0 {
+			focus = p
+		} else if p.Sub(focus).Norm() > pixel {
+			t.Errorf("sample %d: focuses at %v, sample 0 at %v", s, p, focus)
+		}
+	}
+}
+
+func TestCameraPinholeCentre(t *testing.T) {
+	c := &Camera{Yaw: 0.5, FOV: math.Pi / 3}
+	ray := c.Ray(1, 1, 3, 3, 0) // centre pixel of a 3x3 image
+	origin, direction := ray.Origin, ray.Direction
+	if !nearVec(origin, c.Position) || !nearVec(direction, c.Forward()) {
+		t.Errorf("centre ray = %v %v, want %v %v", origin, direction, c.Position, c.Forward())
+	}
+}
+
+func TestApertureShapes(t *testing.T) {
+	for _, blades := range []int{0, 5, 6} {
+		c := &Camera{ApertureBlades: blades}
+		for i := 0; i < 256; i++ {
+			x, y := c.sampleAperture(halton(i+1, 2), halton(i+1, 3))
+			if math.Hypot(x, y) > 1+testEpsilon {
+				t.Errorf("%d blades: sample (%v, %v) outside the unit aperture", blades, x, y)
+			}
+		}
+	}
+}
+
+func TestProjectionCentre(t *testing.T) {
+	for _, p := range []Projection{Perspective, Orthographic, FisheyeEquidistant, FisheyeEquisolid} {
+		c := &Camera{Projection: p, Yaw: 0.4, Pitch: 0.1, FOV: math.Pi / 2, FocalDistance: 5}
+		ray := c.Ray(2, 2, 5, 5, 0)
+		if !nearVec(ray.Origin, c.Position) || !nearVec(ray.Direction, c.Forward()) {
+			t.Errorf("%v: centre ray = %v %v, want %v %v", p, ray.Origin, ray.Direction, c.Position, c.Forward())
+		}
+	}
+}
+
+func TestOrthographic(t *testing.T) {
+	c := &Camera{Projection: Orthographic, OrthoHeight: 4}
+	top, bottom := c.Ray(0, 0, 1, 2, 0), c.Ray(0, 1, 1, 2, 0)
+	if !nearVec(top.Direction, bottom.Direction) {
+		t.Errorf("rays aren't parallel: %v, %v", top.Direction, bottom.Direction)
+	}
+	// pixel centres a quarter of the way in from the top and bottom
+	if !nearVec(top.Origin, Vector3f{Y: 1}) || !nearVec(bottom.Origin, Vector3f{Y: -1}) {
+		t.Errorf("origins = %v, %v, want (0, 1, 0), (0, -1, 0)", top.Origin, bottom.Origin)
+	}
+}
+
+func TestFisheye(t *testing.T) {
+	for _, p := range []Projection{FisheyeEquidistant, FisheyeEquisolid} {
+		c := &Camera{Projection: p, FOV: math.Pi * 1.2}
+
+		// the top edge of the image is at half the field of view
+		ray := c.Ray(50, 0, 101, 100, 0)
+		_, direction, _ := c.lensRay(50, 0, 101, 100, 0, 0.5, 0, 0.5, 0.5)
+		angle := math.Acos(direction.Dot(c.Forward()))
+		if !near(angle, c.FOV/2) {
+			t.Errorf("%v: edge is %v from forward, want %v", p, angle, c.FOV/2)
+		}
+		if ray.Direction.Z < 0 {
+			t.Errorf("%v: edge of a 216° fisheye should look backwards, got %v", p, ray.Direction)
+		}
+
+		if c.Visible(0, 0, 101, 100) || !c.Visible(50, 50, 101, 100) {
+			t.Errorf("%v: corners should be outside the image circle, centre inside", p)
+		}
+	}
+}
+
+func TestEquirectangularMatchesSkybox(t *testing.T) {
+	// rays from an unrotated camera land on the same pixel of a skybox envmap
+	c := &Camera{Projection: Equirectangular}
+	width, height := 64, 32
+	for _, px := range [][2]int{{0, 5}, {17, 16}, {40, 2}, {63, 31}} {
+		d := c.Ray(px[0], px[1], width, height, 0).Direction
+		u := 0.5 + (math.Atan2(d.Z, d.X) / (2 * math.Pi))
+		v := 0.5 - (math.Asin(d.Y) / (math.Pi))
+		if int(u*float64(width)) != px[0] || int(v*float64(height)) != px[1] {
+			t.Errorf("pixel %v looks up skybox pixel (%v, %v)", px, u*float64(width), v*float64(height))
+		}
+	}
+}
+
+func TestStereo(t *testing.T) {
+	for _, p := range []Projection{Perspective, Equirectangular} {
+		c := &Camera{Projection: p, Stereo: SideBySide, FOV: math.Pi / 3, InterpupillaryDistance: 0.1, Yaw: 0.7}
+		left, right := c.Ray(3, 4, 16, 8, 0), c.Ray(11, 4, 16, 8, 0)
+		if !nearVec(left.Direction, right.Direction) {
+			t.Errorf("%v: eyes look in different directions: %v, %v", p, left.Direction, right.Direction)
+		}
+		// eyes are side by side across the camera (for panoramas, across each direction)
+		view := c.Forward()
+		if p == Equirectangular {
+			view = left.Direction
+		}
+		between := right.Origin.Sub(left.Origin)
+		if !near(between.Norm(), 0.1) || !near(between.Dot(view), 0) {
+			t.Errorf("%v: eyes %v apart, want 0.1 across the view", p, between)
+		}
+	}
+
+	c := &Camera{Stereo: TopBottom, FOV: math.Pi / 3}
+	top, bottom := c.Ray(3, 1, 8, 8, 0), c.Ray(3, 5, 8, 8, 0)
+	if !near(bottom.Origin.Sub(top.Origin).X, DefaultInterpupillaryDistance) {
+		t.Errorf("top/bottom eyes at %v, %v", top.Origin, bottom.Origin)
+	}
+}
+
+func TestParseProjection(t *testing.T) {
+	for p := Perspective; p <= Equirectangular; p++ {
+		if got, ok := ParseProjection(p.String()); !ok || got != p {
+			t.Errorf("ParseProjection(%q) = %v, %v", p.String(), got, ok)
+		}
+	}
+	if _, ok := ParseProjection("cylindrical"); ok {
+		t.Errorf("parsed an unknown projection")
+	}
+}
+
+func TestCameraDefocusBlur(t *testing.T) {
+	// rays through a plane well in front of the focal distance should land
+	// spread around where a pinhole camera's would, not all shifted one way
+	const near, radius = 2.0, 0.5
+	coc := radius * (1 - near/10) // circle of confusion on the near plane
+	for _, samples := range []int{1, 4} {
+		c := &Camera{FOV: math.Pi / 3, ApertureRadius: radius, FocalDistance: 10, Samples: samples}
+		pinhole := &Camera{FOV: math.Pi / 3, Samples: samples}
+		at := func(ray Ray) Vector3f {
+			return ray.Origin.Add(ray.Direction.Multiply(near / ray.Direction.Dot(c.Forward())))
+		}
+
+		var sum, sumSq Vector3f
+		count := 0.0
+		for j := 0; j < 16; j++ {
+			for i := 0; i < 16; i++ {
+				for s := 0; s < samples; s++ {
+					d := at(c.Ray(i, j, 16, 16, s)).Sub(at(pinhole.Ray(i, j, 16, 16, s)))
+					sum, sumSq = sum.Add(d), sumSq.Add(d.MultiplyComponents(d))
+					count++
+				}
+			}
+		}
+		mean := sum.Multiply(1 / count)
+		spread := math.Sqrt(math.Max(0, (sumSq.X+sumSq.Y)/count-mean.X*mean.X-mean.Y*mean.Y))
+		if mean.Norm() > coc/8 {
+			t.Errorf("%d samples: rays shifted by %v on average", samples, mean)
+		}
+		// (points spread evenly over a disc have an rms distance from its centre of sqrt(1/2) its radius)
+		if !(spread > coc/2) {
+			t.Errorf("%d samples: rays spread by %v, want about %v", samples, spread, coc*math.Sqrt(0.5))
+		}
+	}
+}
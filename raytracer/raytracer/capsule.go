@@ -0,0 +1,78 @@
+package raytracer
+
+import "math"
+
+// Capsule is the set of points within Radius of the line segment A-B
+// (a cylinder with hemispherical ends)
+type Capsule struct {
+	A, B     Vector3f
+	Radius   float64
+	Material Material
+}
+
+func (c *Capsule) Intersect(ray Ray, tMax float64) (float64, Hit, bool) {
+	origin, direction := ray.Origin, ray.Direction
+	f := newFrame(c.A, c.B.Sub(c.A))
+	o, d := f.toLocal(origin), f.toLocalDir(direction)
+	length := c.B.Sub(c.A).Norm()
+	r := c.Radius
+
+	best := tMax
+	var hit Hit
+	found := false
+
+	try := func(t float64, p, centre Vector3f) {
+		if t <= 1e-9 || t >= best {
+			return
+		}
+		n := p.Sub(centre).Multiply(1 / r)
+		tangent := Vector3f{X: -p.Z, Z: p.X}
+		if tangent.Norm() < 1e-12 {
+			tangent = Vector3f{X: 1} // on the axis, at the tip of an end
+		}
+		tangent = tangent.Normalised()
+		best, found = t, true
+		hit = Hit{
+			Point:     p,
+			Normal:    n,
+			Tangent:   tangent,
+			Bitangent: tangent.Cross(n),
+			U:         0.5 + math.Atan2(p.Z, p.X)/(2*math.Pi),
+			V:         (p.Y + r) / (length + 2*r),
+		}
+	}
+
+	// cylindrical middle, only between the ends
+	roots, n := solveQuadratic(d.X*d.X+d.Z*d.Z, 2*(o.X*d.X+o.Z*d.Z), o.X*o.X+o.Z*o.Z-r*r)
+	for i := 0; i < n; i++ {
+		p := o.Add(d.Multiply(roots[i]))
+		if p.Y >= 0 && p.Y <= length {
+			try(roots[i], p, Vector3f{Y: p.Y})
+		}
+	}
+
+	// hemispheres, only beyond the ends (elsewhere they're inside the cylinder)
+	for _, end := range []float64{0, length} {
+		centre := Vector3f{Y: end}
+		oc := o.Sub(centre)
+		roots, n := solveQuadratic(d.Dot(d), 2*oc.Dot(d), oc.Dot(oc)-r*r)
+		for i := 0; i < n; i++ {
+			p := o.Add(d.Multiply(roots[i]))
+			if (end == 0 && p.Y < 0) || (end == length && p.Y > length) {
+				try(roots[i], p, centre)
+			}
+		}
+	}
+
+	if !found {
+		return 0, Hit{}, false
+	}
+	hit = f.toWorldHit(hit)
+	hit.Material = &c.Material
+	return best, hit, true
+}
+
+func (c *Capsule) Bounds() AABB {
+	r := Vector3f{X: c.Radius, Y: c.Radius, Z: c.Radius}
+	return AABB{Min: c.A.Sub(r), Max: c.A.Add(r)}.Union(AABB{Min: c.B.Sub(r), Max: c.B.Add(r)})
+}
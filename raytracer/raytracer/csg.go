@@ -0,0 +1,130 @@
+package raytracer
+
+import "math"
+
+// CSGOp is how a CSG node combines its two shapes
+type CSGOp int
+
+const (
+	Union        CSGOp = iota // inside either shape
+	Intersection              // inside both shapes
+	Difference                // inside the left shape, but not the right
+)
+
+func (op CSGOp) inside(left, right bool) bool {
+	switch op {
+	case Union:
+		return left || right
+	case Intersection:
+		return left && right
+	default:
+		return left && !right
+	}
+}
+
+// CSG combines two closed shapes (constructive solid geometry), e.g. a lens
+// is the Intersection of two overlapping spheres
+// shapes must have outward-facing normals, which is how entry and exit
+// along the ray are told apart
+type CSG struct {
+	Op          CSGOp
+	Left, Right Shape
+	Material    *Material // overrides the shapes' materials if set
+}
+
+// csgMaxCrossings limits how many times a ray may cross each child's surface
+const csgMaxCrossings = 16
+
+// crossing is a point where a ray passes through a shape's surface
+type crossing struct {
+	t        float64
+	hit      Hit
+	entering bool
+}
+
+// surfaceCrossings finds the crossings of s along the ray (in order), up to
+// and including the first one beyond tMax, and whether the ray started inside s
+func surfaceCrossings(s Shape, ray Ray, tMax float64, out *[csgMaxCrossings]crossing) (n int, startInside bool) {
+	// step just past each hit and look again, so each shape only needs to
+	// find its nearest hit
+	const step = 1e-6
+	offset := 0.0
+	for n < csgMaxCrossings && offset < tMax {
+		// the first crossing is always needed (even beyond tMax) to tell if
+		// the ray started inside
+		t, hit, ok := s.Intersect(Ray{Origin: ray.At(offset), Direction: ray.Direction, Time: ray.Time, stats: ray.stats}, math.MaxFloat64)
+		if !ok {
+			break
+		}
+		t += offset
+		entering := hit.Normal.Dot(ray.Direction) < 0
+		if n == 0 {
+			startInside = !entering
+		}
+		out[n] = crossing{t: t, hit: hit, entering: entering}
+		n++
+		offset = t + step
+	}
+	return n, startInside
+}
+
+func (c *CSG) Intersect(ray Ray, tMax float64) (float64, Hit, bool) {
+	var left, right [csgMaxCrossings]crossing
+	ln, inLeft := surfaceCrossings(c.Left, ray, tMax, &left)
+	rn, inRight := surfaceCrossings(c.Right, ray, tMax, &right)
+
+	// walk both sets of crossings in order, until the combined inside/outside
+	// state changes, which is where the ray crosses the CSG shape's surface
+	inside := c.Op.inside(inLeft, inRight)
+	i, j := 0, 0
+	for i < ln || j < rn {
+		var x crossing
+		fromRight := false
+		if j >= rn || (i < ln && left[i].t <= right[j].t) {
+			x = left[i]
+			inLeft = x.entering
+			i++
+		} else {
+			x = right[j]
+			inRight = x.entering
+			fromRight = true
+			j++
+		}
+
+		if c.Op.inside(inLeft, inRight) == inside {
+			continue
+		}
+
+		if x.t >= tMax {
+			break
+		}
+		hit := x.hit
+		if fromRight && c.Op == Difference {
+			// the carved-out surface faces into the right shape
+			hit.Normal = hit.Normal.Multiply(-1)
+			hit.Bitangent = hit.Bitangent.Multiply(-1)
+		}
+		if c.Material != nil {
+			hit.Material = c.Material
+		}
+		return x.t, hit, true
+	}
+	return 0, Hit{}, false
+}
+
+func (c *CSG) Bounds() AABB {
+	l, r := c.Left.Bounds(), c.Right.Bounds()
+	switch c.Op {
+	case Union:
+		return l.Union(r)
+	case Intersection:
+		b := l.Overlap(r)
+		if b.Min.X > b.Max.X || b.Min.Y > b.Max.Y || b.Min.Z > b.Max.Z {
+			// the shapes don't overlap, so there is nothing to hit
+			return EmptyAABB()
+		}
+		return b
+	default:
+		return l
+	}
+}
@@ -0,0 +1,54 @@
+package raytracer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCSGLens(t *testing.T) {
+	// two unit spheres overlapping by 0.5, making a lens 0.5 thick around z=-5
+	lens := &CSG{
+		Op:    Intersection,
+		Left:  &Sphere{Centre: Vector3f{Z: -5.75}, Radius: 1, Material: Glass},
+		Right: &Sphere{Centre: Vector3f{Z: -4.25}, Radius: 1, Material: Glass},
+	}
+	checkRays(t, lens, []rayCase{
+		{name: "front", direction: Vector3f{Z: -1}, wantT: 4.75, wantNormal: Vector3f{Z: 1}},
+		{name: "inside", origin: Vector3f{Z: -5}, direction: Vector3f{Z: -1}, wantT: 0.25, wantNormal: Vector3f{Z: -1}},
+		{name: "outside the overlap", origin: Vector3f{X: 0.9}, direction: Vector3f{Z: -1}, miss: true},
+	})
+}
+
+func TestCSGDifference(t *testing.T) {
+	// a box with a sphere carved out of its front face
+	bowl := &CSG{
+		Op:    Difference,
+		Left:  &Box{Min: Vector3f{X: -1, Y: -1, Z: -7}, Max: Vector3f{X: 1, Y: 1, Z: -5}},
+		Right: &Sphere{Centre: Vector3f{Z: -5}, Radius: 0.5},
+	}
+	checkRays(t, bowl, []rayCase{
+		// straight into the hollow, hitting the inside of the sphere
+		{name: "hollow", direction: Vector3f{Z: -1}, wantT: 5.5, wantNormal: Vector3f{Z: 1}},
+		{name: "rim", origin: Vector3f{X: 0.75}, direction: Vector3f{Z: -1}, wantT: 5, wantNormal: Vector3f{Z: 1}},
+		{name: "through the side of the hollow", origin: Vector3f{X: -5, Z: -5.25}, direction: Vector3f{X: 1}, wantT: 4, wantNormal: Vector3f{X: -1}},
+	})
+
+	// from inside the hollow, the next surface is the sphere wall
+	_, hit, ok := bowl.Intersect(Ray{Origin: Vector3f{Z: -5.25}, Direction: Vector3f{X: 1}}, math.MaxFloat64)
+	if !ok || !nearVec(hit.Normal, Vector3f{X: -math.Sqrt(0.25 - 0.0625), Z: 0.25}.Multiply(2)) {
+		t.Errorf("inside hollow: hit = %v, %v", ok, hit.Normal)
+	}
+}
+
+func TestCSGUnion(t *testing.T) {
+	// overlapping spheres, the inner surfaces shouldn't be hit
+	u := &CSG{
+		Op:    Union,
+		Left:  &Sphere{Centre: Vector3f{Z: -5}, Radius: 1},
+		Right: &Sphere{Centre: Vector3f{Z: -6}, Radius: 1},
+	}
+	checkRays(t, u, []rayCase{
+		{name: "front", direction: Vector3f{Z: -1}, wantT: 4, wantNormal: Vector3f{Z: 1}},
+		{name: "inside both", origin: Vector3f{Z: -5.5}, direction: Vector3f{Z: -1}, wantT: 1.5, wantNormal: Vector3f{Z: -1}},
+	})
+}
@@ -0,0 +1,165 @@
+package raytracer
+
+import "math"
+
+// Cylinder is a capped cylinder, standing on Base and extending Height along Axis
+type Cylinder struct {
+	Base     Vector3f
+	Axis     Vector3f
+	Radius   float64
+	Height   float64
+	Material Material
+}
+
+func (c *Cylinder) Intersect(ray Ray, tMax float64) (float64, Hit, bool) {
+	origin, direction := ray.Origin, ray.Direction
+	f := newFrame(c.Base, c.Axis)
+	o, d := f.toLocal(origin), f.toLocalDir(direction)
+
+	best := tMax
+	var hit Hit
+	found := false
+
+	// curved side
+	roots, n := solveQuadratic(d.X*d.X+d.Z*d.Z, 2*(o.X*d.X+o.Z*d.Z), o.X*o.X+o.Z*o.Z-c.Radius*c.Radius)
+	for i := 0; i < n; i++ {
+		t := roots[i]
+		p := o.Add(d.Multiply(t))
+		if t > 1e-9 && t < best && p.Y >= 0 && p.Y <= c.Height {
+			best, found = t, true
+			hit = Hit{
+				Point:     p,
+				Normal:    Vector3f{X: p.X / c.Radius, Z: p.Z / c.Radius},
+				Tangent:   Vector3f{X: -p.Z, Z: p.X}.Normalised(),
+				Bitangent: Vector3f{Y: 1},
+				U:         0.5 + math.Atan2(p.Z, p.X)/(2*math.Pi),
+				V:         p.Y / c.Height,
+			}
+		}
+	}
+
+	// end caps
+	if t, h, ok := discIntersect(o, d, 0, c.Radius, -1, best); ok {
+		best, hit, found = t, h, true
+	}
+	if t, h, ok := discIntersect(o, d, c.Height, c.Radius, 1, best); ok {
+		best, hit, found = t, h, true
+	}
+
+	if !found {
+		return 0, Hit{}, false
+	}
+	hit = f.toWorldHit(hit)
+	hit.Material = &c.Material
+	return best, hit, true
+}
+
+func (c *Cylinder) Bounds() AABB {
+	return discBounds(c.Base, c.Axis, c.Radius).Union(discBounds(c.Base.Add(c.Axis.Normalised().Multiply(c.Height)), c.Axis, c.Radius))
+}
+
+// Cone is a capped cone, with a base of Radius on Base, narrowing to a point
+// Height along Axis
+type Cone struct {
+	Base     Vector3f
+	Axis     Vector3f
+	Radius   float64
+	Height   float64
+	Material Material
+}
+
+func (c *Cone) Intersect(ray Ray, tMax float64) (float64, Hit, bool) {
+	origin, direction := ray.Origin, ray.Direction
+	f := newFrame(c.Base, c.Axis)
+	o, d := f.toLocal(origin), f.toLocalDir(direction)
+
+	best := tMax
+	var hit Hit
+	found := false
+
+	// curved side: x^2 + z^2 = (k(h - y))^2, with k the radius per unit height
+	k := c.Radius / c.Height
+	k2 := k * k
+	h := c.Height - o.Y
+	roots, n := solveQuadratic(
+		d.X*d.X+d.Z*d.Z-k2*d.Y*d.Y,
+		2*(o.X*d.X+o.Z*d.Z+k2*h*d.Y),
+		o.X*o.X+o.Z*o.Z-k2*h*h,
+	)
+	for i := 0; i < n; i++ {
+		t := roots[i]
+		p := o.Add(d.Multiply(t))
+		if t > 1e-9 && t < best && p.Y >= 0 && p.Y <= c.Height {
+			best, found = t, true
+
+			normal := Vector3f{X: p.X, Y: k2 * (c.Height - p.Y), Z: p.Z}
+			tangent := Vector3f{X: -p.Z, Z: p.X}
+			if normal.Norm() < 1e-12 || tangent.Norm() < 1e-12 {
+				// at the apex
+				normal, tangent = Vector3f{Y: 1}, Vector3f{X: 1}
+			}
+			normal = normal.Normalised()
+			tangent = tangent.Normalised()
+			hit = Hit{
+				Point:     p,
+				Normal:    normal,
+				Tangent:   tangent,
+				Bitangent: tangent.Cross(normal),
+				U:         0.5 + math.Atan2(p.Z, p.X)/(2*math.Pi),
+				V:         p.Y / c.Height,
+			}
+		}
+	}
+
+	// base cap
+	if t, h, ok := discIntersect(o, d, 0, c.Radius, -1, best); ok {
+		best, hit, found = t, h, true
+	}
+
+	if !found {
+		return 0, Hit{}, false
+	}
+	hit = f.toWorldHit(hit)
+	hit.Material = &c.Material
+	return best, hit, true
+}
+
+func (c *Cone) Bounds() AABB {
+	return discBounds(c.Base, c.Axis, c.Radius).Extend(c.Base.Add(c.Axis.Normalised().Multiply(c.Height)))
+}
+
+// discIntersect intersects a local-space ray with the disc of radius r at
+// height y, facing ny (+1 up, -1 down) along the local y-axis
+func discIntersect(o, d Vector3f, y, r, ny float64, tMax float64) (float64, Hit, bool) {
+	if math.Abs(d.Y) < 1e-12 {
+		return 0, Hit{}, false
+	}
+	t := (y - o.Y) / d.Y
+	if t <= 1e-9 || t >= tMax {
+		return 0, Hit{}, false
+	}
+	p := o.Add(d.Multiply(t))
+	if p.X*p.X+p.Z*p.Z > r*r {
+		return 0, Hit{}, false
+	}
+	return t, Hit{
+		Point:     p,
+		Normal:    Vector3f{Y: ny},
+		Tangent:   Vector3f{X: 1},
+		Bitangent: Vector3f{Z: ny},
+		U:         0.5 + p.X/(2*r),
+		V:         0.5 + p.Z/(2*r),
+	}, true
+}
+
+// discBounds returns a box containing the disc of radius r centred on c, facing axis
+func discBounds(c, axis Vector3f, r float64) AABB {
+	a := axis.Normalised()
+	// extent along each world axis is r * sin(angle between that axis and the disc's normal)
+	e := Vector3f{
+		X: r * math.Sqrt(math.Max(0, 1-a.X*a.X)),
+		Y: r * math.Sqrt(math.Max(0, 1-a.Y*a.Y)),
+		Z: r * math.Sqrt(math.Max(0, 1-a.Z*a.Z)),
+	}
+	return AABB{Min: c.Sub(e), Max: c.Add(e)}
+}
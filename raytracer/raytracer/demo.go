@@ -0,0 +1,98 @@
+package raytracer
+
+import (
+	"image"
+	"math"
+)
+
+// DemoScene is the viewer's default scene: three spheres and a moving glass
+// sphere over a mirror floor, lit by three lights
+// (the glass sphere is shapes[0], blurring while the camera's shutter is open)
+func DemoScene(envmap *image.NRGBA, camera *Camera) *Scene {
+	spheres := []*Sphere{
+		{
+			Centre:   Vector3f{X: -3.0, Y: 0.0, Z: -16.0},
+			Radius:   2.0,
+			Material: Ivory,
+		},
+		{
+			Centre:   Vector3f{X: 1.5, Y: -0.5, Z: -18.0},
+			Radius:   3.0,
+			Material: RedRubber,
+		},
+		{
+			Centre:   Vector3f{X: 7.0, Y: 5.0, Z: -18.0},
+			Radius:   5.0,
+			Material: Mirror,
+		},
+	}
+
+	lights := []*Light{
+		{
+			Position:  Vector3f{X: -20.0, Y: 20.0, Z: 20.0},
+			Intensity: 1.5,
+		},
+		{
+			Position:  Vector3f{X: 30.0, Y: 50.0, Z: -25.0},
+			Intensity: 1.8,
+		},
+		{
+			Position:  Vector3f{X: 30.0, Y: 20.0, Z: 30.0},
+			Intensity: 1.7,
+		},
+	}
+
+	glass := &Moving{
+		Shape: &Sphere{
+			Centre:   demoGlassCentre(5),
+			Radius:   2.0,
+			Material: Glass,
+		},
+		Motion:       LinearMotion{},
+		ShutterOpen:  camera.ShutterOpen,
+		ShutterClose: camera.ShutterClose,
+	}
+
+	// mirror floor, y=-3.5
+	// (a checkerboard could use a CheckerPattern texture instead)
+	floor := &Box{
+		Min:      Vector3f{X: -10, Y: -3.5 - 1.0/1000, Z: -30},
+		Max:      Vector3f{X: 10, Y: -3.5, Z: -10},
+		Material: Mirror,
+	}
+
+	return &Scene{
+		EnvMap:  envmap,
+		Lights:  lights,
+		Spheres: spheres,
+		Shapes:  []Shape{glass, floor},
+	}
+}
+
+// demoGlassCentre is where the glass sphere is at point i along its path
+func demoGlassCentre(i float64) Vector3f {
+	return Vector3f{X: -5.0 + i, Y: -1.5 + (i / 3), Z: -12.0 + (i / 2)}
+}
+
+// DemoTimeline swings the demo scene's glass sphere back and forth along its
+// path, once every 100π frames (about ten seconds at 30fps)
+func DemoTimeline() *Timeline {
+	// bezier handles giving the swing's full speed through the middle of its path
+	// (8 * 0.02 per frame, for a third of the quarter-period segment)
+	speed := 8 * 0.02 * (25 * math.Pi) / 3
+	handle := demoGlassCentre(speed).Sub(demoGlassCentre(0))
+
+	return &Timeline{
+		Tracks: []*Track{
+			{
+				Target: "shapes[0].centre",
+				Keys: []Key{
+					{Frame: 0, Value: demoGlassCentre(5), Interpolation: BezierInterpolation, Out: handle},
+					{Frame: 25 * math.Pi, Value: demoGlassCentre(13), Interpolation: BezierInterpolation},
+					{Frame: 75 * math.Pi, Value: demoGlassCentre(-3), Interpolation: BezierInterpolation},
+					{Frame: 100 * math.Pi, Value: demoGlassCentre(5), In: handle.Multiply(-1)},
+				},
+			},
+		},
+	}
+}
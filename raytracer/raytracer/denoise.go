@@ -0,0 +1,125 @@
+package raytracer
+
+import (
+	"math"
+	"sync"
+)
+
+// DenoiseAOVs are the AOVs Denoise uses to find edges (to render alongside
+// the colour)
+var DenoiseAOVs = []AOV{AOVNormal, AOVAlbedo, AOVDepth}
+
+// denoiseIterations is the number of à-trous passes, each doubling the
+// filter's reach (so 5 reach 62 pixels either way)
+const denoiseIterations = 5
+
+// edge-stopping falloffs for the guide AOVs
+const (
+	denoiseNormalPower  = 64  // how quickly weights fall as normals diverge
+	denoiseAlbedoSigma  = 0.1 // albedo difference tolerated
+	denoiseDepthSigma   = 8   // depth difference tolerated, relative to the depth per pixel of distance
+	denoiseMinimumDepth = 1e-6
+)
+
+// Denoise returns a smoothed copy of passes' colour, using an edge-avoiding
+// à-trous wavelet filter: noise is blurred away, but not across changes in
+// the normal, albedo or depth AOVs (any of DenoiseAOVs that were rendered)
+// strength is how big a difference in colour is treated as noise (0 for none,
+// 1 to blur across anything but the guides' edges)
+func Denoise(passes *Passes, strength float64) *FloatImage {
+	src := passes.Colour
+	out := NewFloatImage(src.Width, src.Height)
+	copy(out.Pix, src.Pix)
+	if strength <= 0 {
+		return out
+	}
+
+	normal, albedo, depth := passes.AOVs[AOVNormal], passes.AOVs[AOVAlbedo], passes.AOVs[AOVDepth]
+	tmp := NewFloatImage(src.Width, src.Height)
+	sigma := strength
+	for i := 0; i < denoiseIterations; i++ {
+		atrous(tmp, out, normal, albedo, depth, 1<<i, sigma)
+		out, tmp = tmp, out
+		// finer details survive later (wider) passes
+		sigma /= 2
+	}
+	return out
+}
+
+// atrousKernel is the 1D B3 spline kernel, used separably as 5x5 weights
+var atrousKernel = [5]float64{1.0 / 16, 1.0 / 4, 3.0 / 8, 1.0 / 4, 1.0 / 16}
+
+// atrous applies one à-trous pass, with taps step pixels apart, from src to dst
+func atrous(dst, src, normal, albedo, depth *FloatImage, step int, sigma float64) {
+	var wg sync.WaitGroup
+	for y := 0; y < src.Height; y++ {
+		wg.Add(1)
+		go func(y int) {
+			defer wg.Done()
+			for x := 0; x < src.Width; x++ {
+				dst.Set(x, y, atrousPixel(src, normal, albedo, depth, x, y, step, sigma))
+			}
+		}(y)
+	}
+	wg.Wait()
+}
+
+func atrousPixel(src, normal, albedo, depth *FloatImage, x, y, step int, sigma float64) Vector3f {
+	c := src.At(x, y)
+	var n, a Vector3f
+	var z float64
+	if normal != nil {
+		n = normal.At(x, y)
+	}
+	if albedo != nil {
+		a = albedo.At(x, y)
+	}
+	if depth != nil {
+		z = depth.At(x, y).X
+	}
+
+	var sum Vector3f
+	total := 0.0
+	for ky := -2; ky <= 2; ky++ {
+		qy := y + ky*step
+		if qy < 0 || qy >= src.Height {
+			continue
+		}
+		for kx := -2; kx <= 2; kx++ {
+			qx := x + kx*step
+			if qx < 0 || qx >= src.Width {
+				continue
+			}
+			q := src.At(qx, qy)
+
+			// colour: differences bigger than sigma are probably detail, not noise
+			d := q.Sub(c)
+			w := atrousKernel[kx+2] * atrousKernel[ky+2] * math.Exp(-d.Dot(d)/(sigma*sigma))
+
+			if normal != nil {
+				// (where nothing was hit there's no normal, which only matches itself)
+				nq := normal.At(qx, qy)
+				if n != (Vector3f{}) || nq != (Vector3f{}) {
+					w *= math.Pow(math.Max(0, n.Dot(nq)), denoiseNormalPower)
+				}
+			}
+			if albedo != nil {
+				da := albedo.At(qx, qy).Sub(a)
+				w *= math.Exp(-da.Dot(da) / (denoiseAlbedoSigma * denoiseAlbedoSigma))
+			}
+			if depth != nil {
+				// (compared relative to how far away the surface is, and how far apart the pixels are)
+				dz := math.Abs(depth.At(qx, qy).X - z)
+				scale := denoiseDepthSigma * math.Max(z, denoiseMinimumDepth) * math.Hypot(float64(kx*step), float64(ky*step)) / float64(src.Height)
+				w *= math.Exp(-dz / math.Max(scale, denoiseMinimumDepth))
+			}
+
+			sum = sum.Add(q.Multiply(w))
+			total += w
+		}
+	}
+	if total == 0 {
+		return c
+	}
+	return sum.Multiply(1 / total)
+}
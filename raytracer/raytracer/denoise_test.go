@@ -0,0 +1,69 @@
+package raytracer
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// noisyPasses is a 32x32 image split down the middle into two flat
+// surfaces (facing different ways), with noise added to the colour
+func noisyPasses() (*Passes, Vector3f, Vector3f) {
+	left, right := Vector3f{X: 0.2, Y: 0.4, Z: 0.6}, Vector3f{X: 0.8, Y: 0.6, Z: 0.2}
+	passes := NewPasses(32, 32, DenoiseAOVs...)
+	r := rand.New(rand.NewSource(1))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			c, n := left, Vector3f{Z: 1}
+			if x >= 16 {
+				c, n = right, Vector3f{X: 1}
+			}
+			noise := Vector3f{X: r.NormFloat64(), Y: r.NormFloat64(), Z: r.NormFloat64()}.Multiply(0.1)
+			passes.Colour.Set(x, y, c.Add(noise))
+			passes.AOVs[AOVNormal].Set(x, y, n)
+			passes.AOVs[AOVAlbedo].Set(x, y, c)
+			passes.AOVs[AOVDepth].Set(x, y, Vector3f{X: 10, Y: 10, Z: 10})
+		}
+	}
+	return passes, left, right
+}
+
+// rmsError returns the root mean square difference from want over columns [x0, x1)
+func rmsError(img *FloatImage, want Vector3f, x0, x1 int) float64 {
+	sum, n := 0.0, 0
+	for y := 0; y < img.Height; y++ {
+		for x := x0; x < x1; x++ {
+			d := img.At(x, y).Sub(want)
+			sum += d.Dot(d)
+			n++
+		}
+	}
+	return math.Sqrt(sum / float64(n))
+}
+
+func TestDenoise(t *testing.T) {
+	passes, left, right := noisyPasses()
+	before := rmsError(passes.Colour, left, 0, 16)
+
+	denoised := Denoise(passes, 1)
+	if after := rmsError(denoised, left, 0, 16); after > before/3 {
+		t.Errorf("noise %v after denoising, was %v", after, before)
+	}
+	// the edge between the surfaces stays sharp
+	if err := rmsError(denoised, left, 15, 16); err > 0.1 {
+		t.Errorf("left of the edge is %v from its colour", err)
+	}
+	if err := rmsError(denoised, right, 16, 17); err > 0.1 {
+		t.Errorf("right of the edge is %v from its colour", err)
+	}
+}
+
+func TestDenoiseOff(t *testing.T) {
+	passes, _, _ := noisyPasses()
+	denoised := Denoise(passes, 0)
+	for i := range denoised.Pix {
+		if denoised.Pix[i] != passes.Colour.Pix[i] {
+			t.Fatalf("pixel %d changed with zero strength", i)
+		}
+	}
+}
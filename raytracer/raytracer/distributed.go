@@ -0,0 +1,228 @@
+package raytracer
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"image"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+)
+
+// distributed rendering: a Coordinator splits each frame into tiles and hands
+// them out to Workers (other processes, or other machines sharing the scene's
+// files) over rpc, assembling the tiles as they come back. a worker that fails
+// or takes too long is dropped, and its tile given to another
+
+// TileRequest asks a worker to render one tile of a frame
+type TileRequest struct {
+	Scene         []byte          // the scene file (json)
+	Dir           string          // directory the scene file's paths are relative to, on the worker
+	Frame         float64         // frame of the scene's timeline
+	Width, Height int             // size of the whole frame
+	Tile          image.Rectangle // the part of the frame to render
+}
+
+// TileResponse is a rendered tile
+type TileResponse struct {
+	Tile image.Rectangle
+	Pix  []uint8 // NRGBA, with a stride of 4*Tile.Dx()
+}
+
+// Worker renders tiles, as the rpc service "Worker"
+type Worker struct {
+	mu sync.Mutex
+
+	// the last scene file rendered, and the last frame of it (consecutive
+	// tiles are almost always from the same frame)
+	key    [sha256.Size]byte
+	file   *SceneFile
+	envmap *image.NRGBA
+	frame  float64
+	scene  *Scene
+	camera *Camera
+}
+
+// ServeWorker serves a Worker to each connection accepted on l, until l is closed
+func ServeWorker(l net.Listener) error {
+	server := rpc.NewServer()
+	if err := server.RegisterName("Worker", &Worker{}); err != nil {
+		return err
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go server.ServeConn(conn)
+	}
+}
+
+// RenderTile renders req's tile
+func (w *Worker) RenderTile(req TileRequest, resp *TileResponse) error {
+	tile := req.Tile.Intersect(image.Rect(0, 0, req.Width, req.Height))
+	if tile.Empty() {
+		return fmt.Errorf("tile %v is outside the %dx%d frame", req.Tile, req.Width, req.Height)
+	}
+	scene, camera, err := w.load(req)
+	if err != nil {
+		return err
+	}
+
+	img := image.NewNRGBA(tile)
+	RenderPasses(img, req.Width, req.Height, camera, scene, nil)
+	resp.Tile = tile
+	resp.Pix = img.Pix
+	return nil
+}
+
+// load returns the scene for req, and a copy of its camera (which rendering changes)
+func (w *Worker) load(req TileRequest) (*Scene, *Camera, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	key := sha256.Sum256(append([]byte(req.Dir+"\x00"), req.Scene...))
+	if w.file == nil || key != w.key {
+		file, err := ParseSceneFile(req.Scene)
+		if err != nil {
+			return nil, nil, err
+		}
+		envmap, err := LoadImage(file.EnvMapPath(req.Dir))
+		if err != nil {
+			return nil, nil, err
+		}
+		w.key, w.file, w.envmap, w.scene = key, file, envmap, nil
+	}
+	if w.scene == nil || req.Frame != w.frame {
+		scene, camera, err := w.file.Build(w.envmap, req.Frame)
+		if err != nil {
+			return nil, nil, err
+		}
+		w.frame, w.scene, w.camera = req.Frame, scene, camera
+	}
+	camera := *w.camera
+	return w.scene, &camera, nil
+}
+
+// Coordinator renders frames on a set of workers
+type Coordinator struct {
+	Workers  []string      // addresses of the workers (host:port)
+	TileSize int           // width and height of the tiles (32 if 0)
+	Timeout  time.Duration // how long a worker has to render a tile, before it's given up on (a minute if 0)
+
+	Logf func(format string, args ...interface{}) // reports workers failing (if not nil)
+}
+
+func (c *Coordinator) logf(format string, args ...interface{}) {
+	if c.Logf != nil {
+		c.Logf(format, args...)
+	}
+}
+
+// RenderFrame renders a frame of a scene file (whose paths are relative to
+// dir, on the workers) across the workers. the workers are connected to
+// afresh for each frame, so a worker that failed during one frame is given
+// another chance at the next
+func (c *Coordinator) RenderFrame(scene []byte, dir string, frame float64, width, height int) (*image.NRGBA, error) {
+	if len(c.Workers) == 0 {
+		return nil, errors.New("no workers")
+	}
+	size := c.TileSize
+	if size <= 0 {
+		size = 32
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+
+	// the queue holds every tile, so a failed tile can always be put back
+	var tiles []image.Rectangle
+	for y := 0; y < height; y += size {
+		for x := 0; x < width; x += size {
+			tiles = append(tiles, image.Rect(x, y, x+size, y+size).Intersect(image.Rect(0, 0, width, height)))
+		}
+	}
+	queue := make(chan image.Rectangle, len(tiles))
+	for _, tile := range tiles {
+		queue <- tile
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	var mu sync.Mutex
+	remaining := len(tiles)
+	done := make(chan empty)
+
+	var wg sync.WaitGroup
+	for _, addr := range c.Workers {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			conn, err := net.DialTimeout("tcp", addr, timeout)
+			if err != nil {
+				c.logf("worker %v: %v", addr, err)
+				return
+			}
+			client := rpc.NewClient(conn)
+			defer client.Close()
+
+			for {
+				var tile image.Rectangle
+				select {
+				case <-done:
+					return
+				case tile = <-queue:
+				}
+
+				req := TileRequest{Scene: scene, Dir: dir, Frame: frame, Width: width, Height: height, Tile: tile}
+				resp, err := renderTile(client, req, timeout)
+				if err != nil {
+					queue <- tile
+					c.logf("worker %v: %v (giving tile %v to another worker)", addr, err, tile)
+					return
+				}
+
+				mu.Lock()
+				dst := img.SubImage(tile).(*image.NRGBA)
+				for y := 0; y < tile.Dy(); y++ {
+					copy(dst.Pix[y*dst.Stride:], resp.Pix[y*4*tile.Dx():(y+1)*4*tile.Dx()])
+				}
+				remaining--
+				if remaining == 0 {
+					close(done)
+				}
+				mu.Unlock()
+			}
+		}(addr)
+	}
+
+	// each worker carries on until every tile is done, or it fails
+	wg.Wait()
+	if remaining > 0 {
+		return nil, fmt.Errorf("every worker failed, with %d of %d tiles left", remaining, len(tiles))
+	}
+	return img, nil
+}
+
+// renderTile asks a worker for a tile, giving up after timeout
+func renderTile(client *rpc.Client, req TileRequest, timeout time.Duration) (*TileResponse, error) {
+	var resp TileResponse
+	call := client.Go("Worker.RenderTile", req, &resp, make(chan *rpc.Call, 1))
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-call.Done:
+		if call.Error != nil {
+			return nil, call.Error
+		}
+	case <-timer.C:
+		return nil, fmt.Errorf("timed out after %v", timeout)
+	}
+	if resp.Tile != req.Tile || len(resp.Pix) != 4*req.Tile.Dx()*req.Tile.Dy() {
+		return nil, fmt.Errorf("asked for tile %v, got %v (%d bytes)", req.Tile, resp.Tile, len(resp.Pix))
+	}
+	return &resp, nil
+}
@@ -0,0 +1,184 @@
+package raytracer
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// the example scene, with a small envmap (so the tests don't depend on files/)
+func testSceneFile(t *testing.T) ([]byte, string) {
+	t.Helper()
+	data, err := os.ReadFile("../files/scene.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	savePNG(t, filepath.Join(dir, "envmap-coast.jpg"), gradientEnvMap()) // (decoded by content, not name)
+	return data, dir
+}
+
+func TestSceneFile(t *testing.T) {
+	data, dir := testSceneFile(t)
+	file, err := ParseSceneFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envmap, err := LoadImage(file.EnvMapPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scene, camera, err := file.Build(envmap, 45)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scene.Spheres) != 4 || len(scene.Lights) != 3 || len(scene.Shapes) != 1 {
+		t.Errorf("%d spheres, %d lights, %d shapes, want 4, 3 and 1", len(scene.Spheres), len(scene.Lights), len(scene.Shapes))
+	}
+	if got := scene.Spheres[0].Material.DiffuseColour; got != FloatToRGB(0.8, 0.6, 0.2) {
+		t.Errorf("gold diffuse = %v", got)
+	}
+	if scene.Spheres[3].Material != Glass {
+		t.Errorf("spheres[3] isn't glass")
+	}
+	if got, want := scene.Spheres[3].Centre, (Vector3f{X: 3, Y: 1, Z: -8}); !nearVec(got, want) {
+		t.Errorf("glass at frame 45 = %v, want %v", got, want)
+	}
+	if !near(camera.FocalDistance, 16) || !near(camera.FOV, math.Pi/3) {
+		t.Errorf("camera focus, fov = %v, %v", camera.FocalDistance, camera.FOV)
+	}
+	if end := file.End(); end != 90 {
+		t.Errorf("End() = %v, want 90", end)
+	}
+
+	for _, bad := range []struct{ json, want string }{
+		{`{"spheres": [{"radius": 1, "material": "gold"}]}`, `unknown material "gold"`},
+		{`{"sphere": []}`, `unknown field "sphere"`},
+		{`{"camera": {"projection": "fisheye"}}`, `unknown projection "fisheye"`},
+		{`{"timeline": [{"target": "camera.fov", "keys": [{"interpolation": "cubic"}]}]}`, `unknown interpolation "cubic"`},
+	} {
+		file, err := ParseSceneFile([]byte(bad.json))
+		if err == nil {
+			_, _, err = file.Build(envmap, 0)
+		}
+		if err == nil || !strings.Contains(err.Error(), bad.want) {
+			t.Errorf("%s: error %v, want %q", bad.json, err, bad.want)
+		}
+	}
+}
+
+// startWorker serves a worker on localhost, until the test ends
+func startWorker(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go ServeWorker(l)
+	return l.Addr().String()
+}
+
+// startBrokenWorker accepts connections, reads a little of the first request
+// and then hangs up (or, if hang, never replies)
+func startBrokenWorker(t *testing.T, hang bool, accepted *int32) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var hung []net.Conn
+	t.Cleanup(func() {
+		l.Close()
+		mu.Lock()
+		for _, conn := range hung {
+			conn.Close()
+		}
+		mu.Unlock()
+	})
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(accepted, 1)
+			conn.Read(make([]byte, 16))
+			if hang {
+				mu.Lock()
+				hung = append(hung, conn)
+				mu.Unlock()
+				continue
+			}
+			conn.Close()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestDistributedRender(t *testing.T) {
+	data, dir := testSceneFile(t)
+	const width, height, frame = 80, 60, 30
+
+	file, err := ParseSceneFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envmap, err := LoadImage(file.EnvMapPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scene, camera, err := file.Build(envmap, frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := image.NewNRGBA(image.Rect(0, 0, width, height))
+	Render(want, width, height, camera, scene)
+
+	// an address nothing is listening on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := l.Addr().String()
+	l.Close()
+
+	var dropped, hung int32
+	coordinator := &Coordinator{
+		Workers: []string{
+			startWorker(t),
+			startBrokenWorker(t, false, &dropped),
+			closed,
+			startWorker(t),
+			startBrokenWorker(t, true, &hung),
+		},
+		TileSize: 16,
+		Timeout:  2 * time.Second,
+		Logf:     t.Logf,
+	}
+	got, err := coordinator.RenderFrame(data, dir, frame, width, height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Pix, want.Pix) {
+		t.Errorf("distributed render differs from a local render")
+	}
+	if d, h := atomic.LoadInt32(&dropped), atomic.LoadInt32(&hung); d == 0 || h == 0 {
+		t.Errorf("the broken workers weren't given tiles (%d, %d connections)", d, h)
+	}
+
+	// with no working workers, the frame fails rather than hanging
+	coordinator.Workers = []string{closed, startBrokenWorker(t, false, &dropped)}
+	if _, err := coordinator.RenderFrame(data, dir, frame, width, height); err == nil {
+		t.Errorf("rendering with only broken workers succeeded")
+	}
+}
@@ -0,0 +1,224 @@
+package raytracer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// EXRLayer is an image written to some of an EXR file's channels
+type EXRLayer struct {
+	Name     string   // prefix of the layer's channel names ("name.R"), "" for the main image
+	Channels []string // names for the image's X, Y and Z (or fewer, e.g. just "Z" for depth)
+	Image    *FloatImage
+	Float    bool // 32 bit floats, rather than halves (for values halves can't hold exactly, like ids)
+}
+
+// PassesEXRLayers returns the layers for writing passes to an EXR file: the
+// colour as the main RGB image, depth as its Z, and each other AOV as a layer
+// (lighting and albedo as RGB, normals as XYZ, and the rest as single channels)
+func PassesEXRLayers(passes *Passes) []EXRLayer {
+	var layers []EXRLayer
+	if passes.Colour != nil {
+		layers = append(layers, EXRLayer{Channels: []string{"R", "G", "B"}, Image: passes.Colour})
+	}
+	for aov, img := range passes.AOVs {
+		layer := EXRLayer{Name: aov.String(), Channels: []string{"R", "G", "B"}, Image: img}
+		switch aov {
+		case AOVDepth:
+			layer.Name, layer.Channels, layer.Float = "", []string{"Z"}, true
+		case AOVNormal:
+			layer.Channels = []string{"X", "Y", "Z"}
+		case AOVObjectID, AOVMaterialID, AOVSamples:
+			layer.Channels, layer.Float = []string{"Y"}, true
+		case AOVShadow:
+			layer.Channels = []string{"Y"}
+		}
+		layers = append(layers, layer)
+	}
+	return layers
+}
+
+// exrChannel is one channel of an EXR file, the component of a layer's image
+type exrChannel struct {
+	name      string
+	image     *FloatImage
+	component int
+	float     bool
+}
+
+const (
+	exrHalf  = 1
+	exrFloat = 2
+)
+
+// EncodeEXR writes layers (all the same size) as an uncompressed scanline
+// OpenEXR image, with halves (or floats, for all channels if full is set)
+func EncodeEXR(w io.Writer, layers []EXRLayer, full bool) error {
+	if len(layers) == 0 {
+		return fmt.Errorf("no layers")
+	}
+	width, height := layers[0].Image.Width, layers[0].Image.Height
+
+	var channels []exrChannel
+	for _, layer := range layers {
+		if layer.Image.Width != width || layer.Image.Height != height {
+			return fmt.Errorf("layer %q is a different size", layer.Name)
+		}
+		for i, name := range layer.Channels {
+			if i > 2 {
+				return fmt.Errorf("layer %q has more than 3 channels", layer.Name)
+			}
+			if layer.Name != "" {
+				name = layer.Name + "." + name
+			}
+			channels = append(channels, exrChannel{name: name, image: layer.Image, component: i, float: full || layer.Float})
+		}
+	}
+	// channels are stored in alphabetical order
+	sort.Slice(channels, func(i, j int) bool { return channels[i].name < channels[j].name })
+	for i, c := range channels {
+		if i > 0 && c.name == channels[i-1].name {
+			return fmt.Errorf("duplicate channel %q", c.name)
+		}
+		if len(c.name) > 31 {
+			return fmt.Errorf("channel name %q is too long", c.name)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	e := &exrWriter{w: bw}
+
+	e.write([]byte{0x76, 0x2f, 0x31, 0x01}) // magic
+	e.write([]byte{2, 0, 0, 0})             // version 2, single part scanline
+
+	// header
+	var chlist []byte
+	lineSize := 0
+	for _, c := range channels {
+		pixelType, size := exrHalf, 2
+		if c.float {
+			pixelType, size = exrFloat, 4
+		}
+		lineSize += size * width
+		chlist = append(chlist, c.name...)
+		chlist = append(chlist, 0)
+		chlist = binary.LittleEndian.AppendUint32(chlist, uint32(pixelType))
+		chlist = append(chlist, 0, 0, 0, 0)                  // pLinear, reserved
+		chlist = binary.LittleEndian.AppendUint32(chlist, 1) // x sampling
+		chlist = binary.LittleEndian.AppendUint32(chlist, 1) // y sampling
+	}
+	chlist = append(chlist, 0)
+
+	box := binary.LittleEndian.AppendUint32(nil, 0)
+	box = binary.LittleEndian.AppendUint32(box, 0)
+	box = binary.LittleEndian.AppendUint32(box, uint32(width-1))
+	box = binary.LittleEndian.AppendUint32(box, uint32(height-1))
+
+	e.attribute("channels", "chlist", chlist)
+	e.attribute("compression", "compression", []byte{0}) // none
+	e.attribute("dataWindow", "box2i", box)
+	e.attribute("displayWindow", "box2i", box)
+	e.attribute("lineOrder", "lineOrder", []byte{0}) // increasing y
+	e.attribute("pixelAspectRatio", "float", binary.LittleEndian.AppendUint32(nil, math.Float32bits(1)))
+	e.attribute("screenWindowCenter", "v2f", make([]byte, 8))
+	e.attribute("screenWindowWidth", "float", binary.LittleEndian.AppendUint32(nil, math.Float32bits(1)))
+	e.write([]byte{0})
+
+	// offsets of each scanline, which follow the table
+	offset := uint64(e.n + 8*height)
+	for y := 0; y < height; y++ {
+		e.write(binary.LittleEndian.AppendUint64(nil, offset))
+		offset += uint64(8 + lineSize)
+	}
+
+	// scanlines: y, size, then each channel's values across the line
+	line := make([]byte, 0, 8+lineSize)
+	for y := 0; y < height; y++ {
+		line = binary.LittleEndian.AppendUint32(line[:0], uint32(y))
+		line = binary.LittleEndian.AppendUint32(line, uint32(lineSize))
+		for _, c := range channels {
+			for x := 0; x < width; x++ {
+				v := float32(axis(c.image.At(x, y), c.component))
+				if c.float {
+					line = binary.LittleEndian.AppendUint32(line, math.Float32bits(v))
+				} else {
+					line = binary.LittleEndian.AppendUint16(line, floatToHalf(v))
+				}
+			}
+		}
+		e.write(line)
+	}
+
+	if e.err != nil {
+		return e.err
+	}
+	return bw.Flush()
+}
+
+// exrWriter counts what's been written, and keeps the first error
+type exrWriter struct {
+	w   io.Writer
+	n   int
+	err error
+}
+
+func (e *exrWriter) write(b []byte) {
+	if e.err != nil {
+		return
+	}
+	n, err := e.w.Write(b)
+	e.n += n
+	e.err = err
+}
+
+func (e *exrWriter) attribute(name, kind string, value []byte) {
+	e.write(append([]byte(name), 0))
+	e.write(append([]byte(kind), 0))
+	e.write(binary.LittleEndian.AppendUint32(nil, uint32(len(value))))
+	e.write(value)
+}
+
+// floatToHalf converts f to a 16 bit float, rounding to the nearest (even)
+// half, with anything too big becoming infinity
+func floatToHalf(f float32) uint16 {
+	b := math.Float32bits(f)
+	sign := uint16(b>>16) & 0x8000
+	exp := int(b>>23&0xff) - 127 + 15
+	mant := b & 0x7fffff
+
+	switch {
+	case b>>23&0xff == 0xff:
+		// infinity, or nan (kept a nan)
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	case exp >= 0x1f:
+		return sign | 0x7c00
+	case exp <= 0:
+		// subnormal, or too small to be anything but zero
+		if exp < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint(14 - exp)
+		h := mant >> shift
+		rem, half := mant&(1<<shift-1), uint32(1)<<(shift-1)
+		if rem > half || (rem == half && h&1 == 1) {
+			h++
+		}
+		return sign | uint16(h)
+	}
+
+	// (rounding up can carry into the exponent, which is still right)
+	h := uint32(exp)<<10 | mant>>13
+	rem := mant & 0x1fff
+	if rem > 0x1000 || (rem == 0x1000 && h&1 == 1) {
+		h++
+	}
+	return sign | uint16(h)
+}
@@ -0,0 +1,200 @@
+package raytracer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+)
+
+// halfToFloat is the inverse of floatToHalf
+func halfToFloat(h uint16) float32 {
+	sign := float32(1)
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h>>10) & 0x1f
+	mant := float32(h & 0x3ff)
+	switch exp {
+	case 0:
+		return sign * mant * float32(math.Pow(2, -24))
+	case 0x1f:
+		if mant != 0 {
+			return float32(math.NaN())
+		}
+		return sign * float32(math.Inf(1))
+	}
+	return sign * (1 + mant/1024) * float32(math.Pow(2, float64(exp-15)))
+}
+
+func TestFloatToHalf(t *testing.T) {
+	for _, f := range []float32{0, 1, -1, 0.5, 2.75, 65504, 1.0 / 1024, 6.1035156e-05, 5.9604645e-08, -0.333251953125} {
+		if got := halfToFloat(floatToHalf(f)); got != f {
+			t.Errorf("%v round trips to %v", f, got)
+		}
+	}
+	// rounding to the nearest half
+	if got := halfToFloat(floatToHalf(1 + 1.0/3000)); got != 1 {
+		t.Errorf("1+1/3000 rounds to %v, want 1", got)
+	}
+	if got := halfToFloat(floatToHalf(0.1)); math.Abs(float64(got)-0.1) > 0.0001 {
+		t.Errorf("0.1 rounds to %v", got)
+	}
+	if got := halfToFloat(floatToHalf(1e6)); !math.IsInf(float64(got), 1) {
+		t.Errorf("1e6 becomes %v, want +inf", got)
+	}
+	if got := halfToFloat(floatToHalf(1e-10)); got != 0 {
+		t.Errorf("1e-10 becomes %v, want 0", got)
+	}
+}
+
+// exrFile is what readEXR understood of a file
+type exrFile struct {
+	channels   []string
+	pixelTypes []uint32
+	width      int
+	height     int
+	values     map[string][]float32 // per channel, row by row
+}
+
+// readEXR reads an uncompressed single part scanline EXR
+func readEXR(t *testing.T, b []byte) *exrFile {
+	t.Helper()
+	if !bytes.HasPrefix(b, []byte{0x76, 0x2f, 0x31, 0x01, 2, 0, 0, 0}) {
+		t.Fatalf("bad magic/version % x", b[:8])
+	}
+	f := &exrFile{values: make(map[string][]float32)}
+	p := 8
+	str := func() string {
+		end := bytes.IndexByte(b[p:], 0)
+		s := string(b[p : p+end])
+		p += end + 1
+		return s
+	}
+	for {
+		name := str()
+		if name == "" {
+			break
+		}
+		kind := str()
+		size := int(binary.LittleEndian.Uint32(b[p:]))
+		p += 4
+		value := b[p : p+size]
+		p += size
+		switch name {
+		case "channels":
+			if kind != "chlist" {
+				t.Fatalf("channels attribute is a %s", kind)
+			}
+			for q := 0; value[q] != 0; {
+				end := bytes.IndexByte(value[q:], 0)
+				f.channels = append(f.channels, string(value[q:q+end]))
+				q += end + 1
+				f.pixelTypes = append(f.pixelTypes, binary.LittleEndian.Uint32(value[q:]))
+				q += 16
+			}
+		case "dataWindow":
+			f.width = int(binary.LittleEndian.Uint32(value[8:])) + 1
+			f.height = int(binary.LittleEndian.Uint32(value[12:])) + 1
+		case "compression":
+			if value[0] != 0 {
+				t.Fatalf("compressed")
+			}
+		}
+	}
+
+	for y := 0; y < f.height; y++ {
+		offset := int(binary.LittleEndian.Uint64(b[p+8*y:]))
+		if line := int(binary.LittleEndian.Uint32(b[offset:])); line != y {
+			t.Fatalf("offset %d points at line %d, want %d", y, line, y)
+		}
+		q := offset + 8
+		for c, name := range f.channels {
+			for x := 0; x < f.width; x++ {
+				if f.pixelTypes[c] == exrFloat {
+					f.values[name] = append(f.values[name], math.Float32frombits(binary.LittleEndian.Uint32(b[q:])))
+					q += 4
+				} else {
+					f.values[name] = append(f.values[name], halfToFloat(binary.LittleEndian.Uint16(b[q:])))
+					q += 2
+				}
+			}
+		}
+		if size := int(binary.LittleEndian.Uint32(b[offset+4:])); q != offset+8+size {
+			t.Fatalf("line %d is %d bytes, says %d", y, q-offset-8, size)
+		}
+	}
+	return f
+}
+
+func TestEncodeEXR(t *testing.T) {
+	passes := NewPasses(3, 2, AOVDepth, AOVNormal, AOVObjectID)
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			passes.Colour.Set(x, y, Vector3f{X: float64(x), Y: float64(y), Z: 4.5})
+			passes.AOVs[AOVDepth].Set(x, y, Vector3f{X: 12.345, Y: 12.345, Z: 12.345})
+			passes.AOVs[AOVNormal].Set(x, y, Vector3f{Y: 1})
+			passes.AOVs[AOVObjectID].Set(x, y, Vector3f{X: 1<<24 - 1, Y: 1<<24 - 1, Z: 1<<24 - 1})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeEXR(&buf, PassesEXRLayers(passes), false); err != nil {
+		t.Fatal(err)
+	}
+	f := readEXR(t, buf.Bytes())
+
+	want := "B G R Z normal.X normal.Y normal.Z object_id.Y"
+	if got := strings.Join(f.channels, " "); got != want {
+		t.Errorf("channels = %s, want %s", got, want)
+	}
+	if f.width != 3 || f.height != 2 {
+		t.Errorf("size = %dx%d, want 3x2", f.width, f.height)
+	}
+	if got := f.values["R"][5]; got != 2 {
+		t.Errorf("R at (2, 1) = %v, want 2", got)
+	}
+	if got := f.values["G"][5]; got != 1 {
+		t.Errorf("G at (2, 1) = %v, want 1", got)
+	}
+	if got := f.values["Z"][0]; got != 12.345 {
+		t.Errorf("Z = %v, want exactly 12.345 (as a float)", got)
+	}
+	if got := f.values["object_id.Y"][3]; got != 1<<24-1 {
+		t.Errorf("object id = %v, want %v", got, 1<<24-1)
+	}
+	if got := f.values["normal.Y"][1]; got != 1 {
+		t.Errorf("normal.Y = %v, want 1", got)
+	}
+}
+
+func TestEncodePFM(t *testing.T) {
+	img := NewFloatImage(2, 2)
+	img.Set(1, 0, Vector3f{X: 1.5, Y: -2, Z: 100})
+
+	var buf bytes.Buffer
+	if err := EncodePFM(&buf, img, false); err != nil {
+		t.Fatal(err)
+	}
+	header := "PF\n2 2\n-1.0\n"
+	b := buf.Bytes()
+	if !bytes.HasPrefix(b, []byte(header)) || len(b) != len(header)+2*2*3*4 {
+		t.Fatalf("bad pfm: %q", b)
+	}
+	// the top right pixel is last, as rows run from the bottom
+	data := b[len(header):]
+	for c, want := range []float32{1.5, -2, 100} {
+		if got := math.Float32frombits(binary.LittleEndian.Uint32(data[(3*3+c)*4:])); got != want {
+			t.Errorf("channel %d = %v, want %v", c, got, want)
+		}
+	}
+
+	buf.Reset()
+	if err := EncodePFM(&buf, img, true); err != nil {
+		t.Fatal(err)
+	}
+	if b := buf.Bytes(); !bytes.HasPrefix(b, []byte("Pf\n")) || len(b) != len(header)+2*2*4 {
+		t.Errorf("bad greyscale pfm: %q", b)
+	}
+}
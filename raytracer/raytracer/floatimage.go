@@ -0,0 +1,65 @@
+package raytracer
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// FloatImage is a width x height image of linear, unclamped rgb values
+type FloatImage struct {
+	Width, Height int
+	Pix           []Vector3f // row by row, from the top left
+}
+
+func NewFloatImage(width, height int) *FloatImage {
+	return &FloatImage{Width: width, Height: height, Pix: make([]Vector3f, width*height)}
+}
+
+func (f *FloatImage) At(x, y int) Vector3f {
+	return f.Pix[y*f.Width+x]
+}
+
+func (f *FloatImage) Set(x, y int, v Vector3f) {
+	f.Pix[y*f.Width+x] = v
+}
+
+// Sample returns the colour at (x, y) (pixel centres are at +0.5), bilinearly
+// interpolated, with the edge pixels extending outwards
+func (f *FloatImage) Sample(x, y float64) Vector3f {
+	x, y = x-0.5, y-0.5
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+	at := func(i, j float64) Vector3f {
+		return f.At(clampInt(int(i), 0, f.Width-1), clampInt(int(j), 0, f.Height-1))
+	}
+	top := at(x0, y0).Lerp(at(x0+1, y0), fx)
+	bottom := at(x0, y0+1).Lerp(at(x0+1, y0+1), fx)
+	return top.Lerp(bottom, fy)
+}
+
+// NRGBA converts the image to 8 bits, scaling down colours brighter than 1
+// (as clampRadiance does) and clamping negative values to 0
+func (f *FloatImage) NRGBA() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, f.Width, f.Height))
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			v := f.At(x, y)
+			if max := math.Max(v.X, math.Max(v.Y, v.Z)); max > 1 {
+				v = v.Multiply(1 / max)
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: toByte(v.X), G: toByte(v.Y), B: toByte(v.Z), A: 0xff})
+		}
+	}
+	return img
+}
+
+// toByte maps [0,1] to [0,255], rounding and clamping
+func toByte(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(0xff, v*0xff+0.5)))
+}
+
+// luminance returns the brightness of an rgb colour (rec. 709 weights)
+func luminance(c Vector3f) float64 {
+	return 0.2126*c.X + 0.7152*c.Y + 0.0722*c.Z
+}
@@ -0,0 +1,198 @@
+package raytracer
+
+import (
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "image/jpeg"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden images in testdata/golden")
+
+// goldenPSNR is the lowest peak signal to noise ratio (in dB) a render can
+// have against its golden image and pass; renders should be identical, but
+// floating point can differ a little between platforms (e.g. fused multiply-adds)
+const goldenPSNR = 40
+
+const goldenWidth, goldenHeight = 96, 72
+
+// goldenScenes are the reference scenes, each returning its scene and camera
+var goldenScenes = map[string]func(t *testing.T) (*Scene, *Camera){
+	// the viewer's default scene
+	"demo": func(t *testing.T) (*Scene, *Camera) {
+		envmap := loadTestImage(t, "../files/envmap-coast.jpg")
+		camera := &Camera{FOV: math.Pi / 3, FocalDistance: 16}
+		return DemoScene(envmap, camera), camera
+	},
+
+	// a glass ball bending a checkerboard behind it
+	"refraction": func(t *testing.T) (*Scene, *Camera) {
+		checker := Paper
+		checker.DiffuseTexture = &ProceduralTexture{
+			Pattern: CheckerPattern{},
+			ColourA: Vector3f{X: 0.9, Y: 0.9, Z: 0.9},
+			ColourB: Vector3f{X: 0.1, Y: 0.2, Z: 0.5},
+			Space:   WorldSpace,
+		}
+		return &Scene{
+			EnvMap: gradientEnvMap(),
+			Lights: []*Light{{Position: Vector3f{X: -10, Y: 10, Z: 10}, Intensity: 1.5}},
+			Spheres: []*Sphere{
+				{Centre: Vector3f{Z: -8}, Radius: 2, Material: Glass},
+			},
+			Planes: []*Plane{
+				{Point: Vector3f{Z: -16}, Normal: Vector3f{Z: 1}, Material: checker},
+			},
+		}, &Camera{FOV: math.Pi / 3}
+	},
+
+	// overlapping shadows of a ball on a floor, from two lights
+	"shadows": func(t *testing.T) (*Scene, *Camera) {
+		matte := Material{DiffuseColour: FloatToRGB(0.8, 0.8, 0.8), Albedo: [4]float64{1, 0, 0, 0}, RefractiveIndex: 1}
+		return &Scene{
+			EnvMap: gradientEnvMap(),
+			Lights: []*Light{
+				{Position: Vector3f{X: -10, Y: 20, Z: 0}, Intensity: 1},
+				{Position: Vector3f{X: 15, Y: 10, Z: -5}, Intensity: 1},
+			},
+			Spheres: []*Sphere{
+				{Centre: Vector3f{Y: -1, Z: -12}, Radius: 1.5, Material: RedRubber},
+			},
+			Planes: []*Plane{
+				{Point: Vector3f{Y: -2.5}, Normal: Vector3f{Y: 1}, Material: matte},
+			},
+		}, &Camera{FOV: math.Pi / 3, Position: Vector3f{Y: 3}, Pitch: 0.4}
+	},
+
+	// the environment, directly and in a mirror ball, looking back past the
+	// seam at the map's left and right edges
+	"envmap": func(t *testing.T) (*Scene, *Camera) {
+		camera := &Camera{FOV: math.Pi / 2, Yaw: math.Pi / 2}
+		return &Scene{
+			EnvMap: gradientEnvMap(),
+			Spheres: []*Sphere{
+				{Centre: camera.Forward().Multiply(6), Radius: 2, Material: Mirror},
+			},
+		}, camera
+	},
+}
+
+func TestGoldenImages(t *testing.T) {
+	for name, setup := range goldenScenes {
+		t.Run(name, func(t *testing.T) {
+			scene, camera := setup(t)
+			img := image.NewNRGBA(image.Rect(0, 0, goldenWidth, goldenHeight))
+			Render(img, goldenWidth, goldenHeight, camera, scene)
+
+			path := filepath.Join("testdata", "golden", name+".png")
+			if *update {
+				savePNG(t, path, img)
+				return
+			}
+
+			golden := loadTestImage(t, path)
+			if !golden.Bounds().Eq(img.Bounds()) {
+				t.Fatalf("golden image is %v, render is %v (run with -update to regenerate)", golden.Bounds().Size(), img.Bounds().Size())
+			}
+			if p := psnr(golden, img); p < goldenPSNR {
+				// write what was rendered, and where it differs, next to the golden
+				got := filepath.Join("testdata", "golden", name+"_got.png")
+				diff := filepath.Join("testdata", "golden", name+"_diff.png")
+				savePNG(t, got, img)
+				savePNG(t, diff, diffImage(golden, img))
+				t.Errorf("PSNR = %.1fdB, want at least %vdB (see %v and %v, or run with -update if the change is intended)", p, goldenPSNR, got, diff)
+			}
+		})
+	}
+}
+
+// gradientEnvMap is a small environment map with different colours in each
+// direction: red to blue around the horizon, dark below and bright above
+func gradientEnvMap() *image.NRGBA {
+	const w, h = 64, 32
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			u, v := float64(x)/w, float64(y)/h
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(255 * (1 - u) * (1 - v)),
+				G: uint8(255 * (1 - v) * math.Abs(math.Sin(3*math.Pi*u))),
+				B: uint8(255 * u * (1 - v/2)),
+				A: 0xff,
+			})
+		}
+	}
+	return img
+}
+
+// psnr returns the peak signal to noise ratio between two images' colours
+// (infinite for identical images)
+func psnr(a, b *image.NRGBA) float64 {
+	var sum float64
+	n := 0
+	for i := 0; i < len(a.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			d := float64(a.Pix[i+c]) - float64(b.Pix[i+c])
+			sum += d * d
+			n++
+		}
+	}
+	if sum == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(0xff*0xff/(sum/float64(n)))
+}
+
+// diffImage shows how much each pixel differs, exaggerated to be visible
+func diffImage(a, b *image.NRGBA) *image.NRGBA {
+	diff := image.NewNRGBA(a.Bounds())
+	for i := 0; i < len(a.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			d := math.Abs(float64(a.Pix[i+c])-float64(b.Pix[i+c])) * 8
+			diff.Pix[i+c] = uint8(math.Min(0xff, d))
+		}
+		diff.Pix[i+3] = 0xff
+	}
+	return diff
+}
+
+func loadTestImage(t *testing.T, path string) *image.NRGBA {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create golden images)", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nrgba := image.NewNRGBA(img.Bounds())
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			nrgba.Set(x, y, img.At(x, y))
+		}
+	}
+	return nrgba
+}
+
+func savePNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
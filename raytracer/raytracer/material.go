@@ -1,6 +1,9 @@
 package raytracer
 
-import "image/color"
+import (
+	"image/color"
+	"math"
+)
 
 // colour at infinity
 // var BackgroundColour = FloatToRGB(0.2, 0.7, 0.8)
@@ -36,6 +39,13 @@ var Glass = Material{
 	Albedo:           [4]float64{0.0, 0.5, 0.1, 0.8},
 	RefractiveIndex:  1.5,
 }
+var TintedGlass = Material{
+	DiffuseColour:    FloatToRGB(0.6, 0.7, 0.8),
+	SpecularExponent: 125.0,
+	Albedo:           [4]float64{0.0, 0.5, 0.1, 0.9},
+	RefractiveIndex:  1.5,
+	Absorption:       Vector3f{X: 0.4, Y: 0.05, Z: 0.2},
+}
 
 type Material struct {
 	DiffuseColour    color.NRGBA
@@ -43,6 +53,41 @@ type Material struct {
 	Albedo           [4]float64
 	// todo: struct for albedo describing characteristics?
 	RefractiveIndex float64
+
+	NormalMap Texture // tangent-space normal map (optional)
+	BumpMap   Texture // grayscale height map, read from the red channel (optional)
+	BumpScale float64 // height of a full-white bump, per unit of u/v
+
+	// beer-lambert absorption per unit distance travelled inside the object
+	// (per channel), tints thick glass more deeply than thin glass
+	Absorption Vector3f
+
+	// textures override (or for scalars, scale) the plain values above where set
+	DiffuseTexture          Texture
+	SpecularExponentTexture Texture    // scales SpecularExponent by the red channel
+	AlbedoTextures          [4]Texture // each scales the matching Albedo by the red channel
+}
+
+// At returns the material with any textures evaluated at hit
+func (m Material) At(hit Hit) Material {
+	if m.DiffuseTexture != nil {
+		// (procedural textures can stray outside [0,1], which wouldn't fit a byte)
+		c := m.DiffuseTexture.Evaluate(hit)
+		m.DiffuseColour = FloatToRGB(clamp01(c.X), clamp01(c.Y), clamp01(c.Z))
+	}
+	if m.SpecularExponentTexture != nil {
+		m.SpecularExponent *= m.SpecularExponentTexture.Evaluate(hit).X
+	}
+	for i, t := range m.AlbedoTextures {
+		if t != nil {
+			m.Albedo[i] *= t.Evaluate(hit).X
+		}
+	}
+	return m
+}
+
+func clamp01(x float64) float64 {
+	return math.Max(0, math.Min(1, x))
 }
 
 func FloatToRGB(r, g, b float64) color.NRGBA {
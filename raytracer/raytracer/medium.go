@@ -0,0 +1,178 @@
+package raytracer
+
+import (
+	"image/color"
+	"math"
+	"sort"
+)
+
+// Fog is homogeneous fog (or haze) filling the whole scene
+type Fog struct {
+	Density     float64     // extinction per unit distance
+	Colour      color.NRGBA // colour distant objects fade towards
+	MaxDistance float64     // rays that hit nothing are fogged as if they hit something this far away (defaults to 1000)
+}
+
+// Transmittance returns the fraction of light that survives dist through the fog
+func (f *Fog) Transmittance(dist float64) float64 {
+	max := f.MaxDistance
+	if max == 0 {
+		max = 1000
+	}
+	return math.Exp(-f.Density * math.Min(dist, max))
+}
+
+// Volume is a bounded, heterogeneous participating medium (smoke, dust, clouds)
+// that absorbs light passing through it, and scatters light from the scene's
+// lights towards the camera (single scattering), so shadowing geometry casts
+// visible shafts of light through it
+type Volume struct {
+	Bound    AABB
+	Density  Pattern  // density at each point, in [0,1] (nil for uniform density)
+	Scale    float64  // extinction per unit distance at full density
+	Albedo   Vector3f // fraction of extinguished light that is scattered rather than absorbed, per channel
+	StepSize float64  // ray marching step (defaults to 1/64 of the distance through the bounds)
+}
+
+// densityAt returns the extinction coefficient at p
+func (v *Volume) densityAt(p Vector3f) float64 {
+	if v.Density == nil {
+		return v.Scale
+	}
+	return v.Density.Value(p) * v.Scale
+}
+
+// GridDensity is a density pattern from a 3D grid of samples spanning Bound,
+// trilinearly interpolated (and zero outside)
+type GridDensity struct {
+	Bound      AABB
+	Nx, Ny, Nz int
+	Values     []float64 // x varies fastest, then y, then z
+}
+
+func (g *GridDensity) Value(p Vector3f) float64 {
+	size := g.Bound.Max.Sub(g.Bound.Min)
+	rel := p.Sub(g.Bound.Min)
+
+	// position in grid cells, with samples at cell centres
+	x := rel.X/size.X*float64(g.Nx) - 0.5
+	y := rel.Y/size.Y*float64(g.Ny) - 0.5
+	z := rel.Z/size.Z*float64(g.Nz) - 0.5
+	if x < -0.5 || y < -0.5 || z < -0.5 || x > float64(g.Nx)-0.5 || y > float64(g.Ny)-0.5 || z > float64(g.Nz)-0.5 {
+		return 0
+	}
+
+	x0, y0, z0 := math.Floor(x), math.Floor(y), math.Floor(z)
+	fx, fy, fz := x-x0, y-y0, z-z0
+	at := func(i, j, k int) float64 {
+		i = clampInt(i, 0, g.Nx-1)
+		j = clampInt(j, 0, g.Ny-1)
+		k = clampInt(k, 0, g.Nz-1)
+		return g.Values[i+g.Nx*(j+g.Ny*k)]
+	}
+	i, j, k := int(x0), int(y0), int(z0)
+	return lerp(fz,
+		lerp(fy, lerp(fx, at(i, j, k), at(i+1, j, k)), lerp(fx, at(i, j+1, k), at(i+1, j+1, k))),
+		lerp(fy, lerp(fx, at(i, j, k+1), at(i+1, j, k+1)), lerp(fx, at(i, j+1, k+1), at(i+1, j+1, k+1))))
+}
+
+func clampInt(x, lo, hi int) int {
+	if x < lo {
+		return lo
+	}
+	if x > hi {
+		return hi
+	}
+	return x
+}
+
+// Volumetrics returns how much of the light from dist along the ray reaches
+// the origin (per channel), and the light scattered towards the origin along
+// the way (in [0,1] per unit light intensity), through the scene's fog and volumes
+// dist may be infinite, for rays that hit nothing
+func (s *Scene) Volumetrics(ray Ray, dist float64) (Vector3f, Vector3f) {
+	origin, direction := ray.Origin, ray.Direction
+	transmittance := Vector3f{X: 1, Y: 1, Z: 1}
+	var scattered Vector3f
+
+	// march the volumes nearest first, so each only dims the light
+	// scattered from those behind it
+	type span struct {
+		v      *Volume
+		t0, t1 float64
+	}
+	var spans []span
+	for _, v := range s.Volumes {
+		t0, t1, ok := clipRay(v.Bound, origin, direction)
+		if !ok {
+			continue
+		}
+		t0, t1 = math.Max(t0, 0), math.Min(t1, dist)
+		if t1 <= t0 {
+			continue
+		}
+		spans = append(spans, span{v, t0, t1})
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].t0 < spans[j].t0 })
+
+	for _, sp := range spans {
+		v, t0, t1 := sp.v, sp.t0, sp.t1
+		step := v.StepSize
+		if step == 0 {
+			step = (t1 - t0) / 64
+		}
+
+		// march front to back, sampling the middle of each step
+		for t := t0 + step/2; t < t1; t += step {
+			p := origin.Add(direction.Multiply(t))
+			sigma := v.densityAt(p)
+			if sigma <= 0 {
+				continue
+			}
+
+			light := s.lightReaching(p, ray.Time)
+			scattered = scattered.Add(transmittance.MultiplyComponents(v.Albedo).Multiply(sigma * step * light))
+
+			transmittance = transmittance.Multiply(math.Exp(-sigma * step))
+		}
+	}
+
+	// fog in front of everything else, since it fills the whole scene
+	if s.Fog != nil && s.Fog.Density > 0 {
+		t := s.Fog.Transmittance(dist)
+		fog := Vector3f{
+			X: float64(s.Fog.Colour.R) / 0xff,
+			Y: float64(s.Fog.Colour.G) / 0xff,
+			Z: float64(s.Fog.Colour.B) / 0xff,
+		}
+		scattered = scattered.Multiply(t).Add(fog.Multiply(1 - t))
+		transmittance = transmittance.Multiply(t)
+	}
+	return transmittance, scattered
+}
+
+// lightReaching returns the total intensity of the lights with a clear line
+// of sight to p (scattering is isotropic, so direction doesn't matter)
+func (s *Scene) lightReaching(p Vector3f, time float64) float64 {
+	total := 0.0
+	for _, l := range s.Lights {
+		toLight := l.Position.Sub(p)
+		dist := toLight.Norm()
+		shadow := Ray{Origin: p, Direction: toLight.Multiply(1 / dist), Time: time}
+		if _, _, blocked := s.Intersect(shadow, dist); blocked {
+			continue
+		}
+		total += l.Intensity
+	}
+	return total / (4 * math.Pi)
+}
+
+// Absorb applies beer-lambert absorption to colour c, for light that has
+// travelled dist through the inside of an object made of m
+func (m *Material) Absorb(c Vector3f, dist float64) Vector3f {
+	return Vector3f{
+		X: c.X * math.Exp(-m.Absorption.X*dist),
+		Y: c.Y * math.Exp(-m.Absorption.Y*dist),
+		Z: c.Z * math.Exp(-m.Absorption.Z*dist),
+	}
+}
@@ -0,0 +1,94 @@
+package raytracer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFogTransmittance(t *testing.T) {
+	s := &Scene{Fog: &Fog{Density: 0.1, Colour: FloatToRGB(1, 1, 1)}}
+
+	transmittance, scattered := s.Volumetrics(Ray{Origin: Vector3f{}, Direction: Vector3f{Z: -1}}, 10)
+	if want := math.Exp(-1); !near(transmittance.X, want) {
+		t.Errorf("transmittance = %v, want %v", transmittance.X, want)
+	}
+	if want := 1 - math.Exp(-1); !near(scattered.X, want) {
+		t.Errorf("fog colour weight = %v, want %v", scattered.X, want)
+	}
+
+	// rays that escape are fogged at MaxDistance, not made fully opaque
+	if transmittance, _ := s.Volumetrics(Ray{Origin: Vector3f{}, Direction: Vector3f{Z: -1}}, math.Inf(1)); !near(transmittance.X, math.Exp(-100)) {
+		t.Errorf("escaping ray transmittance = %v", transmittance.X)
+	}
+}
+
+func TestGridDensity(t *testing.T) {
+	g := &GridDensity{
+		Bound:  AABB{Max: Vector3f{X: 2, Y: 1, Z: 1}},
+		Nx:     2,
+		Ny:     1,
+		Nz:     1,
+		Values: []float64{0, 1},
+	}
+	for _, c := range []struct {
+		p    Vector3f
+		want float64
+	}{
+		{Vector3f{X: 0.5, Y: 0.5, Z: 0.5}, 0},
+		{Vector3f{X: 1, Y: 0.5, Z: 0.5}, 0.5},
+		{Vector3f{X: 1.5, Y: 0.5, Z: 0.5}, 1},
+		{Vector3f{X: 3, Y: 0.5, Z: 0.5}, 0},
+	} {
+		if got := g.Value(c.p); !near(got, c.want) {
+			t.Errorf("density at %v = %v, want %v", c.p, got, c.want)
+		}
+	}
+}
+
+func TestVolumeLightShaft(t *testing.T) {
+	// a slab of uniform smoke lit from above, half of it shaded by a box
+	s := &Scene{
+		Lights: []*Light{{Position: Vector3f{Y: 10, Z: -5}, Intensity: 1}},
+		Shapes: []Shape{&Box{Min: Vector3f{X: -10, Y: 4, Z: -10}, Max: Vector3f{X: 0, Y: 5, Z: 0}}},
+		Volumes: []*Volume{{
+			Bound:  AABB{Min: Vector3f{X: -5, Y: -1, Z: -10}, Max: Vector3f{X: 5, Y: 1, Z: 0}},
+			Scale:  0.2,
+			Albedo: Vector3f{X: 1, Y: 1, Z: 1},
+		}},
+	}
+
+	lit, litScattered := s.Volumetrics(Ray{Origin: Vector3f{X: 2, Y: 0, Z: 5}, Direction: Vector3f{Z: -1}}, math.Inf(1))
+	shaded, shadedScattered := s.Volumetrics(Ray{Origin: Vector3f{X: -2, Y: 0, Z: 5}, Direction: Vector3f{Z: -1}}, math.Inf(1))
+
+	if !near(lit.X, shaded.X) || !near(lit.X, math.Exp(-2)) {
+		t.Errorf("transmittance = %v and %v, want %v", lit.X, shaded.X, math.Exp(-2))
+	}
+	if shadedScattered.X != 0 || litScattered.X <= 0 {
+		t.Errorf("scattered light = %v (lit), %v (shaded)", litScattered.X, shadedScattered.X)
+	}
+}
+
+func TestVolumesMarchedInOrder(t *testing.T) {
+	// a glowing slab in front of a dark, absorbing one: the slab behind
+	// mustn't dim the light scattered in front of it, whatever the order
+	front := &Volume{
+		Bound:  AABB{Min: Vector3f{X: -1, Y: -1, Z: -3}, Max: Vector3f{X: 1, Y: 1, Z: -1}},
+		Scale:  0.5,
+		Albedo: Vector3f{X: 1, Y: 1, Z: 1},
+	}
+	back := &Volume{
+		Bound: AABB{Min: Vector3f{X: -1, Y: -1, Z: -8}, Max: Vector3f{X: 1, Y: 1, Z: -4}},
+		Scale: 2,
+	}
+	lights := []*Light{{Position: Vector3f{Y: 10, Z: -2}, Intensity: 1}}
+	ray := Ray{Direction: Vector3f{Z: -1}}
+
+	wantT, wantS := (&Scene{Lights: lights, Volumes: []*Volume{front, back}}).Volumetrics(ray, math.Inf(1))
+	gotT, gotS := (&Scene{Lights: lights, Volumes: []*Volume{back, front}}).Volumetrics(ray, math.Inf(1))
+	if !nearVec(gotT, wantT) || !nearVec(gotS, wantS) {
+		t.Errorf("back volume listed first: transmittance %v, scattered %v, want %v, %v", gotT, gotS, wantT, wantS)
+	}
+	if wantS.X <= 0 {
+		t.Errorf("no light scattered by the front volume")
+	}
+}
@@ -0,0 +1,143 @@
+package raytracer
+
+import "math"
+
+// Mesh is a triangle mesh with its own BVH
+// meshes are usually shared between many Instances rather than copied
+type Mesh struct {
+	Positions []Vector3f
+	Normals   []Vector3f   // per-vertex normals for smooth shading (optional)
+	UVs       [][2]float64 // per-vertex texture coordinates (optional)
+	Faces     [][3]int     // vertex indices, counter-clockwise when viewed from outside
+	Material  Material
+
+	bvh *BVH
+}
+
+// NewMesh creates a mesh and builds its acceleration structure
+// normals and uvs may be nil, otherwise they must match positions in length
+func NewMesh(positions, normals []Vector3f, uvs [][2]float64, faces [][3]int, material Material) *Mesh {
+	m := &Mesh{
+		Positions: positions,
+		Normals:   normals,
+		UVs:       uvs,
+		Faces:     faces,
+		Material:  material,
+	}
+
+	triangles := make([]Shape, len(faces))
+	for i := range faces {
+		triangles[i] = m.newTriangle(i)
+	}
+	m.bvh = NewBVH(triangles)
+	return m
+}
+
+func (m *Mesh) Intersect(ray Ray, tMax float64) (float64, Hit, bool) {
+	return m.bvh.Intersect(ray, tMax)
+}
+
+func (m *Mesh) Bounds() AABB {
+	return m.bvh.Bounds()
+}
+
+// triangle is one face of a mesh
+type triangle struct {
+	mesh         *Mesh
+	face         int
+	normal       Vector3f // geometric (face) normal
+	tangent      Vector3f
+	bitangent    Vector3f
+	u, v         [3]float64
+	edge1, edge2 Vector3f
+}
+
+func (m *Mesh) newTriangle(face int) *triangle {
+	f := m.Faces[face]
+	p0, p1, p2 := m.Positions[f[0]], m.Positions[f[1]], m.Positions[f[2]]
+
+	tri := &triangle{
+		mesh:   m,
+		face:   face,
+		normal: p1.Sub(p0).Cross(p2.Sub(p0)).Normalised(),
+		edge1:  p1.Sub(p0),
+		edge2:  p2.Sub(p0),
+	}
+	if m.UVs != nil {
+		for i := 0; i < 3; i++ {
+			tri.u[i], tri.v[i] = m.UVs[f[i]][0], m.UVs[f[i]][1]
+		}
+	} else {
+		// planar default, so textures still show up
+		tri.u = [3]float64{0, 1, 0}
+		tri.v = [3]float64{0, 0, 1}
+	}
+	tri.tangent, tri.bitangent = TriangleTangentFrame(p0, p1, p2, tri.u, tri.v)
+	return tri
+}
+
+// Intersect uses the möller-trumbore algorithm
+func (tri *triangle) Intersect(ray Ray, tMax float64) (float64, Hit, bool) {
+	origin, direction := ray.Origin, ray.Direction
+	p0 := tri.mesh.Positions[tri.mesh.Faces[tri.face][0]]
+
+	pvec := direction.Cross(tri.edge2)
+	det := tri.edge1.Dot(pvec)
+	if math.Abs(det) < 1e-12 {
+		return 0, Hit{}, false // parallel to the triangle
+	}
+	invDet := 1 / det
+
+	tvec := origin.Sub(p0)
+	b1 := tvec.Dot(pvec) * invDet
+	if b1 < 0 || b1 > 1 {
+		return 0, Hit{}, false
+	}
+	qvec := tvec.Cross(tri.edge1)
+	b2 := direction.Dot(qvec) * invDet
+	if b2 < 0 || b1+b2 > 1 {
+		return 0, Hit{}, false
+	}
+	t := tri.edge2.Dot(qvec) * invDet
+	if t <= 1e-9 || t >= tMax {
+		return 0, Hit{}, false
+	}
+
+	// interpolate vertex attributes with the barycentric coordinates
+	b0 := 1 - b1 - b2
+	point := origin.Add(direction.Multiply(t))
+	n := tri.normal
+	if tri.mesh.Normals != nil {
+		f := tri.mesh.Faces[tri.face]
+		ns := tri.mesh.Normals
+		n = ns[f[0]].Multiply(b0).Add(ns[f[1]].Multiply(b1)).Add(ns[f[2]].Multiply(b2)).Normalised()
+	}
+	tangent := tri.tangent.Sub(n.Multiply(n.Dot(tri.tangent))).Normalised()
+
+	return t, Hit{
+		Point:     point,
+		Local:     point,
+		Normal:    n,
+		Tangent:   tangent,
+		Bitangent: n.Cross(tangent).Multiply(sign(tri.bitangent.Dot(n.Cross(tangent)))),
+		U:         b0*tri.u[0] + b1*tri.u[1] + b2*tri.u[2],
+		V:         b0*tri.v[0] + b1*tri.v[1] + b2*tri.v[2],
+		Material:  &tri.mesh.Material,
+	}, true
+}
+
+func (tri *triangle) Bounds() AABB {
+	f := tri.mesh.Faces[tri.face]
+	return EmptyAABB().
+		Extend(tri.mesh.Positions[f[0]]).
+		Extend(tri.mesh.Positions[f[1]]).
+		Extend(tri.mesh.Positions[f[2]])
+}
+
+// sign returns -1 for negative x, otherwise 1
+func sign(x float64) float64 {
+	if x < 0 {
+		return -1
+	}
+	return 1
+}
@@ -0,0 +1,82 @@
+package raytracer
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestTriangleIntersect(t *testing.T) {
+	// one triangle, facing +z
+	mesh := NewMesh([]Vector3f{{Z: -5}, {X: 2, Z: -5}, {Y: 2, Z: -5}}, nil, nil, [][3]int{{0, 1, 2}}, Ivory)
+	checkRays(t, mesh, []rayCase{
+		{name: "front", origin: Vector3f{X: 0.5, Y: 0.5}, direction: Vector3f{Z: -1}, wantT: 5, wantNormal: Vector3f{Z: 1}},
+		{name: "back face", origin: Vector3f{X: 0.5, Y: 0.5, Z: -10}, direction: Vector3f{Z: 1}, wantT: 5, wantNormal: Vector3f{Z: 1}},
+		{name: "edge", origin: Vector3f{X: 1}, direction: Vector3f{Z: -1}, wantT: 5, wantNormal: Vector3f{Z: 1}},
+		{name: "long edge", origin: Vector3f{X: 1, Y: 1}, direction: Vector3f{Z: -1}, wantT: 5, wantNormal: Vector3f{Z: 1}},
+		{name: "corner", direction: Vector3f{Z: -1}, wantT: 5, wantNormal: Vector3f{Z: 1}},
+		{name: "slanted", origin: Vector3f{X: -1, Y: 0.5}, direction: Vector3f{X: 1.5, Z: -5}, wantT: math.Sqrt(1.5*1.5 + 25), wantNormal: Vector3f{Z: 1}},
+		{name: "past the long edge", origin: Vector3f{X: 1.01, Y: 1}, direction: Vector3f{Z: -1}, miss: true},
+		{name: "past an edge", origin: Vector3f{X: -0.01, Y: 0.5}, direction: Vector3f{Z: -1}, miss: true},
+		{name: "parallel", origin: Vector3f{X: -1, Y: 0.5, Z: -5}, direction: Vector3f{X: 1}, miss: true},
+		{name: "behind", origin: Vector3f{X: 0.5, Y: 0.5, Z: -10}, direction: Vector3f{Z: -1}, miss: true},
+	})
+}
+
+func TestReadOBJ(t *testing.T) {
+	// a unit square, split into two triangles, with a normal tilted at one corner
+	mesh, err := ReadOBJ(strings.NewReader(`# square
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+vt 0 0
+vt 1 0
+vt 1 1
+vt 0 1
+vn 0 0 1
+vn 1 0 1
+g square
+f 1/1/1 2/2/1 3/3/2 4/4/1
+`), Ivory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mesh.Faces) != 2 || len(mesh.Positions) != 4 || len(mesh.Normals) != 4 || len(mesh.UVs) != 4 {
+		t.Fatalf("%d faces, %d positions, %d normals, %d uvs, want 2, 4, 4, 4", len(mesh.Faces), len(mesh.Positions), len(mesh.Normals), len(mesh.UVs))
+	}
+	_, hit, ok := mesh.Intersect(Ray{Origin: Vector3f{X: 0.25, Y: 0.75, Z: 1}, Direction: Vector3f{Z: -1}}, math.MaxFloat64)
+	if !ok {
+		t.Fatal("missed the square")
+	}
+	// (obj's v is upwards, a texture's downwards)
+	if !near(hit.U, 0.25) || !near(hit.V, 0.25) {
+		t.Errorf("uv = (%v, %v), want (0.25, 0.25)", hit.U, hit.V)
+	}
+	if hit.Normal.X <= 0 || !near(hit.Normal.Norm(), 1) {
+		t.Errorf("normal = %v, want one tilted towards +x", hit.Normal)
+	}
+
+	// negative indices count back, and faces without normals drop them all
+	mesh, err = ReadOBJ(strings.NewReader("v 0 0 0\nv 1 0 0\nv 0 1 0\nvn 0 0 1\nf -3//1 -2//1 -1//1\nf 1 2 3\n"), Ivory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mesh.Faces) != 2 || mesh.Normals != nil || mesh.UVs != nil {
+		t.Errorf("%d faces, normals %v, uvs %v", len(mesh.Faces), mesh.Normals, mesh.UVs)
+	}
+
+	for _, bad := range []string{
+		"v 0 0 0\nv 1 0 0\nf 1 2 3\n",
+		"v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2\n",
+		"v 0 0\n",
+		"v 0 0 zero\n",
+		"v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1/1 2/1 3/1\n",
+		"v 0 0 0\nv 1 0 0\nv 0 1 0\nf /1 2 3\n",
+		"v 0 0 0\n",
+	} {
+		if _, err := ReadOBJ(strings.NewReader(bad), Ivory); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+}
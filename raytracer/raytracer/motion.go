@@ -0,0 +1,136 @@
+package raytracer
+
+import "math"
+
+// Motion describes how something moves over time
+type Motion interface {
+	// At returns the transform (relative to the rest position) at time
+	At(time float64) Transform
+}
+
+// LinearMotion moves at a constant velocity (units per unit time), from the
+// rest position at time 0
+type LinearMotion struct {
+	Velocity Vector3f
+}
+
+func (m LinearMotion) At(time float64) Transform {
+	return Translate(m.Velocity.Multiply(time))
+}
+
+// Keyframe is a placement at an instant in time
+type Keyframe struct {
+	Time        float64
+	Translation Vector3f
+	Rotation    Vector3f // euler angles (radians), applied around x, then y, then z
+	Scale       Vector3f // zero for no scaling
+}
+
+// Transform returns the keyframe's scale, then rotation, then translation
+func (k Keyframe) Transform() Transform {
+	scale := k.Scale
+	if scale == (Vector3f{}) {
+		scale = Vector3f{X: 1, Y: 1, Z: 1}
+	}
+	return Scale(scale).
+		Then(RotateX(k.Rotation.X)).
+		Then(RotateY(k.Rotation.Y)).
+		Then(RotateZ(k.Rotation.Z)).
+		Then(Translate(k.Translation))
+}
+
+// keyframeOf splits an affine transform back into the keyframe placement
+// that would make it (any shear is lost)
+func keyframeOf(t Transform) Keyframe {
+	m := t.Matrix
+	k := Keyframe{Translation: Vector3f{X: m[0][3], Y: m[1][3], Z: m[2][3]}}
+
+	// each column of the upper 3x3 is a rotated axis, scaled
+	var r [3][3]float64
+	scale := [3]float64{}
+	for j := 0; j < 3; j++ {
+		scale[j] = math.Sqrt(m[0][j]*m[0][j] + m[1][j]*m[1][j] + m[2][j]*m[2][j])
+	}
+	if m.Determinant() < 0 {
+		// a mirror image, put into the x scale
+		scale[0] = -scale[0]
+	}
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			r[i][j] = m[i][j] / scale[j]
+		}
+	}
+	k.Scale = Vector3f{X: scale[0], Y: scale[1], Z: scale[2]}
+
+	// r = RotateZ * RotateY * RotateX
+	k.Rotation.Y = math.Asin(math.Max(-1, math.Min(1, -r[2][0])))
+	if math.Abs(r[2][0]) < 1-1e-9 {
+		k.Rotation.X = math.Atan2(r[2][1], r[2][2])
+		k.Rotation.Z = math.Atan2(r[1][0], r[0][0])
+	} else {
+		// gimbal lock, where only x+z (or x-z) is known
+		k.Rotation.X = math.Atan2(-r[1][2], r[1][1])
+	}
+	return k
+}
+
+// KeyframeMotion moves between keyframes (sorted by time), interpolating
+// each component linearly, and holding still before the first and after the last
+type KeyframeMotion []Keyframe
+
+func (k KeyframeMotion) At(time float64) Transform {
+	if len(k) == 0 {
+		return IdentityTransform()
+	}
+	if time <= k[0].Time {
+		return k[0].Transform()
+	}
+	for i := 1; i < len(k); i++ {
+		if time < k[i].Time {
+			a, b := k[i-1], k[i]
+			f := (time - a.Time) / (b.Time - a.Time)
+			return Keyframe{
+				Translation: a.Translation.Lerp(b.Translation, f),
+				Rotation:    a.Rotation.Lerp(b.Rotation, f),
+				Scale:       a.keyScale().Lerp(b.keyScale(), f),
+			}.Transform()
+		}
+	}
+	return k[len(k)-1].Transform()
+}
+
+// keyScale returns the keyframe's scale, with zero meaning no scaling
+func (k Keyframe) keyScale() Vector3f {
+	if k.Scale == (Vector3f{}) {
+		return Vector3f{X: 1, Y: 1, Z: 1}
+	}
+	return k.Scale
+}
+
+// Moving is a shape that moves over time, hit by each ray where it is at the ray's time
+type Moving struct {
+	Shape  Shape
+	Motion Motion
+
+	// the interval rays' times fall within (the camera's shutter interval),
+	// the shape is bounded over the whole of its movement in this time
+	ShutterOpen, ShutterClose float64
+}
+
+// movingBoundSamples is how many instants to bound a moving shape at
+// (exact for straight-line motion, a close approximation for rotation)
+const movingBoundSamples = 16
+
+func (m *Moving) Intersect(ray Ray, tMax float64) (float64, Hit, bool) {
+	return intersectTransformed(m.Shape, m.Motion.At(ray.Time), ray, tMax)
+}
+
+func (m *Moving) Bounds() AABB {
+	b := m.Shape.Bounds()
+	swept := EmptyAABB()
+	for i := 0; i <= movingBoundSamples; i++ {
+		time := m.ShutterOpen + (m.ShutterClose-m.ShutterOpen)*float64(i)/movingBoundSamples
+		swept = swept.Union(m.Motion.At(time).Bounds(b))
+	}
+	return swept
+}
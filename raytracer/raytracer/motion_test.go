@@ -0,0 +1,74 @@
+package raytracer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMovingSphere(t *testing.T) {
+	m := &Moving{
+		Shape:        &Sphere{Centre: Vector3f{Z: -5}, Radius: 1},
+		Motion:       LinearMotion{Velocity: Vector3f{X: 4}},
+		ShutterOpen:  0,
+		ShutterClose: 1,
+	}
+
+	// the same ray hits the sphere at the start of the shutter, but not at the end
+	ray := Ray{Direction: Vector3f{Z: -1}}
+	if _, _, ok := m.Intersect(ray, math.MaxFloat64); !ok {
+		t.Errorf("missed at time 0")
+	}
+	ray.Time = 1
+	if _, _, ok := m.Intersect(ray, math.MaxFloat64); ok {
+		t.Errorf("hit at time 1, after the sphere has moved away")
+	}
+	ray.Origin.X = 4
+	if dist, hit, ok := m.Intersect(ray, math.MaxFloat64); !ok || !near(dist, 4) || !nearVec(hit.Normal, Vector3f{Z: 1}) {
+		t.Errorf("moved sphere: hit = %v at %v, normal %v", ok, dist, hit.Normal)
+	}
+
+	// bounds cover the whole sweep
+	b := m.Bounds()
+	if !near(b.Min.X, -1) || !near(b.Max.X, 5) {
+		t.Errorf("bounds = %v, want x from -1 to 5", b)
+	}
+}
+
+func TestKeyframeMotion(t *testing.T) {
+	k := KeyframeMotion{
+		{Time: 0, Translation: Vector3f{X: 0}},
+		{Time: 2, Translation: Vector3f{X: 4}, Rotation: Vector3f{Y: math.Pi / 2}, Scale: Vector3f{X: 3, Y: 3, Z: 3}},
+	}
+	for _, c := range []struct {
+		time float64
+		want Vector3f // where (1, 0, 0) ends up
+	}{
+		{-1, Vector3f{X: 1}},
+		{0, Vector3f{X: 1}},
+		{1, Vector3f{X: 2 + 2*math.Cos(math.Pi/4), Z: -2 * math.Sin(math.Pi/4)}},
+		{2, Vector3f{X: 4, Z: -3}},
+		{5, Vector3f{X: 4, Z: -3}},
+	} {
+		if got := k.At(c.time).Point(Vector3f{X: 1}); !nearVec(got, c.want) {
+			t.Errorf("time %v: %v, want %v", c.time, got, c.want)
+		}
+	}
+}
+
+func TestKeyframeOf(t *testing.T) {
+	for _, k := range []Keyframe{
+		{},
+		{Translation: Vector3f{X: 1, Y: -2, Z: 3}},
+		{Scale: Vector3f{X: 2, Y: 0.5, Z: 3}, Rotation: Vector3f{X: 0.3, Y: -0.7, Z: 1.2}},
+		{Scale: Vector3f{X: -1, Y: 1, Z: 1}, Rotation: Vector3f{Z: 2}, Translation: Vector3f{Y: 1}},
+		{Rotation: Vector3f{X: 0.4, Y: math.Pi / 2, Z: 0.1}}, // gimbal lock
+	} {
+		want := k.Transform()
+		got := keyframeOf(want).Transform()
+		for _, p := range []Vector3f{{}, {X: 1}, {Y: 1}, {Z: 1}} {
+			if !nearVec(got.Point(p), want.Point(p)) {
+				t.Errorf("%+v: moves %v to %v, want %v", k, p, got.Point(p), want.Point(p))
+			}
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package raytracer
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Noise3D is a continuous, deterministic noise function of a 3D position
+type Noise3D interface {
+	// Noise returns a value in roughly [-1,1]
+	Noise(p Vector3f) float64
+}
+
+// permutation builds a shuffled, doubled table of 0..255 from seed
+func permutation(seed int64) [512]uint8 {
+	var perm [512]uint8
+	r := rand.New(rand.NewSource(seed))
+	for i, v := range r.Perm(256) {
+		perm[i] = uint8(v)
+		perm[i+256] = uint8(v)
+	}
+	return perm
+}
+
+// Perlin is Ken Perlin's improved gradient noise
+type Perlin struct {
+	perm [512]uint8
+}
+
+// NewPerlin creates Perlin noise, the same seed always gives the same noise
+func NewPerlin(seed int64) *Perlin {
+	return &Perlin{perm: permutation(seed)}
+}
+
+func (n *Perlin) Noise(p Vector3f) float64 {
+	// unit cube containing the point, and the point's position within it
+	fx, fy, fz := math.Floor(p.X), math.Floor(p.Y), math.Floor(p.Z)
+	xi, yi, zi := int(fx)&255, int(fy)&255, int(fz)&255
+	x, y, z := p.X-fx, p.Y-fy, p.Z-fz
+	u, v, w := fade(x), fade(y), fade(z)
+
+	perm := &n.perm
+	a := int(perm[xi]) + yi
+	aa, ab := int(perm[a])+zi, int(perm[a+1])+zi
+	b := int(perm[xi+1]) + yi
+	ba, bb := int(perm[b])+zi, int(perm[b+1])+zi
+
+	return lerp(w,
+		lerp(v,
+			lerp(u, grad(perm[aa], x, y, z), grad(perm[ba], x-1, y, z)),
+			lerp(u, grad(perm[ab], x, y-1, z), grad(perm[bb], x-1, y-1, z))),
+		lerp(v,
+			lerp(u, grad(perm[aa+1], x, y, z-1), grad(perm[ba+1], x-1, y, z-1)),
+			lerp(u, grad(perm[ab+1], x, y-1, z-1), grad(perm[bb+1], x-1, y-1, z-1))))
+}
+
+// fade is the quintic smoothstep 6t^5 - 15t^4 + 10t^3
+func fade(t float64) float64 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+func lerp(t, a, b float64) float64 {
+	return a + t*(b-a)
+}
+
+// grad returns the dot product of (x, y, z) with one of 12 cube-edge gradients
+func grad(hash uint8, x, y, z float64) float64 {
+	h := hash & 15
+	u := y
+	if h < 8 {
+		u = x
+	}
+	v := z
+	if h < 4 {
+		v = y
+	} else if h == 12 || h == 14 {
+		v = x
+	}
+	if h&1 != 0 {
+		u = -u
+	}
+	if h&2 != 0 {
+		v = -v
+	}
+	return u + v
+}
+
+// Simplex is 3D simplex noise (after Stefan Gustavson's reference implementation)
+// cheaper than Perlin at higher octave counts, and without axis-aligned artefacts
+type Simplex struct {
+	perm [512]uint8
+}
+
+// NewSimplex creates simplex noise, the same seed always gives the same noise
+func NewSimplex(seed int64) *Simplex {
+	return &Simplex{perm: permutation(seed)}
+}
+
+var simplexGrad = [12]Vector3f{
+	{1, 1, 0}, {-1, 1, 0}, {1, -1, 0}, {-1, -1, 0},
+	{1, 0, 1}, {-1, 0, 1}, {1, 0, -1}, {-1, 0, -1},
+	{0, 1, 1}, {0, -1, 1}, {0, 1, -1}, {0, -1, -1},
+}
+
+func (n *Simplex) Noise(p Vector3f) float64 {
+	const f3, g3 = 1.0 / 3.0, 1.0 / 6.0
+
+	// skew into simplex cell space
+	s := (p.X + p.Y + p.Z) * f3
+	i, j, k := math.Floor(p.X+s), math.Floor(p.Y+s), math.Floor(p.Z+s)
+	t := (i + j + k) * g3
+	x0 := Vector3f{X: p.X - (i - t), Y: p.Y - (j - t), Z: p.Z - (k - t)}
+
+	// which of the six tetrahedra the point is in
+	var i1, j1, k1, i2, j2, k2 float64
+	if x0.X >= x0.Y {
+		if x0.Y >= x0.Z {
+			i1, i2, j2 = 1, 1, 1
+		} else if x0.X >= x0.Z {
+			i1, i2, k2 = 1, 1, 1
+		} else {
+			k1, i2, k2 = 1, 1, 1
+		}
+	} else {
+		if x0.Y < x0.Z {
+			k1, j2, k2 = 1, 1, 1
+		} else if x0.X < x0.Z {
+			j1, j2, k2 = 1, 1, 1
+		} else {
+			j1, i2, j2 = 1, 1, 1
+		}
+	}
+
+	corners := [4]Vector3f{
+		x0,
+		{X: x0.X - i1 + g3, Y: x0.Y - j1 + g3, Z: x0.Z - k1 + g3},
+		{X: x0.X - i2 + 2*g3, Y: x0.Y - j2 + 2*g3, Z: x0.Z - k2 + 2*g3},
+		{X: x0.X - 1 + 3*g3, Y: x0.Y - 1 + 3*g3, Z: x0.Z - 1 + 3*g3},
+	}
+	offsets := [4][3]int{{0, 0, 0}, {int(i1), int(j1), int(k1)}, {int(i2), int(j2), int(k2)}, {1, 1, 1}}
+
+	ii, jj, kk := int(i)&255, int(j)&255, int(k)&255
+	perm := &n.perm
+	total := 0.0
+	for c, d := range corners {
+		o := offsets[c]
+		g := perm[ii+o[0]+int(perm[jj+o[1]+int(perm[kk+o[2]])])] % 12
+		falloff := 0.6 - d.Dot(d)
+		if falloff > 0 {
+			falloff *= falloff
+			total += falloff * falloff * simplexGrad[g].Dot(d)
+		}
+	}
+
+	// scale to roughly [-1,1]
+	return 32 * total
+}
+
+// Worley is cellular (Voronoi) noise, based on the distance to randomly
+// scattered feature points, one per unit cell
+type Worley struct {
+	seed uint64
+}
+
+// NewWorley creates cellular noise, the same seed always gives the same noise
+func NewWorley(seed int64) *Worley {
+	return &Worley{seed: uint64(seed)}
+}
+
+// Distances returns the distance to the closest (f1) and second closest (f2)
+// feature points to p
+func (n *Worley) Distances(p Vector3f) (f1, f2 float64) {
+	fx, fy, fz := math.Floor(p.X), math.Floor(p.Y), math.Floor(p.Z)
+	f1, f2 = math.MaxFloat64, math.MaxFloat64
+
+	for dx := -1.0; dx <= 1; dx++ {
+		for dy := -1.0; dy <= 1; dy++ {
+			for dz := -1.0; dz <= 1; dz++ {
+				cx, cy, cz := fx+dx, fy+dy, fz+dz
+				h := n.hashCell(int64(cx), int64(cy), int64(cz))
+				feature := Vector3f{
+					X: cx + unitFloat(h),
+					Y: cy + unitFloat(h>>21),
+					Z: cz + unitFloat(h>>42),
+				}
+				d := feature.Sub(p).Norm()
+				if d < f1 {
+					f1, f2 = d, f1
+				} else if d < f2 {
+					f2 = d
+				}
+			}
+		}
+	}
+	return f1, f2
+}
+
+// Noise returns the distance to the closest feature point, remapped to [-1,1]
+func (n *Worley) Noise(p Vector3f) float64 {
+	f1, _ := n.Distances(p)
+	return math.Min(f1, 1)*2 - 1
+}
+
+// hashCell mixes integer cell coordinates with the seed (splitmix64 finaliser)
+func (n *Worley) hashCell(x, y, z int64) uint64 {
+	h := n.seed ^ uint64(x)*0x9e3779b97f4a7c15 ^ uint64(y)*0xc2b2ae3d27d4eb4f ^ uint64(z)*0x165667b19e3779f9
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+// unitFloat maps the low 21 bits of h to [0,1)
+func unitFloat(h uint64) float64 {
+	return float64(h&(1<<21-1)) / (1 << 21)
+}
+
+// FBM sums octaves of noise at increasing frequency (lacunarity) and
+// decreasing amplitude (gain), giving fractal brownian motion in roughly [-1,1]
+func FBM(n Noise3D, p Vector3f, octaves int, lacunarity, gain float64) float64 {
+	total, amplitude, norm := 0.0, 1.0, 0.0
+	for i := 0; i < octaves; i++ {
+		total += amplitude * n.Noise(p)
+		norm += amplitude
+		amplitude *= gain
+		p = p.Multiply(lacunarity)
+	}
+	if norm == 0 {
+		return 0
+	}
+	return total / norm
+}
+
+// Turbulence is FBM of the absolute value of noise, giving billowy, creased
+// patterns in [0,1]
+func Turbulence(n Noise3D, p Vector3f, octaves int, lacunarity, gain float64) float64 {
+	total, amplitude, norm := 0.0, 1.0, 0.0
+	for i := 0; i < octaves; i++ {
+		total += amplitude * math.Abs(n.Noise(p))
+		norm += amplitude
+		amplitude *= gain
+		p = p.Multiply(lacunarity)
+	}
+	if norm == 0 {
+		return 0
+	}
+	return total / norm
+}
@@ -0,0 +1,74 @@
+package raytracer
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestNoise(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		new  func(seed int64) Noise3D
+	}{
+		{"perlin", func(seed int64) Noise3D { return NewPerlin(seed) }},
+		{"simplex", func(seed int64) Noise3D { return NewSimplex(seed) }},
+		{"worley", func(seed int64) Noise3D { return NewWorley(seed) }},
+	} {
+		a, b, other := c.new(1), c.new(1), c.new(2)
+		r := NewRNG(5, 6)
+		differ := false
+		for i := 0; i < 2000; i++ {
+			p := Vector3f{X: r.Float64(), Y: r.Float64(), Z: r.Float64()}.Multiply(100).Sub(Vector3f{X: 50, Y: 50, Z: 50})
+			v := a.Noise(p)
+			if v != b.Noise(p) {
+				t.Fatalf("%s: seed 1 gives %v and %v at %v", c.name, v, b.Noise(p), p)
+			}
+			differ = differ || v != other.Noise(p)
+
+			// "roughly [-1,1]", with the fractal sums normalised to the same
+			for name, v := range map[string]float64{
+				"noise":      v,
+				"fbm":        FBM(a, p, 5, 2, 0.5),
+				"turbulence": Turbulence(a, p, 5, 2, 0.5)*2 - 1,
+			} {
+				if math.IsNaN(v) || v < -1.1 || v > 1.1 {
+					t.Fatalf("%s %s at %v = %v, out of range", c.name, name, p, v)
+				}
+			}
+		}
+		if !differ {
+			t.Errorf("%s: seeds 1 and 2 give the same noise", c.name)
+		}
+	}
+
+	// the fractal sums are the same noise, however many octaves
+	n := NewPerlin(3)
+	p := Vector3f{X: 1.3, Y: -2.7, Z: 0.4}
+	if FBM(n, p, 1, 2, 0.5) != n.Noise(p) || Turbulence(n, p, 1, 2, 0.5) != math.Abs(n.Noise(p)) {
+		t.Errorf("one octave isn't plain noise")
+	}
+	if FBM(n, p, 0, 2, 0.5) != 0 || Turbulence(n, p, 0, 2, 0.5) != 0 {
+		t.Errorf("no octaves isn't 0")
+	}
+}
+
+// constantTexture is a texture that's the same colour everywhere
+type constantTexture Vector3f
+
+func (c constantTexture) Evaluate(Hit) Vector3f { return Vector3f(c) }
+
+func TestMaterialTextureClamped(t *testing.T) {
+	for _, c := range []struct {
+		colour Vector3f
+		want   color.NRGBA
+	}{
+		{Vector3f{X: 0.5, Y: 1, Z: 0}, FloatToRGB(0.5, 1, 0)},
+		{Vector3f{X: 1.2, Y: -0.3, Z: 2}, FloatToRGB(1, 0, 1)},
+	} {
+		m := Material{DiffuseTexture: constantTexture(c.colour)}
+		if got := m.At(Hit{}).DiffuseColour; got != c.want {
+			t.Errorf("texture colour %v gives %v, want %v", c.colour, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package raytracer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LoadOBJ reads a Wavefront OBJ file into a mesh, which can then be shared
+// between any number of Instances
+func LoadOBJ(path string, material Material) (*Mesh, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadOBJ(f, material)
+}
+
+// ReadOBJ reads the vertices (v), texture coordinates (vt), normals (vn) and
+// faces (f) of an OBJ file, splitting polygons into triangle fans. anything
+// else (groups, materials, smoothing) is ignored
+// normals and uvs are only kept if every face vertex has them
+func ReadOBJ(r io.Reader, material Material) (*Mesh, error) {
+	var positions, normals []Vector3f
+	var uvs [][2]float64
+
+	// each distinct v/vt/vn combination is a vertex of the mesh
+	type corner struct{ v, vt, vn int }
+	vertices := make(map[corner]int)
+	var corners []corner
+	var faces [][3]int
+	hasUVs, hasNormals := true, true
+
+	floats := func(fields []string, min int) ([]float64, error) {
+		if len(fields) < min {
+			return nil, fmt.Errorf("want %d values, got %d", min, len(fields))
+		}
+		v := make([]float64, len(fields))
+		for i, s := range fields {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = f
+		}
+		return v, nil
+	}
+	// index parses a 1-based (or negative, counting back from the end) index
+	// into a list of n, returning -1 if s is empty
+	index := func(s string, n int) (int, error) {
+		if s == "" {
+			return -1, nil
+		}
+		i, err := strconv.Atoi(s)
+		switch {
+		case err != nil:
+			return 0, err
+		case i < 0:
+			i += n
+		default:
+			i--
+		}
+		if i < 0 || i >= n {
+			return 0, fmt.Errorf("index %s out of range", s)
+		}
+		return i, nil
+	}
+	face := func(fields []string) error {
+		if len(fields) < 3 {
+			return fmt.Errorf("a face needs at least 3 vertices, got %d", len(fields))
+		}
+		ids := make([]int, len(fields))
+		for i, field := range fields {
+			parts := strings.Split(field, "/")
+			if len(parts) > 3 {
+				return fmt.Errorf("bad face vertex %q", field)
+			}
+			parts = append(parts, "", "")
+			var c corner
+			var err error
+			if c.v, err = index(parts[0], len(positions)); err == nil && c.v < 0 {
+				err = fmt.Errorf("face vertex %q has no position", field)
+			}
+			if err != nil {
+				return err
+			}
+			if c.vt, err = index(parts[1], len(uvs)); err != nil {
+				return err
+			}
+			if c.vn, err = index(parts[2], len(normals)); err != nil {
+				return err
+			}
+			hasUVs = hasUVs && c.vt >= 0
+			hasNormals = hasNormals && c.vn >= 0
+
+			id, ok := vertices[c]
+			if !ok {
+				id = len(corners)
+				vertices[c] = id
+				corners = append(corners, c)
+			}
+			ids[i] = id
+		}
+		for i := 1; i+1 < len(ids); i++ {
+			faces = append(faces, [3]int{ids[0], ids[i], ids[i+1]})
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		var err error
+		var v []float64
+		switch fields[0] {
+		case "v":
+			// (ignoring any w)
+			if v, err = floats(fields[1:], 3); err == nil {
+				positions = append(positions, Vector3f{X: v[0], Y: v[1], Z: v[2]})
+			}
+		case "vt":
+			// obj's v is upwards, a texture's downwards
+			if v, err = floats(fields[1:], 2); err == nil {
+				uvs = append(uvs, [2]float64{v[0], 1 - v[1]})
+			}
+		case "vn":
+			if v, err = floats(fields[1:], 3); err == nil {
+				normals = append(normals, Vector3f{X: v[0], Y: v[1], Z: v[2]}.Normalised())
+			}
+		case "f":
+			err = face(fields[1:])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(faces) == 0 {
+		return nil, fmt.Errorf("no faces")
+	}
+
+	meshPositions := make([]Vector3f, len(corners))
+	var meshNormals []Vector3f
+	var meshUVs [][2]float64
+	if hasNormals {
+		meshNormals = make([]Vector3f, len(corners))
+	}
+	if hasUVs {
+		meshUVs = make([][2]float64, len(corners))
+	}
+	for i, c := range corners {
+		meshPositions[i] = positions[c.v]
+		if hasNormals {
+			meshNormals[i] = normals[c.vn]
+		}
+		if hasUVs {
+			meshUVs[i] = uvs[c.vt]
+		}
+	}
+	return NewMesh(meshPositions, meshNormals, meshUVs, faces, material), nil
+}
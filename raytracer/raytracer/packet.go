@@ -0,0 +1,221 @@
+package raytracer
+
+import (
+	"math"
+	"math/bits"
+)
+
+// PacketSize is the number of rays traced together in a RayPacket
+const PacketSize = 8
+
+// RayPacket holds up to PacketSize rays as a structure of arrays, so each
+// step of intersecting them is a tight loop over one array (which the cpu
+// can pipeline, and keep in cache), and the BVH is walked once for them all
+// packets pay off for coherent rays (like camera rays through neighbouring
+// pixels) which mostly visit the same nodes; incoherent rays should be traced
+// one at a time
+type RayPacket struct {
+	OriginX, OriginY, OriginZ [PacketSize]float64
+	DirX, DirY, DirZ          [PacketSize]float64 // normalised
+	InvX, InvY, InvZ          [PacketSize]float64 // 1 / direction
+	Time                      [PacketSize]float64
+	Count                     int // rays in use, the first Count lanes
+
+	stats *RenderStats
+}
+
+// Set fills the packet with rays (at most PacketSize)
+func (p *RayPacket) Set(rays []Ray) {
+	p.Count = len(rays)
+	p.stats = nil
+	for i, r := range rays {
+		p.OriginX[i], p.OriginY[i], p.OriginZ[i] = r.Origin.X, r.Origin.Y, r.Origin.Z
+		p.DirX[i], p.DirY[i], p.DirZ[i] = r.Direction.X, r.Direction.Y, r.Direction.Z
+		p.InvX[i], p.InvY[i], p.InvZ[i] = 1/r.Direction.X, 1/r.Direction.Y, 1/r.Direction.Z
+		p.Time[i] = r.Time
+		if r.stats != nil {
+			p.stats = r.stats
+		}
+	}
+}
+
+// Ray returns ray i of the packet
+func (p *RayPacket) Ray(i int) Ray {
+	return Ray{
+		Origin:    Vector3f{X: p.OriginX[i], Y: p.OriginY[i], Z: p.OriginZ[i]},
+		Direction: Vector3f{X: p.DirX[i], Y: p.DirY[i], Z: p.DirZ[i]},
+		Time:      p.Time[i],
+		stats:     p.stats,
+	}
+}
+
+// mask returns the bits of the lanes in use
+func (p *RayPacket) mask() uint8 {
+	return uint8(1<<p.Count - 1)
+}
+
+// PacketHit is one ray's result from intersecting a packet
+type PacketHit struct {
+	T   float64
+	Hit Hit
+	OK  bool
+}
+
+// packetShape is a shape that can intersect a packet of rays at once
+// (shapes that can't are intersected with each ray in turn)
+type packetShape interface {
+	// intersectPacket tests the lanes in mask, recording the hits nearer than
+	// their tMax (and lowering it to them)
+	intersectPacket(p *RayPacket, mask uint8, tMax *[PacketSize]float64, hits *[PacketSize]PacketHit)
+}
+
+// intersectPacket intersects a shape with the lanes in mask, as a packet if
+// it can be, or each ray in turn
+func intersectPacket(s Shape, p *RayPacket, mask uint8, tMax *[PacketSize]float64, hits *[PacketSize]PacketHit) {
+	if p.stats != nil {
+		p.stats.ShapeTests += int64(bits.OnesCount8(mask))
+	}
+	if ps, ok := s.(packetShape); ok {
+		ps.intersectPacket(p, mask, tMax, hits)
+		return
+	}
+	for ; mask != 0; mask &= mask - 1 {
+		i := bits.TrailingZeros8(mask)
+		if t, hit, ok := s.Intersect(p.Ray(i), tMax[i]); ok {
+			tMax[i] = t
+			hits[i] = PacketHit{T: t, Hit: hit, OK: true}
+		}
+	}
+}
+
+// the same sums as RayIntersect, lane by lane, so packets find exactly the
+// same hits as single rays
+func (s *Sphere) intersectPacket(p *RayPacket, mask uint8, tMax *[PacketSize]float64, hits *[PacketSize]PacketHit) {
+	r2 := s.Radius * s.Radius
+	var ts [PacketSize]float64
+	for i := 0; i < PacketSize; i++ {
+		lx, ly, lz := s.Centre.X-p.OriginX[i], s.Centre.Y-p.OriginY[i], s.Centre.Z-p.OriginZ[i]
+		tca := p.DirX[i]*lx + p.DirY[i]*ly + p.DirZ[i]*lz
+		d2 := (lx*lx + ly*ly + lz*lz) - tca*tca
+		t := -1.0
+		if d2 <= r2 {
+			thc := math.Sqrt(r2 - d2)
+			t = tca - thc
+			if t < 0 {
+				t = tca + thc
+			}
+		}
+		ts[i] = t
+	}
+	for ; mask != 0; mask &= mask - 1 {
+		i := bits.TrailingZeros8(mask)
+		if t := ts[i]; t > 0 && t < tMax[i] {
+			tMax[i] = t
+			point := Vector3f{X: p.OriginX[i], Y: p.OriginY[i], Z: p.OriginZ[i]}.Add(Vector3f{X: p.DirX[i], Y: p.DirY[i], Z: p.DirZ[i]}.Multiply(t))
+			hits[i] = PacketHit{T: t, Hit: s.SurfaceAt(point), OK: true}
+		}
+	}
+}
+
+func (o sceneObject) intersectPacket(p *RayPacket, mask uint8, tMax *[PacketSize]float64, hits *[PacketSize]PacketHit) {
+	ps, ok := o.Shape.(packetShape)
+	if !ok {
+		for ; mask != 0; mask &= mask - 1 {
+			i := bits.TrailingZeros8(mask)
+			if t, hit, ok := o.Intersect(p.Ray(i), tMax[i]); ok {
+				tMax[i] = t
+				hits[i] = PacketHit{T: t, Hit: hit, OK: true}
+			}
+		}
+		return
+	}
+	// tag the lanes the shape hit (the ones whose tMax came down)
+	before := *tMax
+	ps.intersectPacket(p, mask, tMax, hits)
+	for ; mask != 0; mask &= mask - 1 {
+		if i := bits.TrailingZeros8(mask); tMax[i] != before[i] {
+			hits[i].Hit.Object = o.id
+		}
+	}
+}
+
+// boxMask returns which of the lanes in mask hit the box before their tMax
+// (the slab test of AABB.RayIntersect, lane by lane)
+func (b AABB) boxMask(p *RayPacket, mask uint8, tMax *[PacketSize]float64) uint8 {
+	var hit uint8
+	for i := 0; i < PacketSize; i++ {
+		near, far := 0.0, tMax[i]
+		near, far = slab(b.Min.X, b.Max.X, p.OriginX[i], p.InvX[i], near, far)
+		near, far = slab(b.Min.Y, b.Max.Y, p.OriginY[i], p.InvY[i], near, far)
+		near, far = slab(b.Min.Z, b.Max.Z, p.OriginZ[i], p.InvZ[i], near, far)
+		if far >= near {
+			hit |= 1 << i
+		}
+	}
+	return hit & mask
+}
+
+// slab narrows [near, far] to where a ray is between min and max along one axis
+func slab(min, max, origin, inv, near, far float64) (float64, float64) {
+	t0, t1 := (min-origin)*inv, (max-origin)*inv
+	if inv < 0 {
+		t0, t1 = t1, t0
+	}
+	// written so NaNs (0 * inf, for rays in the slab plane) don't cull the box
+	if t0 > near {
+		near = t0
+	}
+	if t1 < far {
+		far = t1
+	}
+	return near, far
+}
+
+// IntersectPacket is Intersect for each ray of the packet, walking the
+// hierarchy once for them all: hits[i] is ray i's nearest hit closer than tMax
+func (b *BVH) IntersectPacket(p *RayPacket, tMax float64, hits *[PacketSize]PacketHit) {
+	var limits [PacketSize]float64
+	for i := range limits {
+		limits[i] = tMax
+		hits[i] = PacketHit{}
+	}
+	all := p.mask()
+
+	for _, s := range b.unbounded {
+		intersectPacket(s, p, all, &limits, hits)
+	}
+	if len(b.nodes) == 0 {
+		return
+	}
+
+	var stack [64]int
+	sp := 0
+	stack[sp] = 0
+	sp++
+	for sp > 0 {
+		sp--
+		idx := stack[sp]
+		node := &b.nodes[idx]
+		if p.stats != nil {
+			p.stats.BoxTests += int64(p.Count)
+		}
+		mask := node.bounds.boxMask(p, all, &limits)
+		if mask == 0 {
+			continue
+		}
+		if node.count > 0 {
+			for _, s := range b.shapes[node.start : node.start+node.count] {
+				intersectPacket(s, p, mask, &limits, hits)
+			}
+			continue
+		}
+		// the left child immediately follows its parent
+		stack[sp], stack[sp+1] = node.right, idx+1
+		sp += 2
+	}
+}
+
+// IntersectPacket is Intersect for each ray of the packet (see BVH.IntersectPacket)
+func (s *Scene) IntersectPacket(p *RayPacket, tMax float64, hits *[PacketSize]PacketHit) {
+	s.bvh().IntersectPacket(p, tMax, hits)
+}
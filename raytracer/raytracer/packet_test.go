@@ -0,0 +1,137 @@
+package raytracer
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"testing"
+	"time"
+)
+
+// sphereGrid is a scene of many small spheres (plus a floor and a box, which
+// aren't traced as packets), for packets to pay off in
+func sphereGrid() (*Scene, *Camera) {
+	scene := &Scene{
+		EnvMap: gradientEnvMap(),
+		Lights: []*Light{{Position: Vector3f{X: -10, Y: 20, Z: 10}, Intensity: 1.5}},
+		Planes: []*Plane{{Point: Vector3f{Y: -4}, Normal: Vector3f{Y: 1}, Material: RedRubber}},
+		Shapes: []Shape{&Box{Min: Vector3f{X: -1, Y: -4, Z: -9}, Max: Vector3f{X: 1, Y: -2, Z: -7}, Material: Ivory}},
+	}
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 8; y++ {
+			for z := 0; z < 4; z++ {
+				scene.Spheres = append(scene.Spheres, &Sphere{
+					Centre:   Vector3f{X: float64(x-8) * 1.5, Y: float64(y-4) * 1.5, Z: -20 - float64(z)*3},
+					Radius:   0.5,
+					Material: Ivory,
+				})
+			}
+		}
+	}
+	return scene, &Camera{FOV: math.Pi / 3}
+}
+
+func TestPacketMatchesScalar(t *testing.T) {
+	scene, camera := sphereGrid()
+	var packet RayPacket
+	var hits [PacketSize]PacketHit
+
+	for i := 0; i < 64; i += 3 {
+		for j := 0; j < 48; j += PacketSize {
+			// coherent camera rays, and incoherent ones (every which way, and short)
+			var rays []Ray
+			for k := 0; k < PacketSize && j+k < 48; k++ {
+				rays = append(rays, camera.Ray(i, j+k, 64, 48, 0))
+			}
+			if i%2 == 0 {
+				for k := range rays {
+					rays[k].Direction = Vector3f{X: math.Sin(float64(k + i)), Y: math.Cos(float64(k * j)), Z: -1}.Normalised()
+				}
+			}
+
+			packet.Set(rays)
+			scene.IntersectPacket(&packet, 30, &hits)
+			for k, ray := range rays {
+				tt, hit, ok := scene.Intersect(ray, 30)
+				got := hits[k]
+				if got.OK != ok || (ok && (got.T != tt || got.Hit.Object != hit.Object || got.Hit.Normal != hit.Normal)) {
+					t.Fatalf("ray %v: packet hit %v, %v (object %v), want %v, %v (object %v)", ray, got.T, got.OK, got.Hit.Object, tt, ok, hit.Object)
+				}
+			}
+		}
+	}
+}
+
+func TestRenderPackets(t *testing.T) {
+	render := func(packets bool, scene *Scene, camera *Camera) []byte {
+		passes := NewPasses(33, 21, AOVObjectID)
+		img := image.NewNRGBA(image.Rect(0, 0, 33, 21))
+		renderPasses(img, 33, 21, camera, scene, passes, renderOptions{packets: packets})
+		return img.Pix
+	}
+
+	scene, camera := sphereGrid()
+	camera.Samples = 2
+	if a, b := render(true, scene, camera), render(false, scene, camera); !bytes.Equal(a, b) {
+		t.Errorf("packets rendered the grid differently")
+	}
+	scene, camera = benchScene()
+	if a, b := render(true, scene, camera), render(false, scene, camera); !bytes.Equal(a, b) {
+		t.Errorf("packets rendered the demo differently")
+	}
+}
+
+// benchmarkIntersect intersects camera rays through every pixel of a 160x120
+// image, reporting the time per ray
+func benchmarkIntersect(b *testing.B, packets bool) {
+	scene, camera := sphereGrid()
+	const width, height = 160, 120
+	var rays []Ray
+	for i := 0; i < width; i++ {
+		for j := 0; j < height; j++ {
+			rays = append(rays, camera.Ray(i, j, width, height, 0))
+		}
+	}
+	scene.Intersect(rays[0], 1000) // (build the bvh)
+
+	var packet RayPacket
+	var hits [PacketSize]PacketHit
+	b.ResetTimer()
+	began := time.Now()
+	for n := 0; n < b.N; n++ {
+		if packets {
+			for i := 0; i < len(rays); i += PacketSize {
+				packet.Set(rays[i : i+PacketSize])
+				scene.IntersectPacket(&packet, 1000, &hits)
+			}
+		} else {
+			for _, ray := range rays {
+				scene.Intersect(ray, 1000)
+			}
+		}
+	}
+	b.ReportMetric(float64(time.Since(began).Nanoseconds())/float64(b.N*len(rays)), "ns/ray")
+}
+
+func BenchmarkIntersectScalar(b *testing.B) { benchmarkIntersect(b, false) }
+func BenchmarkIntersectPacket(b *testing.B) { benchmarkIntersect(b, true) }
+
+// BenchmarkRenderPackets compares whole renders, where packets make little
+// difference: their speedup (see BenchmarkIntersectPacket) is in intersecting
+// camera rays, which is only a small part of rendering next to shading and
+// the secondary and shadow rays (which are still traced one by one)
+func BenchmarkRenderPackets(b *testing.B) {
+	for _, packets := range []bool{false, true} {
+		name := "scalar"
+		if packets {
+			name = "packet"
+		}
+		b.Run(name, func(b *testing.B) {
+			img := image.NewNRGBA(image.Rect(0, 0, 160, 120))
+			for i := 0; i < b.N; i++ {
+				scene, camera := sphereGrid()
+				renderPasses(img, 160, 120, camera, scene, nil, renderOptions{packets: packets})
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package raytracer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// EncodePFM writes img as a portable float map: rgb, or greyscale (from X)
+// if grey is set
+func EncodePFM(w io.Writer, img *FloatImage, grey bool) error {
+	bw := bufio.NewWriter(w)
+
+	kind := "PF"
+	if grey {
+		kind = "Pf"
+	}
+	// a negative scale means little endian
+	fmt.Fprintf(bw, "%s\n%d %d\n-1.0\n", kind, img.Width, img.Height)
+
+	// rows run from the bottom up
+	var b [4]byte
+	for y := img.Height - 1; y >= 0; y-- {
+		for x := 0; x < img.Width; x++ {
+			v := img.At(x, y)
+			for c, value := range [3]float64{v.X, v.Y, v.Z} {
+				if grey && c > 0 {
+					break
+				}
+				binary.LittleEndian.PutUint32(b[:], math.Float32bits(float32(value)))
+				bw.Write(b[:])
+			}
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,149 @@
+package raytracer
+
+import "math"
+
+// polynomial root finding for analytic shapes
+// (after Jochen Schwarze, "Cubic and Quartic Roots", Graphics Gems I)
+
+const polyEpsilon = 1e-9
+
+func isZero(x float64) bool {
+	return math.Abs(x) < polyEpsilon
+}
+
+// solveQuadratic returns the real roots of ax^2 + bx + c = 0 in ascending order
+func solveQuadratic(a, b, c float64) (roots [2]float64, n int) {
+	if isZero(a) {
+		if isZero(b) {
+			return roots, 0
+		}
+		roots[0] = -c / b
+		return roots, 1
+	}
+
+	disc := b*b - 4*a*c
+	if disc < 0 {
+		return roots, 0
+	}
+
+	// avoid cancellation between -b and sqrt(disc)
+	q := -0.5 * (b + math.Copysign(math.Sqrt(disc), b))
+	r0, r1 := q/a, c/q
+	if q == 0 {
+		r1 = r0
+	}
+	if r0 > r1 {
+		r0, r1 = r1, r0
+	}
+	roots[0], roots[1] = r0, r1
+	return roots, 2
+}
+
+// solveCubic returns the real roots of ax^3 + bx^2 + cx + d = 0 (a must be non-zero)
+func solveCubic(a, b, c, d float64) (roots [3]float64, n int) {
+	A, B, C := b/a, c/a, d/a
+
+	// substitute x = y - A/3 to eliminate the quadratic term: y^3 + 3py + 2q = 0
+	sqA := A * A
+	p := (-sqA/3 + B) / 3
+	q := (2.0/27*A*sqA - A*B/3 + C) / 2
+	cbP := p * p * p
+	D := q*q + cbP
+
+	if isZero(D) {
+		if isZero(q) {
+			// one triple root
+			n = 1
+		} else {
+			// one single and one double root
+			u := math.Cbrt(-q)
+			roots[0], roots[1] = 2*u, -u
+			n = 2
+		}
+	} else if D < 0 {
+		// three real roots
+		phi := math.Acos(-q/math.Sqrt(-cbP)) / 3
+		t := 2 * math.Sqrt(-p)
+		roots[0] = t * math.Cos(phi)
+		roots[1] = -t * math.Cos(phi+math.Pi/3)
+		roots[2] = -t * math.Cos(phi-math.Pi/3)
+		n = 3
+	} else {
+		// one real root
+		sqrtD := math.Sqrt(D)
+		roots[0] = math.Cbrt(sqrtD-q) - math.Cbrt(sqrtD+q)
+		n = 1
+	}
+
+	for i := 0; i < n; i++ {
+		roots[i] -= A / 3
+	}
+	return roots, n
+}
+
+// solveQuartic returns the real roots of ax^4 + bx^3 + cx^2 + dx + e = 0
+// (a must be non-zero), unordered
+func solveQuartic(a, b, c, d, e float64) (roots [4]float64, n int) {
+	A, B, C, D := b/a, c/a, d/a, e/a
+
+	// substitute x = y - A/4 to eliminate the cubic term: y^4 + py^2 + qy + r = 0
+	sqA := A * A
+	p := -3.0/8*sqA + B
+	q := 1.0/8*sqA*A - A*B/2 + C
+	r := -3.0/256*sqA*sqA + sqA*B/16 - A*C/4 + D
+
+	if isZero(r) {
+		// no absolute term: y(y^3 + py + q) = 0
+		cubic, m := solveCubic(1, 0, p, q)
+		copy(roots[:], cubic[:m])
+		roots[m] = 0
+		n = m + 1
+	} else {
+		// solve the resolvent cubic, and take one real root
+		cubic, _ := solveCubic(1, -p/2, -r, r*p/2-q*q/8)
+		z := cubic[0]
+
+		// to build two quadratics
+		u := z*z - r
+		v := 2*z - p
+		if isZero(u) {
+			u = 0
+		} else if u > 0 {
+			u = math.Sqrt(u)
+		} else {
+			return roots, 0
+		}
+		if isZero(v) {
+			v = 0
+		} else if v > 0 {
+			v = math.Sqrt(v)
+		} else {
+			return roots, 0
+		}
+		if q < 0 {
+			v = -v
+		}
+
+		q1, m1 := solveQuadratic(1, v, z-u)
+		q2, m2 := solveQuadratic(1, -v, z+u)
+		copy(roots[:], q1[:m1])
+		copy(roots[m1:], q2[:m2])
+		n = m1 + m2
+	}
+
+	for i := 0; i < n; i++ {
+		x := roots[i] - A/4
+
+		// polish with a couple of newton steps, the closed form loses precision
+		for j := 0; j < 2; j++ {
+			f := (((a*x+b)*x+c)*x+d)*x + e
+			df := ((4*a*x+3*b)*x+2*c)*x + d
+			if df == 0 {
+				break
+			}
+			x -= f / df
+		}
+		roots[i] = x
+	}
+	return roots, n
+}
@@ -0,0 +1,60 @@
+package raytracer
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestSolveQuadratic(t *testing.T) {
+	roots, n := solveQuadratic(1, -3, 2) // (x-1)(x-2)
+	if n != 2 || !near(roots[0], 1) || !near(roots[1], 2) {
+		t.Errorf("roots = %v (%d), want [1 2]", roots[:n], n)
+	}
+	if _, n := solveQuadratic(1, 0, 1); n != 0 {
+		t.Errorf("x^2 + 1 has %d real roots, want 0", n)
+	}
+}
+
+func TestSolveQuartic(t *testing.T) {
+	cases := []struct {
+		name  string
+		roots []float64
+	}{
+		{"four distinct", []float64{-3, -1, 0.5, 2}},
+		{"double roots", []float64{1, 1, 4, 4}},
+		{"zero root", []float64{0, 1, 2, 3}},
+		{"wide range", []float64{-100, 0.01, 1, 50}},
+	}
+	for _, c := range cases {
+		// expand (x-a)(x-b)(x-c)(x-d)
+		a, b, cc, d := c.roots[0], c.roots[1], c.roots[2], c.roots[3]
+		coeffs := [5]float64{
+			1,
+			-(a + b + cc + d),
+			a*b + a*cc + a*d + b*cc + b*d + cc*d,
+			-(a*b*cc + a*b*d + a*cc*d + b*cc*d),
+			a * b * cc * d,
+		}
+		roots, n := solveQuartic(coeffs[0], coeffs[1], coeffs[2], coeffs[3], coeffs[4])
+		got := append([]float64(nil), roots[:n]...)
+		sort.Float64s(got)
+
+		// double roots may come back once or twice, so check each expected root is found
+		for _, want := range c.roots {
+			found := false
+			for _, r := range got {
+				if abs := r - want; abs < 1e-4 && abs > -1e-4 {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("%s: roots = %v, missing %v", c.name, got, want)
+			}
+		}
+	}
+
+	// x^4 + 1 has no real roots
+	if _, n := solveQuartic(1, 0, 0, 0, 1); n != 0 {
+		t.Errorf("x^4 + 1 has %d real roots, want 0", n)
+	}
+}
@@ -0,0 +1,390 @@
+package raytracer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Effect is a post-processing step on a (linear, unclamped) colour image
+type Effect interface {
+	Apply(img *FloatImage) *FloatImage
+}
+
+// PostStack is a list of effects, applied in order
+type PostStack []Effect
+
+func (p PostStack) Apply(img *FloatImage) *FloatImage {
+	for _, e := range p {
+		img = e.Apply(img)
+	}
+	return img
+}
+
+// Bloom adds a glow around anything brighter than Threshold
+type Bloom struct {
+	Threshold float64 // brightness that starts to glow
+	Intensity float64 // how much of the glow is added
+	Radius    float64 // size of the glow, as a fraction of the image height
+}
+
+func (b Bloom) Apply(img *FloatImage) *FloatImage {
+	bright := NewFloatImage(img.Width, img.Height)
+	for i, c := range img.Pix {
+		bright.Pix[i] = Vector3f{
+			X: math.Max(0, c.X-b.Threshold),
+			Y: math.Max(0, c.Y-b.Threshold),
+			Z: math.Max(0, c.Z-b.Threshold),
+		}
+	}
+	glow := gaussianBlur(bright, b.Radius*float64(img.Height))
+
+	out := NewFloatImage(img.Width, img.Height)
+	for i, c := range img.Pix {
+		out.Pix[i] = c.Add(glow.Pix[i].Multiply(b.Intensity))
+	}
+	return out
+}
+
+// gaussianBlur blurs img with a gaussian of standard deviation sigma (in pixels)
+func gaussianBlur(img *FloatImage, sigma float64) *FloatImage {
+	if sigma <= 0 {
+		return img
+	}
+	radius := int(math.Ceil(3 * sigma))
+	kernel := make([]float64, 2*radius+1)
+	total := 0.0
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		total += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= total
+	}
+
+	// separably, across then down (clamping at the edges)
+	across := mapPixels(img, func(x, y int) Vector3f {
+		var sum Vector3f
+		for i, k := range kernel {
+			sum = sum.Add(img.At(clampInt(x+i-radius, 0, img.Width-1), y).Multiply(k))
+		}
+		return sum
+	})
+	return mapPixels(across, func(x, y int) Vector3f {
+		var sum Vector3f
+		for i, k := range kernel {
+			sum = sum.Add(across.At(x, clampInt(y+i-radius, 0, img.Height-1)).Multiply(k))
+		}
+		return sum
+	})
+}
+
+// mapPixels returns an image the size of img, with each pixel from f (a row per goroutine)
+func mapPixels(img *FloatImage, f func(x, y int) Vector3f) *FloatImage {
+	out := NewFloatImage(img.Width, img.Height)
+	var wg sync.WaitGroup
+	for y := 0; y < img.Height; y++ {
+		wg.Add(1)
+		go func(y int) {
+			defer wg.Done()
+			for x := 0; x < img.Width; x++ {
+				out.Set(x, y, f(x, y))
+			}
+		}(y)
+	}
+	wg.Wait()
+	return out
+}
+
+// imageRadius returns where pixel (x, y) is relative to the centre of the
+// image, scaled so the corners are at distance 1
+func imageRadius(img *FloatImage, x, y float64) (float64, float64) {
+	cx, cy := float64(img.Width)/2, float64(img.Height)/2
+	diagonal := math.Hypot(cx, cy)
+	return (x - cx) / diagonal, (y - cy) / diagonal
+}
+
+// Vignette darkens the image towards its corners
+type Vignette struct {
+	Strength float64 // how much darker the corners are (0 to 1)
+}
+
+func (v Vignette) Apply(img *FloatImage) *FloatImage {
+	return mapPixels(img, func(x, y int) Vector3f {
+		dx, dy := imageRadius(img, float64(x)+0.5, float64(y)+0.5)
+		// (smoothly, falling off with the square of the distance)
+		f := 1 - v.Strength*(dx*dx+dy*dy)
+		return img.At(x, y).Multiply(math.Max(0, f))
+	})
+}
+
+// LensDistortion bends straight lines, as a real lens does: positive K1
+// bulges them out (barrel), negative pinches them in (pincushion)
+type LensDistortion struct {
+	K1, K2 float64 // radial distortion coefficients
+}
+
+func (l LensDistortion) Apply(img *FloatImage) *FloatImage {
+	return mapPixels(img, func(x, y int) Vector3f {
+		return img.Sample(distort(img, float64(x)+0.5, float64(y)+0.5, func(r2 float64) float64 {
+			return 1 + l.K1*r2 + l.K2*r2*r2
+		}))
+	})
+}
+
+// ChromaticAberration splits colours towards the edge of the image, as a
+// lens that doesn't focus all wavelengths together does
+type ChromaticAberration struct {
+	Amount float64 // how far apart red and blue are at the corners, as a fraction of the distance from the centre
+}
+
+func (c ChromaticAberration) Apply(img *FloatImage) *FloatImage {
+	return mapPixels(img, func(x, y int) Vector3f {
+		px, py := float64(x)+0.5, float64(y)+0.5
+		red := img.Sample(distort(img, px, py, func(float64) float64 { return 1 - c.Amount/2 }))
+		green := img.At(x, y)
+		blue := img.Sample(distort(img, px, py, func(float64) float64 { return 1 + c.Amount/2 }))
+		return Vector3f{X: red.X, Y: green.Y, Z: blue.Z}
+	})
+}
+
+// distort returns where to sample for pixel (x, y) of img, scaling its
+// distance from the centre by scale(squared distance)
+func distort(img *FloatImage, x, y float64, scale func(r2 float64) float64) (float64, float64) {
+	dx, dy := imageRadius(img, x, y)
+	s := scale(dx*dx + dy*dy)
+	cx, cy := float64(img.Width)/2, float64(img.Height)/2
+	return cx + (x-cx)*s, cy + (y-cy)*s
+}
+
+// FilmGrain adds noise, as the grain of photographic film
+type FilmGrain struct {
+	Amount float64 // standard deviation of the noise (scaled by the square root of the brightness)
+	Seed   uint32
+}
+
+func (g FilmGrain) Apply(img *FloatImage) *FloatImage {
+	return mapPixels(img, func(x, y int) Vector3f {
+		// the same grain for every channel, scaled so dark areas aren't swamped
+		c := img.At(x, y)
+		n := grainNoise(uint32(x), uint32(y), g.Seed) * g.Amount * math.Sqrt(math.Max(0, luminance(c)))
+		return c.Add(Vector3f{X: n, Y: n, Z: n})
+	})
+}
+
+// grainNoise returns roughly normally distributed noise (mean 0, deviation 1)
+// for a pixel, the same every time
+func grainNoise(x, y, seed uint32) float64 {
+	// sum of uniform numbers (central limit theorem)
+	r := NewRNG(hashKey(uint64(seed)), hashKey(uint64(x), uint64(y)))
+	sum := 0.0
+	for i := 0; i < 4; i++ {
+		sum += r.Float64()
+	}
+	// four uniforms have mean 2 and variance 1/3
+	return (sum - 2) * math.Sqrt(3)
+}
+
+// LUT3D grades colours through a 3D lookup table, such as from a .cube file
+type LUT3D struct {
+	Size                 int
+	Table                []Vector3f // red varying fastest, then green, then blue
+	DomainMin, DomainMax Vector3f   // input colours covered by the table
+}
+
+// LoadCubeLUT reads a 3D lookup table from a .cube file
+func LoadCubeLUT(path string) (*LUT3D, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadCubeLUT(f)
+}
+
+// ReadCubeLUT reads a 3D lookup table in .cube format
+func ReadCubeLUT(r io.Reader) (*LUT3D, error) {
+	lut := &LUT3D{DomainMax: Vector3f{X: 1, Y: 1, Z: 1}}
+	triple := func(fields []string) (Vector3f, error) {
+		if len(fields) != 3 {
+			return Vector3f{}, fmt.Errorf("want 3 values, got %d", len(fields))
+		}
+		var v [3]float64
+		for i, s := range fields {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return Vector3f{}, err
+			}
+			v[i] = f
+		}
+		return Vector3f{X: v[0], Y: v[1], Z: v[2]}, nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		var err error
+		switch fields[0] {
+		case "TITLE":
+		case "LUT_3D_SIZE":
+			if len(fields) != 2 {
+				err = fmt.Errorf("bad size")
+			} else if lut.Size, err = strconv.Atoi(fields[1]); err == nil && lut.Size < 2 {
+				err = fmt.Errorf("size %d is too small", lut.Size)
+			}
+		case "LUT_1D_SIZE":
+			err = fmt.Errorf("1D lookup tables aren't supported")
+		case "DOMAIN_MIN":
+			lut.DomainMin, err = triple(fields[1:])
+		case "DOMAIN_MAX":
+			lut.DomainMax, err = triple(fields[1:])
+		default:
+			var v Vector3f
+			if v, err = triple(fields); err == nil {
+				lut.Table = append(lut.Table, v)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if lut.Size == 0 {
+		return nil, fmt.Errorf("no LUT_3D_SIZE")
+	}
+	if n := lut.Size * lut.Size * lut.Size; len(lut.Table) != n {
+		return nil, fmt.Errorf("%d entries, want %d", len(lut.Table), n)
+	}
+	return lut, nil
+}
+
+func (l *LUT3D) Apply(img *FloatImage) *FloatImage {
+	return mapPixels(img, func(x, y int) Vector3f {
+		return l.Lookup(img.At(x, y))
+	})
+}
+
+// Lookup grades a colour, interpolating between the table's entries
+// (colours outside the domain are clamped to it)
+func (l *LUT3D) Lookup(c Vector3f) Vector3f {
+	n := float64(l.Size - 1)
+	var idx [3]int
+	var frac [3]float64
+	for a := 0; a < 3; a++ {
+		lo, hi := axis(l.DomainMin, a), axis(l.DomainMax, a)
+		f := (axis(c, a) - lo) / (hi - lo) * n
+		f = math.Max(0, math.Min(n, f))
+		i := math.Min(math.Floor(f), n-1)
+		idx[a], frac[a] = int(i), f-i
+	}
+
+	at := func(r, g, b int) Vector3f {
+		return l.Table[(b*l.Size+g)*l.Size+r]
+	}
+	r, g, b := idx[0], idx[1], idx[2]
+	fr, fg, fb := frac[0], frac[1], frac[2]
+	// trilinear interpolation
+	c00 := at(r, g, b).Lerp(at(r+1, g, b), fr)
+	c10 := at(r, g+1, b).Lerp(at(r+1, g+1, b), fr)
+	c01 := at(r, g, b+1).Lerp(at(r+1, g, b+1), fr)
+	c11 := at(r, g+1, b+1).Lerp(at(r+1, g+1, b+1), fr)
+	return c00.Lerp(c10, fg).Lerp(c01.Lerp(c11, fg), fb)
+}
+
+// ParsePostStack parses effects from render settings, separated by
+// semicolons, each a name with optional parameters:
+//
+//	bloom:threshold=1,intensity=0.3,radius=0.02; vignette:strength=0.5; lut:file=grade.cube
+//
+// effects are bloom (threshold, intensity, radius), vignette (strength),
+// distortion (k1, k2), aberration (amount), grain (amount, seed) and lut (file)
+func ParsePostStack(spec string) (PostStack, error) {
+	var stack PostStack
+	for _, item := range strings.Split(spec, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, paramList, _ := strings.Cut(item, ":")
+		params := make(map[string]string)
+		for _, p := range strings.Split(paramList, ",") {
+			if p = strings.TrimSpace(p); p == "" {
+				continue
+			}
+			k, v, ok := strings.Cut(p, "=")
+			if !ok {
+				return nil, fmt.Errorf("%s: parameter %q has no value", name, p)
+			}
+			params[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+
+		effect, err := parseEffect(strings.TrimSpace(name), params)
+		if err != nil {
+			return nil, err
+		}
+		stack = append(stack, effect)
+	}
+	return stack, nil
+}
+
+func parseEffect(name string, params map[string]string) (Effect, error) {
+	// number takes a parameter (removing it, so leftovers can be reported)
+	var err error
+	number := func(key string, def float64) float64 {
+		s, ok := params[key]
+		if !ok {
+			return def
+		}
+		delete(params, key)
+		v, e := strconv.ParseFloat(s, 64)
+		if e != nil && err == nil {
+			err = fmt.Errorf("%s: bad %s %q", name, key, s)
+		}
+		return v
+	}
+
+	var effect Effect
+	switch name {
+	case "bloom":
+		effect = Bloom{Threshold: number("threshold", 1), Intensity: number("intensity", 0.3), Radius: number("radius", 0.02)}
+	case "vignette":
+		effect = Vignette{Strength: number("strength", 0.5)}
+	case "distortion":
+		effect = LensDistortion{K1: number("k1", 0.1), K2: number("k2", 0)}
+	case "aberration":
+		effect = ChromaticAberration{Amount: number("amount", 0.01)}
+	case "grain":
+		effect = FilmGrain{Amount: number("amount", 0.02), Seed: uint32(number("seed", 0))}
+	case "lut":
+		path, ok := params["file"]
+		if !ok {
+			return nil, fmt.Errorf("lut: no file")
+		}
+		delete(params, "file")
+		lut, e := LoadCubeLUT(path)
+		if e != nil {
+			return nil, fmt.Errorf("lut: %w", e)
+		}
+		effect = lut
+	default:
+		return nil, fmt.Errorf("unknown effect %q", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for key := range params {
+		return nil, fmt.Errorf("%s: unknown parameter %q", name, key)
+	}
+	return effect, nil
+}
@@ -0,0 +1,168 @@
+package raytracer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func flatImage(width, height int, c Vector3f) *FloatImage {
+	img := NewFloatImage(width, height)
+	for i := range img.Pix {
+		img.Pix[i] = c
+	}
+	return img
+}
+
+func TestBloom(t *testing.T) {
+	img := flatImage(21, 21, Vector3f{X: 0.5, Y: 0.5, Z: 0.5})
+	img.Set(10, 10, Vector3f{X: 50, Y: 50, Z: 50})
+	out := Bloom{Threshold: 1, Intensity: 1, Radius: 0.1}.Apply(img)
+
+	if c := out.At(12, 10); c.X <= 0.5 {
+		t.Errorf("no glow next to a bright pixel: %v", c)
+	}
+	if c := out.At(0, 0); !nearVec(c, img.At(0, 0)) {
+		t.Errorf("glow reached the corner: %v", c)
+	}
+	// the glow is spread out, not added to
+	total := 0.0
+	for i := range out.Pix {
+		total += out.Pix[i].X - img.Pix[i].X
+	}
+	if !near(total, 49) {
+		t.Errorf("bloom added %v, want 49", total)
+	}
+}
+
+func TestVignette(t *testing.T) {
+	img := flatImage(11, 11, Vector3f{X: 1, Y: 1, Z: 1})
+	out := Vignette{Strength: 0.5}.Apply(img)
+	if c := out.At(5, 5).X; !near(c, 1) {
+		t.Errorf("centre = %v, want 1", c)
+	}
+	if c := out.At(0, 0).X; c > 0.6 || c < 0.5 {
+		t.Errorf("corner = %v, want about 0.5", c)
+	}
+}
+
+func TestLensEffects(t *testing.T) {
+	// a gradient across the image
+	img := NewFloatImage(16, 8)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			v := float64(x)
+			img.Set(x, y, Vector3f{X: v, Y: v, Z: v})
+		}
+	}
+
+	// no distortion changes nothing
+	same := LensDistortion{}.Apply(img)
+	for i := range img.Pix {
+		if !nearVec(same.Pix[i], img.Pix[i]) {
+			t.Fatalf("pixel %d changed: %v, was %v", i, same.Pix[i], img.Pix[i])
+		}
+	}
+	// barrel distortion pulls the edges in, so the right edge shows what was further out
+	if barrel := (LensDistortion{K1: 0.3}).Apply(img); barrel.At(12, 4).X <= img.At(12, 4).X {
+		t.Errorf("barrel distortion at (12, 4) = %v, want more than %v", barrel.At(12, 4).X, img.At(12, 4).X)
+	}
+
+	split := ChromaticAberration{Amount: 0.2}.Apply(img)
+	c := split.At(14, 4)
+	if c.Y != img.At(14, 4).Y || c.X >= c.Y || c.Z <= c.Y {
+		t.Errorf("aberration at the right edge = %v, want red < green < blue", c)
+	}
+}
+
+func TestFilmGrain(t *testing.T) {
+	img := flatImage(64, 64, Vector3f{X: 0.25, Y: 0.25, Z: 0.25})
+	a := FilmGrain{Amount: 0.1, Seed: 3}.Apply(img)
+	b := FilmGrain{Amount: 0.1, Seed: 3}.Apply(img)
+
+	sum, sumSq := 0.0, 0.0
+	for i := range a.Pix {
+		if a.Pix[i] != b.Pix[i] {
+			t.Fatalf("grain isn't the same each time")
+		}
+		n := a.Pix[i].X - 0.25
+		sum += n
+		sumSq += n * n
+	}
+	mean := sum / float64(len(a.Pix))
+	deviation := math.Sqrt(sumSq/float64(len(a.Pix)) - mean*mean)
+	// 0.1 * sqrt(0.25)
+	if math.Abs(mean) > 0.005 || math.Abs(deviation-0.05) > 0.005 {
+		t.Errorf("grain mean %v, deviation %v, want 0, 0.05", mean, deviation)
+	}
+}
+
+// cube returns a .cube file of size n applying f
+func cube(n int, f func(r, g, b float64) (float64, float64, float64)) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# test\nTITLE \"test\"\nLUT_3D_SIZE %d\nDOMAIN_MIN 0 0 0\nDOMAIN_MAX 1 1 1\n\n", n)
+	for b := 0; b < n; b++ {
+		for g := 0; g < n; g++ {
+			for r := 0; r < n; r++ {
+				x, y, z := f(float64(r)/float64(n-1), float64(g)/float64(n-1), float64(b)/float64(n-1))
+				fmt.Fprintf(&sb, "%f %f %f\n", x, y, z)
+			}
+		}
+	}
+	return sb.String()
+}
+
+func TestCubeLUT(t *testing.T) {
+	// swaps red and blue, and halves green
+	lut, err := ReadCubeLUT(strings.NewReader(cube(5, func(r, g, b float64) (float64, float64, float64) {
+		return b, g / 2, r
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lut.Lookup(Vector3f{X: 0.1, Y: 0.6, Z: 0.33}); !nearVec(got, Vector3f{X: 0.33, Y: 0.3, Z: 0.1}) {
+		t.Errorf("Lookup = %v, want (0.33, 0.3, 0.1)", got)
+	}
+	// clamped to the domain
+	if got := lut.Lookup(Vector3f{X: 4, Y: -1, Z: 1}); !nearVec(got, Vector3f{X: 1, Y: 0, Z: 1}) {
+		t.Errorf("Lookup out of the domain = %v, want (1, 0, 1)", got)
+	}
+
+	for _, bad := range []string{
+		"LUT_3D_SIZE 2\n0 0 0\n",
+		"0 0 0\n",
+		"LUT_1D_SIZE 16\n",
+		"LUT_3D_SIZE 2\n0 0\n",
+	} {
+		if _, err := ReadCubeLUT(strings.NewReader(bad)); err == nil {
+			t.Errorf("read %q without error", bad)
+		}
+	}
+}
+
+func TestParsePostStack(t *testing.T) {
+	stack, err := ParsePostStack("bloom:threshold=2, intensity=0.5; vignette ;grain:seed=7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PostStack{
+		Bloom{Threshold: 2, Intensity: 0.5, Radius: 0.02},
+		Vignette{Strength: 0.5},
+		FilmGrain{Amount: 0.02, Seed: 7},
+	}
+	if len(stack) != len(want) {
+		t.Fatalf("got %d effects, want %d", len(stack), len(want))
+	}
+	for i := range want {
+		if stack[i] != want[i] {
+			t.Errorf("effect %d = %#v, want %#v", i, stack[i], want[i])
+		}
+	}
+
+	for _, bad := range []string{"sparkle", "bloom:threshold", "bloom:glow=1", "vignette:strength=lots", "lut", "lut:file=/nonexistent.cube"} {
+		if _, err := ParsePostStack(bad); err == nil {
+			t.Errorf("parsed %q without error", bad)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package raytracer
+
+import "math"
+
+// TextureSpace selects which coordinates a procedural texture is evaluated in
+type TextureSpace int
+
+const (
+	ObjectSpace TextureSpace = iota // relative to the shape, so the pattern moves with it
+	WorldSpace                      // fixed in the scene, shapes move through the pattern
+)
+
+// Pattern is a scalar field in 3D, used to drive procedural textures
+type Pattern interface {
+	// Value returns the pattern at p, in [0,1]
+	Value(p Vector3f) float64
+}
+
+// ProceduralTexture colours a surface by mapping a 3D pattern onto a
+// gradient between two colours
+type ProceduralTexture struct {
+	Pattern Pattern
+	ColourA Vector3f // colour where the pattern is 0
+	ColourB Vector3f // colour where the pattern is 1
+	Space   TextureSpace
+	Scale   float64 // pattern frequency, larger is finer (defaults to 1)
+}
+
+func (t *ProceduralTexture) Evaluate(hit Hit) Vector3f {
+	p := hit.Local
+	if t.Space == WorldSpace {
+		p = hit.Point
+	}
+	if t.Scale != 0 {
+		p = p.Multiply(t.Scale)
+	}
+
+	v := clamp01(t.Pattern.Value(p))
+	return t.ColourA.Multiply(1 - v).Add(t.ColourB.Multiply(v))
+}
+
+// NoisePattern is plain noise remapped from [-1,1] to [0,1]
+type NoisePattern struct {
+	Noise Noise3D
+}
+
+func (n NoisePattern) Value(p Vector3f) float64 {
+	return n.Noise.Noise(p)*0.5 + 0.5
+}
+
+// FBMPattern is fractal brownian motion (see FBM), remapped to [0,1]
+type FBMPattern struct {
+	Noise      Noise3D
+	Octaves    int
+	Lacunarity float64 // frequency multiplier per octave (typically 2)
+	Gain       float64 // amplitude multiplier per octave (typically 0.5)
+}
+
+func (f FBMPattern) Value(p Vector3f) float64 {
+	return FBM(f.Noise, p, f.Octaves, f.Lacunarity, f.Gain)*0.5 + 0.5
+}
+
+// TurbulencePattern is turbulence (see Turbulence)
+type TurbulencePattern struct {
+	Noise      Noise3D
+	Octaves    int
+	Lacunarity float64
+	Gain       float64
+}
+
+func (t TurbulencePattern) Value(p Vector3f) float64 {
+	return Turbulence(t.Noise, p, t.Octaves, t.Lacunarity, t.Gain)
+}
+
+// MarblePattern is sine bands along X, distorted by turbulence
+type MarblePattern struct {
+	Noise      Noise3D
+	Frequency  float64 // bands per unit
+	Distortion float64 // how far turbulence pushes the bands
+	Octaves    int
+}
+
+func (m MarblePattern) Value(p Vector3f) float64 {
+	t := Turbulence(m.Noise, p, m.Octaves, 2, 0.5)
+	return 0.5 + 0.5*math.Sin((p.X*m.Frequency+m.Distortion*t)*math.Pi)
+}
+
+// WoodPattern is concentric rings around the Y axis, with noisy grain
+type WoodPattern struct {
+	Noise Noise3D
+	Rings float64 // rings per unit radius
+	Grain float64 // how much noise wobbles the rings
+}
+
+func (w WoodPattern) Value(p Vector3f) float64 {
+	r := math.Sqrt(p.X*p.X+p.Z*p.Z)*w.Rings + w.Grain*w.Noise.Noise(p)
+	return r - math.Floor(r)
+}
+
+// CellularPattern is Worley noise, as the distance to the nearest feature
+// point (F1), or the gap between the nearest two (F2 - F1) for cell edges
+type CellularPattern struct {
+	Noise *Worley
+	Edges bool
+}
+
+func (c CellularPattern) Value(p Vector3f) float64 {
+	f1, f2 := c.Noise.Distances(p)
+	if c.Edges {
+		return math.Min(1, f2-f1)
+	}
+	return math.Min(1, f1)
+}
+
+// CheckerPattern alternates between 0 and 1 in unit cubes
+type CheckerPattern struct{}
+
+func (CheckerPattern) Value(p Vector3f) float64 {
+	if (int(math.Floor(p.X))+int(math.Floor(p.Y))+int(math.Floor(p.Z)))&1 == 0 {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,71 @@
+package raytracer
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"runtime"
+	"sync"
+)
+
+// RenderProgressive is RenderPasses, a sample per pixel at a time: each pass
+// takes the next sample of every pixel, then img (and passes, if not nil) are
+// set to the average of the samples so far and update is called with how many
+// that is, until every pixel has camera.SampleCount samples (so the final image
+// is the same as RenderPasses'), or ctx is done (returning its error)
+//
+// update is called from the goroutine calling RenderProgressive, and img and
+// passes aren't touched while it runs, so it can copy them out
+func RenderProgressive(ctx context.Context, img *image.NRGBA, width, height int, camera *Camera, scene *Scene, passes *Passes, update func(samples int)) error {
+	prepareCamera(camera, scene)
+
+	bounds := img.Bounds().Intersect(image.Rect(0, 0, width, height))
+	pixels := make([]pixelSamples, bounds.Dx()*bounds.Dy())
+	visible := make([]bool, len(pixels))
+	for j := bounds.Min.Y; j < bounds.Max.Y; j++ {
+		for i := bounds.Min.X; i < bounds.Max.X; i++ {
+			visible[(j-bounds.Min.Y)*bounds.Dx()+i-bounds.Min.X] = camera.Visible(i, j, width, height)
+		}
+	}
+
+	// a pass is too short to be worth a goroutine per column, so the columns
+	// are shared out between a goroutine per cpu
+	workers := runtime.GOMAXPROCS(0)
+	for s := 0; s < camera.SampleCount(); s++ {
+		columns := make(chan int, bounds.Dx())
+		for i := bounds.Min.X; i < bounds.Max.X; i++ {
+			columns <- i
+		}
+		close(columns)
+
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range columns {
+					if ctx.Err() != nil {
+						return
+					}
+					for j := bounds.Min.Y; j < bounds.Max.Y; j++ {
+						k := (j-bounds.Min.Y)*bounds.Dx() + i - bounds.Min.X
+						if !visible[k] {
+							img.Set(i, j, color.NRGBA{A: 0xff})
+							continue
+						}
+						p := &pixels[k]
+						aov := p.sample(passes)
+						p.add(castRayAOV(camera.Ray(i, j, width, height, s), scene, 0, aov), aov, passes, camera)
+						p.write(img, i, j, passes, camera)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		update(s + 1)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package raytracer
+
+import "math"
+
+// Quaternion is a rotation (when normalised) as W + Xi + Yj + Zk; unlike
+// euler angles, rotations compose and interpolate without gimbal lock
+type Quaternion struct {
+	W, X, Y, Z float64
+}
+
+// IdentityQuaternion is no rotation
+func IdentityQuaternion() Quaternion {
+	return Quaternion{W: 1}
+}
+
+// AxisAngle returns the rotation by angle (radians, anticlockwise looking
+// down the axis towards the origin) around axis
+func AxisAngle(axis Vector3f, angle float64) Quaternion {
+	axis = axis.Normalised()
+	s := math.Sin(angle / 2)
+	return Quaternion{W: math.Cos(angle / 2), X: axis.X * s, Y: axis.Y * s, Z: axis.Z * s}
+}
+
+// EulerQuaternion returns the rotation about x, then y, then z (radians), as
+// RotateX(x).Then(RotateY(y)).Then(RotateZ(z))
+func EulerQuaternion(x, y, z float64) Quaternion {
+	return AxisAngle(Vector3f{Z: 1}, z).Multiply(AxisAngle(Vector3f{Y: 1}, y)).Multiply(AxisAngle(Vector3f{X: 1}, x))
+}
+
+// Multiply returns the hamilton product q * r, which rotates by r then q
+func (q Quaternion) Multiply(r Quaternion) Quaternion {
+	return Quaternion{
+		W: q.W*r.W - q.X*r.X - q.Y*r.Y - q.Z*r.Z,
+		X: q.W*r.X + q.X*r.W + q.Y*r.Z - q.Z*r.Y,
+		Y: q.W*r.Y - q.X*r.Z + q.Y*r.W + q.Z*r.X,
+		Z: q.W*r.Z + q.X*r.Y - q.Y*r.X + q.Z*r.W,
+	}
+}
+
+// Conjugate returns the opposite rotation (for a normalised quaternion)
+func (q Quaternion) Conjugate() Quaternion {
+	return Quaternion{W: q.W, X: -q.X, Y: -q.Y, Z: -q.Z}
+}
+
+func (q Quaternion) Dot(r Quaternion) float64 {
+	return q.W*r.W + q.X*r.X + q.Y*r.Y + q.Z*r.Z
+}
+
+func (q Quaternion) Norm() float64 {
+	return math.Sqrt(q.Dot(q))
+}
+
+func (q Quaternion) Normalised() Quaternion {
+	n := 1 / q.Norm()
+	return Quaternion{W: q.W * n, X: q.X * n, Y: q.Y * n, Z: q.Z * n}
+}
+
+// Rotate returns v rotated by the quaternion (normalised)
+func (q Quaternion) Rotate(v Vector3f) Vector3f {
+	// v + 2w(u x v) + 2u x (u x v), expanding q v q*
+	u := Vector3f{X: q.X, Y: q.Y, Z: q.Z}
+	t := u.Cross(v).Multiply(2)
+	return v.Add(t.Multiply(q.W)).Add(u.Cross(t))
+}
+
+// Matrix returns the rotation as a matrix
+func (q Quaternion) Matrix() Matrix4x4 {
+	w, x, y, z := q.W, q.X, q.Y, q.Z
+	return Matrix4x4{
+		{1 - 2*(y*y+z*z), 2 * (x*y - w*z), 2 * (x*z + w*y), 0},
+		{2 * (x*y + w*z), 1 - 2*(x*x+z*z), 2 * (y*z - w*x), 0},
+		{2 * (x*z - w*y), 2 * (y*z + w*x), 1 - 2*(x*x+y*y), 0},
+		{0, 0, 0, 1},
+	}
+}
+
+// Slerp interpolates along the shortest arc from q (t = 0) to r (t = 1) at a
+// constant angular speed
+func Slerp(q, r Quaternion, t float64) Quaternion {
+	// q and -q are the same rotation, take whichever is nearer
+	cos := q.Dot(r)
+	if cos < 0 {
+		r, cos = Quaternion{W: -r.W, X: -r.X, Y: -r.Y, Z: -r.Z}, -cos
+	}
+
+	a, b := 1-t, t
+	if cos < 0.9995 {
+		theta := math.Acos(cos)
+		sin := math.Sin(theta)
+		a, b = math.Sin((1-t)*theta)/sin, math.Sin(t*theta)/sin
+	}
+	// (nearly parallel, so lerp, normalised to stay a rotation)
+	return Quaternion{
+		W: a*q.W + b*r.W,
+		X: a*q.X + b*r.X,
+		Y: a*q.Y + b*r.Y,
+		Z: a*q.Z + b*r.Z,
+	}.Normalised()
+}
@@ -0,0 +1,57 @@
+package raytracer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestQuaternionRotate(t *testing.T) {
+	// a quarter turn around y takes x to -z
+	q := AxisAngle(Vector3f{Y: 1}, math.Pi/2)
+	if v := q.Rotate(Vector3f{X: 1}); !nearVec(v, Vector3f{Z: -1}) {
+		t.Errorf("Rotate = %v, want (0, 0, -1)", v)
+	}
+
+	// matching the matrix rotations
+	q = EulerQuaternion(0.3, -1.1, 2)
+	m := RotateX(0.3).Then(RotateY(-1.1)).Then(RotateZ(2))
+	for _, v := range []Vector3f{{X: 1}, {Y: 1}, {X: 1, Y: -2, Z: 3}} {
+		if a, b := q.Rotate(v), m.Direction(v); !nearVec(a, b) {
+			t.Errorf("Rotate(%v) = %v, matrix gives %v", v, a, b)
+		}
+		if a, b := Rotate(q).Point(v), m.Point(v); !nearVec(a, b) {
+			t.Errorf("Matrix rotates %v to %v, want %v", v, a, b)
+		}
+		if a := q.Conjugate().Rotate(q.Rotate(v)); !nearVec(a, v) {
+			t.Errorf("Conjugate doesn't undo the rotation: %v, want %v", a, v)
+		}
+	}
+
+	if v := IdentityQuaternion().Rotate(Vector3f{X: 1, Y: 2, Z: 3}); !nearVec(v, Vector3f{X: 1, Y: 2, Z: 3}) {
+		t.Errorf("identity rotated to %v", v)
+	}
+}
+
+func TestSlerp(t *testing.T) {
+	a := IdentityQuaternion()
+	b := AxisAngle(Vector3f{Z: 1}, 2)
+
+	// constant speed: a quarter of the way is a quarter of the angle
+	for _, f := range []float64{0, 0.25, 0.5, 1} {
+		q := Slerp(a, b, f)
+		want := AxisAngle(Vector3f{Z: 1}, 2*f)
+		if !near(math.Abs(q.Dot(want)), 1) {
+			t.Errorf("Slerp(%v) = %v, want %v", f, q, want)
+		}
+		if !near(q.Norm(), 1) {
+			t.Errorf("Slerp(%v) isn't normalised: %v", f, q.Norm())
+		}
+	}
+
+	// the short way round, even when the signs differ
+	c := AxisAngle(Vector3f{Z: 1}, 0.2)
+	neg := Quaternion{W: -c.W, X: -c.X, Y: -c.Y, Z: -c.Z}
+	if v := Slerp(a, neg, 0.5).Rotate(Vector3f{X: 1}); !nearVec(v, Vector3f{X: math.Cos(0.1), Y: math.Sin(0.1)}) {
+		t.Errorf("Slerp took the long way: %v", v)
+	}
+}
@@ -0,0 +1,16 @@
+package raytracer
+
+// Ray is a half-line from Origin along Direction (which should be normalised),
+// at an instant in Time (within the camera's shutter interval)
+type Ray struct {
+	Origin    Vector3f
+	Direction Vector3f
+	Time      float64
+
+	stats *RenderStats // counts the work tracing the ray does (nil for none), passed on to rays it spawns
+}
+
+// At returns the point distance t along the ray
+func (r Ray) At(t float64) Vector3f {
+	return r.Origin.Add(r.Direction.Multiply(t))
+}
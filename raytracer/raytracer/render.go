@@ -0,0 +1,445 @@
+package raytracer
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sync"
+	"time"
+)
+
+// MaxRayRecursionDepth is how many times rays are reflected and refracted, by
+// default (see Scene.MaxDepth)
+const MaxRayRecursionDepth = 4
+
+type empty struct{}
+
+// Render draws the scene as seen by the camera into img, one goroutine per column
+func Render(img *image.NRGBA, width, height int, camera *Camera, scene *Scene) {
+	RenderPasses(img, width, height, camera, scene, nil)
+}
+
+// RenderPasses is Render, also writing the colour and AOV passes (if passes isn't nil)
+func RenderPasses(img *image.NRGBA, width, height int, camera *Camera, scene *Scene, passes *Passes) {
+	renderPasses(img, width, height, camera, scene, passes, renderOptions{packets: true})
+}
+
+// renderOptions choose between ways of rendering that give the same image
+type renderOptions struct {
+	// trace camera rays in packets (which finds exactly the same hits, a
+	// packet at a time), rather than one by one
+	packets bool
+}
+
+func renderPasses(img *image.NRGBA, width, height int, camera *Camera, scene *Scene, passes *Passes, options renderOptions) {
+	// only the pixels within img's bounds are rendered, so a tile of a larger
+	// frame can be rendered on its own (into an image of just that tile)
+	bounds := img.Bounds().Intersect(image.Rect(0, 0, width, height))
+	sem := make(chan empty, bounds.Dx()) // semaphore pattern
+
+	prepareCamera(camera, scene)
+
+	began := time.Now()
+	stats := scene.Stats
+	var statsMutex sync.Mutex
+	if stats != nil {
+		*stats = RenderStats{Tiles: make([]time.Duration, bounds.Dx())}
+	}
+
+	for i := bounds.Min.X; i < bounds.Max.X; i++ {
+		go func(i int) {
+			// each column counts into its own stats, so they aren't contended
+			var column *RenderStats
+			if stats != nil {
+				column = &RenderStats{}
+			}
+			columnBegan := time.Now()
+
+			// pixels are rendered in blocks down the column, so (unless sampling
+			// adaptively, where each pixel takes its own number of samples) each
+			// sample of the block can be traced as a packet
+			for j := bounds.Min.Y; j < bounds.Max.Y; j += PacketSize {
+				n := PacketSize
+				if bounds.Max.Y-j < n {
+					n = bounds.Max.Y - j
+				}
+				var pixels [PacketSize]pixelSamples
+				var visible [PacketSize]bool
+				for k := 0; k < n; k++ {
+					visible[k] = camera.Visible(i, j+k, width, height)
+				}
+
+				if options.packets && !camera.Adaptive() {
+					renderPacket(i, j, width, height, visible[:n], pixels[:n], camera, scene, passes, column)
+				} else {
+					for k := 0; k < n; k++ {
+						if !visible[k] {
+							continue
+						}
+						// taking more samples while the pixel is still noisy if sampling adaptively
+						p := &pixels[k]
+						for s := 0; moreSamples(camera, s, &p.variance); s++ {
+							ray := camera.Ray(i, j+k, width, height, s)
+							ray.stats = column
+							aov := p.sample(passes)
+							p.add(castRayAOV(ray, scene, 0, aov), aov, passes, camera)
+						}
+					}
+				}
+
+				for k := 0; k < n; k++ {
+					if !visible[k] {
+						img.Set(i, j+k, color.NRGBA{A: 0xff})
+						continue
+					}
+					pixels[k].write(img, i, j+k, passes, camera)
+				}
+			}
+			if stats != nil {
+				statsMutex.Lock()
+				stats.add(column)
+				stats.Tiles[i-bounds.Min.X] = time.Since(columnBegan)
+				statsMutex.Unlock()
+			}
+			sem <- empty{}
+		}(i)
+	}
+
+	// TODO: for parallelism, use a work-stealing approach so many workers aren't
+	// wasting time?
+	// also increase batch size?
+
+	// wait for goroutines to finish
+	// (complete for every column)
+	for i := bounds.Min.X; i < bounds.Max.X; i++ {
+		<-sem
+	}
+	if stats != nil {
+		stats.Elapsed = time.Since(began)
+	}
+}
+
+// prepareCamera gets the camera ready to render the scene
+func prepareCamera(camera *Camera, scene *Scene) {
+	// limit to 360
+	camera.Pitch = math.Mod(camera.Pitch, math.Pi*2)
+	camera.Yaw = math.Mod(camera.Yaw, math.Pi*2)
+
+	if camera.Autofocus {
+		autofocus(camera, scene)
+	}
+}
+
+// renderPacket takes every sample of a block of pixels down column i, from
+// row j (those that are visible), tracing each sample of the block as a packet
+func renderPacket(i, j, width, height int, visible []bool, pixels []pixelSamples, camera *Camera, scene *Scene, passes *Passes, stats *RenderStats) {
+	var rays [PacketSize]Ray
+	var lanes [PacketSize]int // which pixel each ray is for
+	var packet RayPacket
+	var hits [PacketSize]PacketHit
+
+	for s := 0; s < camera.SampleCount(); s++ {
+		count := 0
+		for k, v := range visible {
+			if v {
+				rays[count] = camera.Ray(i, j+k, width, height, s)
+				rays[count].stats = stats
+				lanes[count] = k
+				count++
+			}
+		}
+		if count == 0 {
+			return
+		}
+
+		packet.Set(rays[:count])
+		// (nothing further than 1000 counts as a hit, as in castRay)
+		scene.IntersectPacket(&packet, 1000, &hits)
+		for l := 0; l < count; l++ {
+			stats.trace(0)
+			p := &pixels[lanes[l]]
+			aov := p.sample(passes)
+			p.add(shade(rays[l], hits[l].Hit, hits[l].OK, scene, 0, aov), aov, passes, camera)
+		}
+	}
+}
+
+// pixelSamples averages a pixel's samples
+type pixelSamples struct {
+	sum      Vector3f
+	aovs     aovPixel
+	variance pixelVariance
+	samples  int
+}
+
+// sample returns somewhere for a sample's AOVs, if they're wanted
+func (p *pixelSamples) sample(passes *Passes) *aovSample {
+	if passes == nil {
+		return nil
+	}
+	return &aovSample{}
+}
+
+// add adds a sample of radiance (as castRay returns), clamped to 8 bits for the image
+func (p *pixelSamples) add(radiance Vector3f, aov *aovSample, passes *Passes, camera *Camera) {
+	c := clampRadiance(radiance)
+	v := Vector3f{X: float64(c.R), Y: float64(c.G), Z: float64(c.B)}
+	p.sum = p.sum.Add(v)
+	p.variance.add(luminance(v) / 0xff)
+	p.samples++
+	if aov != nil {
+		p.aovs.add(aov, passes, camera)
+	}
+}
+
+// write sets pixel (i, j) of the image and passes to the average of the samples
+func (p *pixelSamples) write(img *image.NRGBA, i, j int, passes *Passes, camera *Camera) {
+	sum := p.sum.Multiply(1.0 / float64(p.samples))
+
+	if passes != nil {
+		if passes.Colour != nil {
+			passes.Colour.Set(i, j, p.aovs.radiance.Multiply(1.0/(0xff*float64(p.samples))))
+		}
+		p.aovs.write(i, j, passes, camera)
+	}
+
+	img.Set(i, j, color.NRGBA{
+		R: uint8(sum.X + 0.5),
+		G: uint8(sum.Y + 0.5),
+		B: uint8(sum.Z + 0.5),
+		A: 0xff,
+	})
+}
+
+// castRay returns the light seen along a ray, 0 to 255 per channel, or more
+// for highlights (it's only clamped when written to a pixel, by clampRadiance)
+func castRay(ray Ray, scene *Scene, depth int) Vector3f {
+	return castRayAOV(ray, scene, depth, nil)
+}
+
+// castRayAOV is castRay, also filling in what the ray saw for the AOVs (if aov isn't nil)
+func castRayAOV(ray Ray, scene *Scene, depth int, aov *aovSample) Vector3f {
+	var surface Hit
+	ok := false
+	if depth <= scene.maxDepth() {
+		ray.stats.trace(depth)
+		// (nothing further than 1000 counts as a hit)
+		_, surface, ok = scene.Intersect(ray, 1000)
+	}
+	return shade(ray, surface, ok, scene, depth, aov)
+}
+
+// shade returns the light seen along a ray at depth (as castRay), which hit
+// surface (if ok, or else the skybox), also filling in the AOVs (if aov isn't nil)
+func shade(ray Ray, surface Hit, ok bool, scene *Scene, depth int, aov *aovSample) Vector3f {
+	origin, direction := ray.Origin, ray.Direction
+
+	lights := scene.Lights
+	envmap := scene.EnvMap
+
+	if !ok {
+		// return BackgroundColour
+
+		// create skybox:
+		// find u and v on the envmap sphere in range of [0,1]
+		// https://en.wikipedia.org/wiki/UV_mapping#Finding_UV_on_a_sphere
+		u := 0.5 + (math.Atan2(direction.Z, direction.X) / (2 * math.Pi))
+		v := 0.5 - (math.Asin(direction.Y) / (math.Pi))
+		imgWidth, imgHeight := envmap.Bounds().Dx(), envmap.Bounds().Dy()
+		// x := int(u * float64(imgWidth))
+		// y := int(v * float64(imgHeight))
+
+		// focus?
+		x := int(u * float64(imgWidth))
+		y := int(v * float64(imgHeight))
+		bg := *envmap
+		r, g, b, _ := bg.At(x, y).RGBA()
+		bgVec := Vector3f{X: float64(r >> 8), Y: float64(g >> 8), Z: float64(b >> 8)}
+
+		// fade into any fog (nothing was hit, so it's infinitely far away)
+		bgVec = applyVolumetrics(bgVec, ray, math.Inf(1), scene)
+		if aov != nil {
+			aov.radiance = bgVec
+		}
+		return bgVec
+	}
+
+	point, object := surface.Point, surface.Object
+	material := surface.Material.At(surface)
+	normal := material.ShadingNormal(surface)
+
+	// calculate reflections and refractions
+
+	reflectDir := direction.Reflect(normal).Normalised()
+	refractDir := refract(direction.Multiply(1.0), normal, material.RefractiveIndex).Normalised()
+	// refractDir := refract(direction.Multiply(-1.0), normal, material.RefractiveIndex).Normalised()
+
+	// offset the original point to avoid occlusion by the object itself
+	reflectOrigin := point
+	if reflectDir.Dot(normal) < 0 {
+		reflectOrigin = reflectOrigin.Sub(normal.Multiply(1.0 / 1000))
+	} else {
+		reflectOrigin = reflectOrigin.Add(normal.Multiply(1.0 / 1000))
+	}
+
+	refractOrigin := point
+	if refractDir.Dot(normal) < 0 {
+		refractOrigin = refractOrigin.Sub(normal.Multiply(1.0 / 1000))
+	} else {
+		refractOrigin = refractOrigin.Add(normal.Multiply(1.0 / 1000))
+	}
+
+	// recursively calculate reflections (up to max depth)
+	if depth < scene.maxDepth() {
+		ray.stats.secondary()
+	}
+	// (unclamped, so highlights seen in reflections and through glass stay bright)
+	reflectColourVec := castRay(Ray{Origin: reflectOrigin, Direction: reflectDir, Time: ray.Time, stats: ray.stats}, scene, depth+1)
+	refractColourVec := castRay(Ray{Origin: refractOrigin, Direction: refractDir, Time: ray.Time, stats: ray.stats}, scene, depth+1)
+
+	diffuseLightIntensity := 0.0
+	specularLightIntensity := 0.0
+	shadowedIntensity, totalIntensity := 0.0, 0.0
+
+	for i := 0; i < len(lights); i++ {
+		lightDir := (lights[i].Position.Sub(point)).Normalised()
+		lightDist := (lights[i].Position.Sub(point)).Norm()
+
+		// determine shadows
+		//  make sure that the segment between the current point and the light
+		//  source does not intersect the objects in the scene
+		//  if there is an intersection we skip the current light source
+		//  (and move the point in the direction of the normal)
+		shadowOrigin := point
+		if lightDir.Dot(normal) < 0.0 {
+			shadowOrigin = shadowOrigin.Sub(normal.Multiply(1.0 / 1000))
+		} else {
+			shadowOrigin = shadowOrigin.Add(normal.Multiply(1.0 / 1000))
+		}
+		var shadowPoint, shadowNormal Vector3f
+		var tmpMaterial Material
+		shadowRay := Ray{Origin: shadowOrigin, Direction: lightDir, Time: ray.Time, stats: ray.stats}
+		ray.stats.shadow()
+		totalIntensity += lights[i].Intensity
+		if sceneIntersect(shadowRay, &shadowPoint, &shadowNormal, &tmpMaterial, scene) &&
+			(shadowPoint.Sub(shadowOrigin).Norm() < lightDist) {
+			shadowedIntensity += lights[i].Intensity
+			continue
+		}
+
+		// determine brightness / reflection
+		diffuseLightIntensity += lights[i].Intensity * math.Max(0.0, lightDir.Dot(normal))
+		specularLightIntensity += math.Pow(
+			math.Max(0.0, lightDir.Reflect(normal).Dot(direction)),
+			material.SpecularExponent,
+		) * lights[i].Intensity
+	}
+
+	// TODO: define multiply function (with limiting) for colours instead of converting to vec
+	c := material.DiffuseColour
+	cVec := Vector3f{
+		X: float64(c.R),
+		Y: float64(c.G),
+		Z: float64(c.B),
+	}
+
+	// phong = ambient + diffuse + specular
+	diffuse := cVec.Multiply(diffuseLightIntensity).Multiply(material.Albedo[0])
+	specular := Vector3f{X: 0xff, Y: 0xff, Z: 0xff}.Multiply(specularLightIntensity).Multiply(material.Albedo[1])
+	reflection := reflectColourVec.Multiply(material.Albedo[2])
+	refraction := refractColourVec.Multiply(material.Albedo[3])
+	cVec = diffuse.Add(specular).Add(reflection).Add(refraction)
+
+	if aov != nil {
+		*aov = aovSample{
+			hit:        true,
+			point:      point,
+			normal:     normal,
+			albedo:     Vector3f{X: float64(c.R), Y: float64(c.G), Z: float64(c.B)}.Multiply(1.0 / 0xff),
+			object:     object,
+			material:   material.id(),
+			diffuse:    diffuse.Multiply(1.0 / 0xff),
+			specular:   specular.Multiply(1.0 / 0xff),
+			reflection: reflection.Multiply(1.0 / 0xff),
+			refraction: refraction.Multiply(1.0 / 0xff),
+		}
+		if totalIntensity > 0 {
+			aov.shadow = shadowedIntensity / totalIntensity
+		}
+	}
+
+	// light leaving an object (hitting it from inside) was absorbed on its way through
+	dist := point.Sub(origin).Norm()
+	if direction.Dot(normal) > 0 {
+		cVec = material.Absorb(cVec, dist)
+	}
+
+	// fog and volumes between the ray origin and the hit
+	cVec = applyVolumetrics(cVec, ray, dist, scene)
+	if aov != nil {
+		aov.radiance = cVec
+	}
+	return cVec
+}
+
+// clampRadiance returns radiance (as castRay returns) as an 8 bit colour,
+// scaling down anything too bright (keeping its hue)
+func clampRadiance(radiance Vector3f) color.NRGBA {
+	// prevent brightness from exceeding maximum
+	max := math.Max(radiance.X, math.Max(radiance.Y, radiance.Z))
+	if max > 0xff {
+		radiance = radiance.Multiply(0xff / max)
+	}
+	return color.NRGBA{
+		R: uint8(math.Max(radiance.X, 0)),
+		G: uint8(math.Max(radiance.Y, 0)),
+		B: uint8(math.Max(radiance.Z, 0)),
+		A: 0xff,
+	}
+}
+
+// autofocus sets the camera's focal distance to whatever is under the centre of the image
+func autofocus(camera *Camera, scene *Scene) {
+	forward := camera.Forward()
+	var point, normal Vector3f
+	var material Material
+	centre := Ray{Origin: camera.Position, Direction: forward, Time: camera.ShutterOpen}
+	if sceneIntersect(centre, &point, &normal, &material, scene) {
+		camera.FocalDistance = point.Sub(camera.Position).Dot(forward)
+	}
+}
+
+// applyVolumetrics attenuates colour c (from dist along the ray) by the
+// scene's fog and volumes, and adds the light they scatter towards the origin
+func applyVolumetrics(c Vector3f, ray Ray, dist float64, scene *Scene) Vector3f {
+	transmittance, scattered := scene.Volumetrics(ray, dist)
+	return c.MultiplyComponents(transmittance).Add(scattered.Multiply(0xff))
+}
+
+func sceneIntersect(ray Ray, hit, N *Vector3f, material *Material, scene *Scene) bool {
+	// (nothing further than 1000 counts as a hit)
+	_, surface, ok := scene.Intersect(ray, 1000)
+	if !ok {
+		return false
+	}
+	*hit = surface.Point
+	*material = surface.Material.At(surface)
+	*N = material.ShadingNormal(surface)
+	return true
+}
+
+// refract returns the direction I bends to entering (or, from inside, leaving)
+// a surface with normal N and the given refractive index, or a tiny vector for
+// total internal reflection
+func refract(I, N Vector3f, refractiveIndex float64) Vector3f {
+	// if the ray is inside the object, swap the indices and invert the normal
+	eta, n := 1/refractiveIndex, N
+	if I.Dot(N) > 0 {
+		eta, n = refractiveIndex, N.Negate()
+	}
+	if r, ok := I.Refract(n, eta); ok {
+		return r
+	}
+	zero := math.SmallestNonzeroFloat64 // stop divide by zero on normalise
+	return Vector3f{X: zero, Y: zero, Z: zero}
+}
@@ -0,0 +1,90 @@
+package raytracer
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"testing"
+)
+
+// benchScene is the demo scene, with a small generated envmap so loading it
+// isn't measured
+func benchScene() (*Scene, *Camera) {
+	camera := &Camera{FOV: math.Pi / 3, FocalDistance: 16}
+	return DemoScene(gradientEnvMap(), camera), camera
+}
+
+func BenchmarkSceneIntersect(b *testing.B) {
+	scene, camera := benchScene()
+	ray := camera.Ray(170, 128, 341, 256, 0)
+	var point, normal Vector3f
+	var material Material
+	for i := 0; i < b.N; i++ {
+		sceneIntersect(ray, &point, &normal, &material, scene)
+	}
+}
+
+func BenchmarkCastRay(b *testing.B) {
+	scene, camera := benchScene()
+	// rays at the glass, a matte sphere and the sky
+	rays := []Ray{
+		camera.Ray(90, 120, 341, 256, 0),
+		camera.Ray(150, 130, 341, 256, 0),
+		camera.Ray(10, 10, 341, 256, 0),
+	}
+	for i := 0; i < b.N; i++ {
+		castRay(rays[i%len(rays)], scene, 0)
+	}
+}
+
+func BenchmarkRender(b *testing.B) {
+	for _, size := range [][2]int{{160, 120}, {341, 256}, {640, 480}} {
+		width, height := size[0], size[1]
+		b.Run(fmt.Sprintf("%dx%d", width, height), func(b *testing.B) {
+			img := image.NewNRGBA(image.Rect(0, 0, width, height))
+			for i := 0; i < b.N; i++ {
+				scene, camera := benchScene()
+				Render(img, width, height, camera, scene)
+			}
+		})
+	}
+}
+
+func TestRenderStats(t *testing.T) {
+	scene := testScene()
+	scene.Stats = &RenderStats{}
+	camera := &Camera{FOV: math.Pi / 3, Samples: 2}
+	width, height := 8, 6
+	Render(image.NewNRGBA(image.Rect(0, 0, width, height)), width, height, camera, scene)
+	stats := scene.Stats
+
+	if want := int64(width * height * 2); stats.PrimaryRays != want {
+		t.Errorf("primary rays = %v, want %v", stats.PrimaryRays, want)
+	}
+	// every hit tests both lights, and (short of the recursion limit) spawns
+	// a reflection and a refraction
+	if stats.ShadowRays == 0 || stats.ShadowRays%2 != 0 || stats.ReflectionRays == 0 || stats.ReflectionRays != stats.RefractionRays {
+		t.Errorf("shadow, reflection, refraction rays = %v, %v, %v", stats.ShadowRays, stats.ReflectionRays, stats.RefractionRays)
+	}
+	// (misses are mostly culled by the bvh's boxes)
+	if stats.ShapeTests == 0 || stats.BoxTests < stats.Rays() {
+		t.Errorf("%v shape tests, %v box tests for %v rays", stats.ShapeTests, stats.BoxTests, stats.Rays())
+	}
+	if d := stats.AverageDepth(); d <= 0 || d > MaxRayRecursionDepth {
+		t.Errorf("average depth = %v, want in (0, %v]", d, MaxRayRecursionDepth)
+	}
+	if len(stats.Tiles) != width || stats.Elapsed <= 0 {
+		t.Errorf("%v tiles in %v", len(stats.Tiles), stats.Elapsed)
+	}
+	if stats.String() == "" {
+		t.Errorf("empty report")
+	}
+
+	// limiting the recursion
+	reflections := stats.ReflectionRays
+	scene.MaxDepth = 1
+	Render(image.NewNRGBA(image.Rect(0, 0, width, height)), width, height, camera, scene)
+	if stats.ReflectionRays >= reflections || stats.AverageDepth() > 1 {
+		t.Errorf("with MaxDepth 1, %v reflection rays (from %v), average depth %v", stats.ReflectionRays, reflections, stats.AverageDepth())
+	}
+}
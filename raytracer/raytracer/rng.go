@@ -0,0 +1,57 @@
+package raytracer
+
+// RNG is a PCG32 random number generator (o'neill's permuted congruential
+// generator): small, fast, and the same sequence for the same seed and stream
+// on any machine, so anything random can be reproduced exactly
+type RNG struct {
+	state, inc uint64
+}
+
+const pcgMultiplier = 6364136223846793005
+
+// NewRNG returns a generator for seed; generators with different streams
+// give independent sequences, even with the same seed
+func NewRNG(seed, stream uint64) RNG {
+	r := RNG{inc: stream<<1 | 1}
+	r.Uint32()
+	r.state += seed
+	r.Uint32()
+	return r
+}
+
+// Uint32 returns the next number in the sequence
+func (r *RNG) Uint32() uint32 {
+	old := r.state
+	r.state = old*pcgMultiplier + r.inc
+	xorShifted := uint32((old>>18 ^ old) >> 27)
+	rot := uint32(old >> 59)
+	return xorShifted>>rot | xorShifted<<(-rot&31)
+}
+
+// Float64 returns a number in [0,1)
+func (r *RNG) Float64() float64 {
+	return float64(r.Uint32()) / (1 << 32)
+}
+
+// hashKey mixes values into a single well spread 64 bit key (each is folded
+// in with the splitmix64 finaliser), for seeding generators from coordinates
+func hashKey(values ...uint64) uint64 {
+	h := uint64(0x9e3779b97f4a7c15)
+	for _, v := range values {
+		h ^= v
+		h ^= h >> 30
+		h *= 0xbf58476d1ce4e5b9
+		h ^= h >> 27
+		h *= 0x94d049bb133111eb
+		h ^= h >> 31
+	}
+	return h
+}
+
+// SampleRNG returns the generator for sample s of pixel (i, j) of a frame;
+// it depends only on these and seed, never on which goroutine renders the
+// pixel or when, so a render is the same however it's split up
+// (sample -1 is the pixel's own, shared by all of its samples)
+func SampleRNG(seed uint64, frame, i, j, s int) RNG {
+	return NewRNG(hashKey(seed, uint64(frame)), hashKey(uint64(i), uint64(j), uint64(s)))
+}
@@ -0,0 +1,60 @@
+package raytracer
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"runtime"
+	"testing"
+)
+
+func TestRNG(t *testing.T) {
+	// the reference pcg32 demo's output for seed 42, stream 54
+	r := NewRNG(42, 54)
+	for _, want := range []uint32{0xa15c02b7, 0x7b47f409, 0xba1d3330, 0x83d2f293, 0xbfa4784b, 0xcbed606e} {
+		if got := r.Uint32(); got != want {
+			t.Fatalf("Uint32() = %#x, want %#x", got, want)
+		}
+	}
+
+	a, b := SampleRNG(1, 0, 3, 4, 5), SampleRNG(1, 0, 3, 4, 5)
+	if a.Uint32() != b.Uint32() {
+		t.Errorf("the same sample gave different numbers")
+	}
+	for _, other := range []RNG{SampleRNG(2, 0, 3, 4, 5), SampleRNG(1, 1, 3, 4, 5), SampleRNG(1, 0, 4, 3, 5), SampleRNG(1, 0, 3, 4, 6)} {
+		if a.Uint32() == other.Uint32() {
+			t.Errorf("different samples gave the same number")
+		}
+	}
+
+	sum := 0.0
+	for i := 0; i < 10000; i++ {
+		f := r.Float64()
+		if f < 0 || f >= 1 {
+			t.Fatalf("Float64() = %v, want [0,1)", f)
+		}
+		sum += f
+	}
+	if mean := sum / 10000; math.Abs(mean-0.5) > 0.01 {
+		t.Errorf("mean = %v, want 0.5", mean)
+	}
+}
+
+func TestRenderDeterministic(t *testing.T) {
+	render := func(seed uint64, procs int) []byte {
+		defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+		camera := &Camera{FOV: math.Pi / 3, Samples: 4, Seed: seed, ApertureRadius: 0.2, FocalDistance: 10}
+		img := image.NewNRGBA(image.Rect(0, 0, 24, 16))
+		Render(img, 24, 16, camera, testScene())
+		return img.Pix
+	}
+
+	// the same whatever runs when
+	a := render(7, 1)
+	if b := render(7, 8); !bytes.Equal(a, b) {
+		t.Errorf("renders on 1 and 8 threads differ")
+	}
+	if b := render(8, 8); bytes.Equal(a, b) {
+		t.Errorf("renders with different seeds are identical")
+	}
+}
@@ -1,9 +1,70 @@
 package raytracer
 
-import "image"
+import (
+	"image"
+	"sync"
+)
 
 type Scene struct {
 	EnvMap  *image.NRGBA // skybox image
 	Lights  []*Light
 	Spheres []*Sphere
+	Planes  []*Plane
+	Shapes  []Shape // any other shapes (meshes, instances, ...)
+	Fog     *Fog
+	Volumes []*Volume
+
+	MaxDepth int // how many times rays are reflected and refracted (MaxRayRecursionDepth if 0)
+
+	Stats *RenderStats // if set, renders of the scene count their work here
+
+	// built on first intersection, so objects shouldn't be added after rendering starts
+	accelOnce sync.Once
+	accel     *BVH
+}
+
+func (s *Scene) maxDepth() int {
+	if s.MaxDepth <= 0 {
+		return MaxRayRecursionDepth
+	}
+	return s.MaxDepth
+}
+
+// Intersect finds the nearest object hit by the ray closer than tMax,
+// returning its distance and surface
+// objects are numbered from 1, spheres first, then planes, then shapes
+// (so the surface's Object is 1 + the index in that order)
+func (s *Scene) Intersect(ray Ray, tMax float64) (float64, Hit, bool) {
+	return s.bvh().Intersect(ray, tMax)
+}
+
+// bvh returns the hierarchy over the scene's objects, building it the first time
+func (s *Scene) bvh() *BVH {
+	s.accelOnce.Do(func() {
+		shapes := make([]Shape, 0, len(s.Spheres)+len(s.Planes)+len(s.Shapes))
+		for _, sphere := range s.Spheres {
+			shapes = append(shapes, sphere)
+		}
+		for _, plane := range s.Planes {
+			shapes = append(shapes, plane)
+		}
+		shapes = append(shapes, s.Shapes...)
+		for i, shape := range shapes {
+			shapes[i] = sceneObject{Shape: shape, id: i + 1}
+		}
+		s.accel = NewBVH(shapes)
+	})
+	return s.accel
+}
+
+// sceneObject tags hits on one of the scene's objects with its number
+type sceneObject struct {
+	Shape
+	id int
+}
+
+func (o sceneObject) Intersect(ray Ray, tMax float64) (float64, Hit, bool) {
+	t, hit, ok := o.Shape.Intersect(ray, tMax)
+	hit.Object = o.id
+	return t, hit, ok
 }
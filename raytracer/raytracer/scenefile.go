@@ -0,0 +1,297 @@
+package raytracer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/jpeg" // envmaps are usually jpegs
+	_ "image/png"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// SceneFile is a scene, its camera and (optionally) their animation, as
+// stored in JSON, e.g.
+//
+//	{
+//	  "width": 341, "height": 256,
+//	  "envmap": "envmap-coast.jpg",
+//	  "camera": {"position": [0, 0, 0], "fov": 60, "samples": 4},
+//	  "materials": {"gold": {"diffuse": [0.8, 0.6, 0.2], "specular_exponent": 80, "albedo": [0.6, 0.4, 0.2, 0]}},
+//	  "lights": [{"position": [-20, 20, 20], "intensity": 1.5}],
+//	  "spheres": [{"centre": [-3, 0, -16], "radius": 2, "material": "gold"}],
+//	  "planes": [{"point": [0, -4, 0], "normal": [0, 1, 0], "material": "red_rubber"}],
+//	  "timeline": [{"target": "spheres[0].centre", "keys": [{"frame": 0, "value": [-3, 0, -16]}, {"frame": 60, "value": [3, 0, -16]}]}]
+//	}
+//
+// vectors are [x, y, z], and materials are either defined in "materials" or
+// one of the presets: paper, ivory, red_rubber, mirror, glass and tinted_glass
+type SceneFile struct {
+	Width  int    `json:"width,omitempty"`  // image size (the renderer's default if 0)
+	Height int    `json:"height,omitempty"` //
+	EnvMap string `json:"envmap"`           // skybox image, relative to the scene file
+
+	MaxDepth int `json:"max_depth,omitempty"` // ray recursion limit (MaxRayRecursionDepth if 0)
+
+	Camera    CameraFile              `json:"camera"`
+	Materials map[string]MaterialFile `json:"materials,omitempty"`
+	Lights    []LightFile             `json:"lights,omitempty"`
+	Spheres   []SphereFile            `json:"spheres,omitempty"`
+	Planes    []PlaneFile             `json:"planes,omitempty"`
+	Boxes     []BoxFile               `json:"boxes,omitempty"` // added to the scene's Shapes, in order
+	Timeline  []TrackFile             `json:"timeline,omitempty"`
+}
+
+type CameraFile struct {
+	Position   [3]float64 `json:"position"`
+	Pitch      float64    `json:"pitch,omitempty"` // radians
+	Yaw        float64    `json:"yaw,omitempty"`   // radians
+	FOV        float64    `json:"fov,omitempty"`   // vertical, in degrees (60 if 0)
+	Aperture   float64    `json:"aperture,omitempty"`
+	Focus      float64    `json:"focus,omitempty"` // focal distance (16 if 0)
+	Samples    int        `json:"samples,omitempty"`
+	Projection string     `json:"projection,omitempty"` // as ParseProjection, perspective if ""
+	Shutter    float64    `json:"shutter,omitempty"`    // fraction of a frame the shutter is open
+}
+
+// MaterialFile is a material, with the fields named as in timeline targets
+type MaterialFile struct {
+	Diffuse          [3]float64 `json:"diffuse"` // rgb, 0 to 1
+	SpecularExponent float64    `json:"specular_exponent"`
+	Albedo           [4]float64 `json:"albedo"`           // diffuse, specular, reflection and refraction weights
+	RefractiveIndex  float64    `json:"refractive_index"` // 1 if 0
+	Absorption       [3]float64 `json:"absorption,omitempty"`
+}
+
+type LightFile struct {
+	Position  [3]float64 `json:"position"`
+	Intensity float64    `json:"intensity"`
+}
+
+type SphereFile struct {
+	Centre   [3]float64 `json:"centre"`
+	Radius   float64    `json:"radius"`
+	Material string     `json:"material"`
+}
+
+type PlaneFile struct {
+	Point    [3]float64 `json:"point"`
+	Normal   [3]float64 `json:"normal"`
+	Material string     `json:"material"`
+	TileSize float64    `json:"tile_size,omitempty"`
+}
+
+type BoxFile struct {
+	Min      [3]float64 `json:"min"`
+	Max      [3]float64 `json:"max"`
+	Material string     `json:"material"`
+}
+
+// TrackFile is a Track, with values in the scene's units (so camera angles
+// in radians, as in Timeline)
+type TrackFile struct {
+	Target string    `json:"target"`
+	Keys   []KeyFile `json:"keys"`
+}
+
+type KeyFile struct {
+	Frame         float64    `json:"frame"`
+	Value         [3]float64 `json:"value"`                   // scalar targets use the first
+	Interpolation string     `json:"interpolation,omitempty"` // linear (default), bezier or step
+	In            [3]float64 `json:"in,omitempty"`
+	Out           [3]float64 `json:"out,omitempty"`
+}
+
+// MaterialPresets are the materials scene files (and the viewer) can use by name
+var MaterialPresets = map[string]Material{
+	"paper":        Paper,
+	"ivory":        Ivory,
+	"red_rubber":   RedRubber,
+	"mirror":       Mirror,
+	"glass":        Glass,
+	"tinted_glass": TintedGlass,
+}
+
+var interpolations = map[string]Interpolation{
+	"":       LinearInterpolation,
+	"linear": LinearInterpolation,
+	"bezier": BezierInterpolation,
+	"step":   StepInterpolation,
+}
+
+// ParseSceneFile parses a JSON scene file, rejecting unknown fields (so typos
+// aren't silently ignored)
+func ParseSceneFile(data []byte) (*SceneFile, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	var f SceneFile
+	if err := d.Decode(&f); err != nil {
+		return nil, fmt.Errorf("scene file: %w", err)
+	}
+	if f.MaxDepth < 0 {
+		return nil, fmt.Errorf("scene file: negative max_depth %d", f.MaxDepth)
+	}
+	return &f, nil
+}
+
+// LoadSceneFile reads and parses a JSON scene file
+func LoadSceneFile(path string) (*SceneFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSceneFile(data)
+}
+
+func vec(v [3]float64) Vector3f {
+	return Vector3f{X: v[0], Y: v[1], Z: v[2]}
+}
+
+// Build returns the scene and camera at a frame of the file's timeline,
+// with envmap as the skybox (loaded by the caller, from EnvMapPath)
+func (f *SceneFile) Build(envmap *image.NRGBA, frame float64) (*Scene, *Camera, error) {
+	materials := make(map[string]Material, len(MaterialPresets)+len(f.Materials))
+	for name, m := range MaterialPresets {
+		materials[name] = m
+	}
+	for name, m := range f.Materials {
+		ri := m.RefractiveIndex
+		if ri == 0 {
+			ri = 1
+		}
+		materials[name] = Material{
+			DiffuseColour:    FloatToRGB(m.Diffuse[0], m.Diffuse[1], m.Diffuse[2]),
+			SpecularExponent: m.SpecularExponent,
+			Albedo:           m.Albedo,
+			RefractiveIndex:  ri,
+			Absorption:       vec(m.Absorption),
+		}
+	}
+	material := func(name string) (Material, error) {
+		m, ok := materials[name]
+		if !ok {
+			return Material{}, fmt.Errorf("unknown material %q", name)
+		}
+		return m, nil
+	}
+
+	c := f.Camera
+	camera := &Camera{
+		Position:       vec(c.Position),
+		Pitch:          c.Pitch,
+		Yaw:            c.Yaw,
+		FOV:            60 * math.Pi / 180,
+		ApertureRadius: c.Aperture,
+		FocalDistance:  16,
+		Samples:        c.Samples,
+		ShutterClose:   c.Shutter,
+		Frame:          int(frame),
+	}
+	if c.FOV != 0 {
+		camera.FOV = c.FOV * math.Pi / 180
+	}
+	if c.Focus != 0 {
+		camera.FocalDistance = c.Focus
+	}
+	if c.Projection != "" {
+		p, ok := ParseProjection(c.Projection)
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown projection %q", c.Projection)
+		}
+		camera.Projection = p
+	}
+
+	scene := &Scene{EnvMap: envmap, MaxDepth: f.MaxDepth}
+	for _, l := range f.Lights {
+		scene.Lights = append(scene.Lights, &Light{Position: vec(l.Position), Intensity: l.Intensity})
+	}
+	for i, s := range f.Spheres {
+		m, err := material(s.Material)
+		if err != nil {
+			return nil, nil, fmt.Errorf("spheres[%d]: %w", i, err)
+		}
+		scene.Spheres = append(scene.Spheres, &Sphere{Centre: vec(s.Centre), Radius: s.Radius, Material: m})
+	}
+	for i, p := range f.Planes {
+		m, err := material(p.Material)
+		if err != nil {
+			return nil, nil, fmt.Errorf("planes[%d]: %w", i, err)
+		}
+		scene.Planes = append(scene.Planes, &Plane{Point: vec(p.Point), Normal: vec(p.Normal).Normalised(), Material: m, TileSize: p.TileSize})
+	}
+	for i, b := range f.Boxes {
+		m, err := material(b.Material)
+		if err != nil {
+			return nil, nil, fmt.Errorf("boxes[%d]: %w", i, err)
+		}
+		scene.Shapes = append(scene.Shapes, &Box{Min: vec(b.Min), Max: vec(b.Max), Material: m})
+	}
+
+	timeline, err := f.timeline()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := timeline.Apply(scene, camera, frame); err != nil {
+		return nil, nil, err
+	}
+	return scene, camera, nil
+}
+
+func (f *SceneFile) timeline() (*Timeline, error) {
+	tl := &Timeline{}
+	for _, t := range f.Timeline {
+		track := &Track{Target: t.Target}
+		for _, k := range t.Keys {
+			interpolation, ok := interpolations[k.Interpolation]
+			if !ok {
+				return nil, fmt.Errorf("%v: unknown interpolation %q", t.Target, k.Interpolation)
+			}
+			track.Keys = append(track.Keys, Key{
+				Frame:         k.Frame,
+				Value:         vec(k.Value),
+				Interpolation: interpolation,
+				In:            vec(k.In),
+				Out:           vec(k.Out),
+			})
+		}
+		tl.Tracks = append(tl.Tracks, track)
+	}
+	return tl, nil
+}
+
+// End returns the last frame of the file's animation (0 for a still)
+func (f *SceneFile) End() float64 {
+	tl, err := f.timeline()
+	if err != nil {
+		return 0
+	}
+	return tl.End()
+}
+
+// EnvMapPath returns the path of the skybox image, for a scene file in dir
+func (f *SceneFile) EnvMapPath(dir string) string {
+	if filepath.IsAbs(f.EnvMap) {
+		return f.EnvMap
+	}
+	return filepath.Join(dir, f.EnvMap)
+}
+
+// LoadImage reads a png or jpeg
+func LoadImage(path string) (*image.NRGBA, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	nrgba := image.NewNRGBA(img.Bounds())
+	draw.Draw(nrgba, nrgba.Bounds(), img, image.Point{}, draw.Src)
+	return nrgba, nil
+}
@@ -0,0 +1,304 @@
+package raytracer
+
+import "math"
+
+// SDF is a signed distance function, returning the distance from p to the
+// nearest surface (negative inside the shape)
+type SDF func(p Vector3f) float64
+
+// SDFShape renders a signed distance function by sphere tracing, so it can
+// share a scene with analytic shapes
+type SDFShape struct {
+	SDF      SDF
+	Bound    AABB // box the surface lies within, rays are only marched inside it
+	Material Material
+
+	MaxSteps  int     // give up after this many steps (defaults to 256)
+	Epsilon   float64 // distance counted as touching the surface (defaults to 1e-4)
+	StepScale float64 // fraction of the distance to step, less than 1 for SDFs that overestimate, like twists and fractals (defaults to 1)
+}
+
+func (s *SDFShape) Intersect(ray Ray, tMax float64) (float64, Hit, bool) {
+	origin, direction := ray.Origin, ray.Direction
+	maxSteps, eps, stepScale := s.MaxSteps, s.Epsilon, s.StepScale
+	if maxSteps == 0 {
+		maxSteps = 256
+	}
+	if eps == 0 {
+		eps = 1e-4
+	}
+	if stepScale == 0 {
+		stepScale = 1
+	}
+
+	// only march the part of the ray inside the bounds
+	tNear, tFar, ok := clipRay(s.Bound, origin, direction)
+	if !ok {
+		return 0, Hit{}, false
+	}
+	t := math.Max(tNear, 0)
+	tFar = math.Min(tFar, tMax)
+
+	// a ray starting inside marches towards the surface on the way out
+	inside := s.SDF(origin.Add(direction.Multiply(t))) < 0
+
+	for i := 0; i < maxSteps && t < tFar; i++ {
+		d := s.SDF(origin.Add(direction.Multiply(t)))
+		if inside {
+			d = -d
+		}
+		if d < eps && t > eps {
+			return t, s.surfaceAt(origin.Add(direction.Multiply(t))), true
+		}
+		t += math.Max(d, eps) * stepScale
+	}
+	return 0, Hit{}, false
+}
+
+// surfaceAt builds the hit at p, with the normal from the gradient of the SDF
+func (s *SDFShape) surfaceAt(p Vector3f) Hit {
+	// tetrahedral central differences, 4 samples instead of 6
+	const h = 1e-5
+	k0 := Vector3f{X: 1, Y: -1, Z: -1}
+	k1 := Vector3f{X: -1, Y: -1, Z: 1}
+	k2 := Vector3f{X: -1, Y: 1, Z: -1}
+	k3 := Vector3f{X: 1, Y: 1, Z: 1}
+	n := k0.Multiply(s.SDF(p.Add(k0.Multiply(h)))).
+		Add(k1.Multiply(s.SDF(p.Add(k1.Multiply(h))))).
+		Add(k2.Multiply(s.SDF(p.Add(k2.Multiply(h))))).
+		Add(k3.Multiply(s.SDF(p.Add(k3.Multiply(h))))).
+		Normalised()
+
+	t, b := OrthonormalBasis(n)
+	return Hit{
+		Point:     p,
+		Local:     p,
+		Normal:    n,
+		Tangent:   t,
+		Bitangent: b,
+		U:         0.5 + (math.Atan2(n.Z, n.X) / (2 * math.Pi)),
+		V:         0.5 - (math.Asin(n.Y) / math.Pi),
+		Material:  &s.Material,
+	}
+}
+
+func (s *SDFShape) Bounds() AABB {
+	return s.Bound
+}
+
+// clipRay returns the range of t for which the ray is inside box b
+func clipRay(b AABB, origin, direction Vector3f) (float64, float64, bool) {
+	tNear, tFar := math.Inf(-1), math.Inf(1)
+	for a := 0; a < 3; a++ {
+		o, d := axis(origin, a), axis(direction, a)
+		lo, hi := axis(b.Min, a), axis(b.Max, a)
+		if d == 0 {
+			if o < lo || o > hi {
+				return 0, 0, false
+			}
+			continue
+		}
+		t0, t1 := (lo-o)/d, (hi-o)/d
+		if t0 > t1 {
+			t0, t1 = t1, t0
+		}
+		tNear, tFar = math.Max(tNear, t0), math.Min(tFar, t1)
+	}
+	return tNear, tFar, tNear <= tFar && tFar > 0
+}
+
+// primitives, centred on the origin
+
+func SphereSDF(radius float64) SDF {
+	return func(p Vector3f) float64 {
+		return p.Norm() - radius
+	}
+}
+
+// BoxSDF is a box with the given half-size along each axis
+func BoxSDF(halfSize Vector3f) SDF {
+	return func(p Vector3f) float64 {
+		q := Vector3f{X: math.Abs(p.X) - halfSize.X, Y: math.Abs(p.Y) - halfSize.Y, Z: math.Abs(p.Z) - halfSize.Z}
+		outside := Vector3f{X: math.Max(q.X, 0), Y: math.Max(q.Y, 0), Z: math.Max(q.Z, 0)}.Norm()
+		inside := math.Min(math.Max(q.X, math.Max(q.Y, q.Z)), 0)
+		return outside + inside
+	}
+}
+
+// RoundBoxSDF is a box with edges rounded by radius (the box grows by radius)
+func RoundBoxSDF(halfSize Vector3f, radius float64) SDF {
+	box := BoxSDF(halfSize)
+	return func(p Vector3f) float64 {
+		return box(p) - radius
+	}
+}
+
+// TorusSDF is a ring in the xz-plane
+func TorusSDF(majorRadius, minorRadius float64) SDF {
+	return func(p Vector3f) float64 {
+		q := math.Hypot(p.X, p.Z) - majorRadius
+		return math.Hypot(q, p.Y) - minorRadius
+	}
+}
+
+// CapsuleSDF is all points within radius of the segment a-b
+func CapsuleSDF(a, b Vector3f, radius float64) SDF {
+	ab := b.Sub(a)
+	return func(p Vector3f) float64 {
+		ap := p.Sub(a)
+		h := math.Max(0, math.Min(1, ap.Dot(ab)/ab.Dot(ab)))
+		return ap.Sub(ab.Multiply(h)).Norm() - radius
+	}
+}
+
+// CylinderSDF is a capped cylinder along the y-axis, from -halfHeight to halfHeight
+func CylinderSDF(radius, halfHeight float64) SDF {
+	return func(p Vector3f) float64 {
+		dx := math.Hypot(p.X, p.Z) - radius
+		dy := math.Abs(p.Y) - halfHeight
+		return math.Min(math.Max(dx, dy), 0) + math.Hypot(math.Max(dx, 0), math.Max(dy, 0))
+	}
+}
+
+// PlaneSDF is the half-space below the plane facing normal, offset from the origin
+func PlaneSDF(normal Vector3f, offset float64) SDF {
+	n := normal.Normalised()
+	return func(p Vector3f) float64 {
+		return p.Dot(n) - offset
+	}
+}
+
+// combining operators
+
+func UnionSDF(a, b SDF) SDF {
+	return func(p Vector3f) float64 {
+		return math.Min(a(p), b(p))
+	}
+}
+
+func IntersectSDF(a, b SDF) SDF {
+	return func(p Vector3f) float64 {
+		return math.Max(a(p), b(p))
+	}
+}
+
+// SubtractSDF carves b out of a
+func SubtractSDF(a, b SDF) SDF {
+	return func(p Vector3f) float64 {
+		return math.Max(a(p), -b(p))
+	}
+}
+
+// smoothMin is the polynomial smooth minimum, blending over a distance of k
+func smoothMin(a, b, k float64) float64 {
+	if k <= 0 {
+		return math.Min(a, b)
+	}
+	h := math.Max(k-math.Abs(a-b), 0) / k
+	return math.Min(a, b) - h*h*k/4
+}
+
+// SmoothUnionSDF blends a and b together, filleting the join over a distance of k
+func SmoothUnionSDF(a, b SDF, k float64) SDF {
+	return func(p Vector3f) float64 {
+		return smoothMin(a(p), b(p), k)
+	}
+}
+
+func SmoothIntersectSDF(a, b SDF, k float64) SDF {
+	return func(p Vector3f) float64 {
+		return -smoothMin(-a(p), -b(p), k)
+	}
+}
+
+func SmoothSubtractSDF(a, b SDF, k float64) SDF {
+	return func(p Vector3f) float64 {
+		return -smoothMin(-a(p), b(p), k)
+	}
+}
+
+// domain operators
+
+func TranslateSDF(s SDF, offset Vector3f) SDF {
+	return func(p Vector3f) float64 {
+		return s(p.Sub(offset))
+	}
+}
+
+// ScaleSDF scales s uniformly by factor
+func ScaleSDF(s SDF, factor float64) SDF {
+	return func(p Vector3f) float64 {
+		return s(p.Multiply(1/factor)) * factor
+	}
+}
+
+// RepeatSDF tiles s infinitely, once per period along each axis (0 to not repeat)
+// s should fit within one period
+func RepeatSDF(s SDF, period Vector3f) SDF {
+	repeat := func(x, c float64) float64 {
+		if c == 0 {
+			return x
+		}
+		return x - c*math.Round(x/c)
+	}
+	return func(p Vector3f) float64 {
+		return s(Vector3f{X: repeat(p.X, period.X), Y: repeat(p.Y, period.Y), Z: repeat(p.Z, period.Z)})
+	}
+}
+
+// TwistSDF twists s around the y-axis, by rate radians per unit height
+// (distances are no longer exact, so march with a StepScale below 1)
+func TwistSDF(s SDF, rate float64) SDF {
+	return func(p Vector3f) float64 {
+		c, sn := math.Cos(rate*p.Y), math.Sin(rate*p.Y)
+		return s(Vector3f{X: c*p.X - sn*p.Z, Y: p.Y, Z: sn*p.X + c*p.Z})
+	}
+}
+
+// fractals and blobs
+
+// MandelbulbSDF is the mandelbulb fractal (power 8 is the classic shape),
+// roughly within a radius of 1.2 of the origin
+func MandelbulbSDF(power float64, iterations int) SDF {
+	return func(p Vector3f) float64 {
+		z := p
+		dr, r := 1.0, 0.0
+		for i := 0; i < iterations; i++ {
+			r = z.Norm()
+			if r > 2 {
+				break
+			}
+			if r == 0 {
+				// the orbit hit the origin, which is inside
+				return 0
+			}
+
+			// raise to the power in spherical coordinates, then add back p
+			theta := math.Acos(z.Z/r) * power
+			phi := math.Atan2(z.Y, z.X) * power
+			dr = math.Pow(r, power-1)*power*dr + 1
+			zr := math.Pow(r, power)
+			z = Vector3f{
+				X: math.Sin(theta) * math.Cos(phi),
+				Y: math.Sin(phi) * math.Sin(theta),
+				Z: math.Cos(theta),
+			}.Multiply(zr).Add(p)
+		}
+		if r == 0 {
+			// no iterations
+			return 0
+		}
+		return 0.5 * math.Log(r) * r / dr
+	}
+}
+
+// MetaballsSDF is a set of spheres smoothly blended together, over a distance of k
+func MetaballsSDF(centres []Vector3f, radii []float64, k float64) SDF {
+	return func(p Vector3f) float64 {
+		d := math.Inf(1)
+		for i, c := range centres {
+			d = smoothMin(d, p.Sub(c).Norm()-radii[i], k)
+		}
+		return d
+	}
+}
@@ -0,0 +1,70 @@
+package raytracer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSDFShapeMatchesSphere(t *testing.T) {
+	s := &SDFShape{
+		SDF:   TranslateSDF(SphereSDF(1), Vector3f{Z: -5}),
+		Bound: AABB{Min: Vector3f{X: -1, Y: -1, Z: -6}, Max: Vector3f{X: 1, Y: 1, Z: -4}},
+	}
+	sphere := &Sphere{Centre: Vector3f{Z: -5}, Radius: 1}
+
+	for _, c := range []struct {
+		name              string
+		origin, direction Vector3f
+	}{
+		{"front", Vector3f{}, Vector3f{Z: -1}},
+		{"off centre", Vector3f{X: 0.5, Y: 0.3}, Vector3f{Z: -1}},
+		{"inside", Vector3f{Z: -5}, Vector3f{X: 1, Y: 1}},
+		{"graze", Vector3f{X: 0.99}, Vector3f{Z: -1}},
+	} {
+		ray := Ray{Origin: c.origin, Direction: c.direction.Normalised()}
+		want, wantHit, _ := sphere.Intersect(ray, math.MaxFloat64)
+		got, hit, ok := s.Intersect(ray, math.MaxFloat64)
+		if !ok {
+			t.Errorf("%s: missed", c.name)
+			continue
+		}
+		if math.Abs(got-want) > 1e-3 {
+			t.Errorf("%s: t = %v, want %v", c.name, got, want)
+		}
+		if hit.Normal.Dot(wantHit.Normal) < 0.999 {
+			t.Errorf("%s: normal = %v, want %v", c.name, hit.Normal, wantHit.Normal)
+		}
+	}
+
+	if _, _, ok := s.Intersect(Ray{Origin: Vector3f{X: 1.01}, Direction: Vector3f{Z: -1}}, math.MaxFloat64); ok {
+		t.Errorf("graze outside: expected miss")
+	}
+}
+
+func TestSmoothUnionSDF(t *testing.T) {
+	a := TranslateSDF(SphereSDF(1), Vector3f{X: -1})
+	b := TranslateSDF(SphereSDF(1), Vector3f{X: 1})
+	hard, smooth := UnionSDF(a, b), SmoothUnionSDF(a, b, 0.5)
+
+	// blending only ever adds material, and only near the join
+	for _, p := range []Vector3f{{}, {Y: 0.5}, {Y: 1}, {X: -2.5}} {
+		if smooth(p) > hard(p) {
+			t.Errorf("smooth union at %v = %v, more than union %v", p, smooth(p), hard(p))
+		}
+	}
+	if !near(smooth(Vector3f{X: -2.5}), hard(Vector3f{X: -2.5})) {
+		t.Errorf("smooth union changed far from the join")
+	}
+}
+
+func TestMandelbulbSDFOrigin(t *testing.T) {
+	sdf := MandelbulbSDF(8, 8)
+	for _, p := range []Vector3f{{}, {X: 1e-9}, {Z: 0.5}, {X: 2, Y: 2}} {
+		if d := sdf(p); math.IsNaN(d) || math.IsInf(d, 0) {
+			t.Errorf("distance at %v = %v", p, d)
+		}
+	}
+	if d := sdf(Vector3f{}); d != 0 {
+		t.Errorf("distance at the origin = %v, want 0", d)
+	}
+}
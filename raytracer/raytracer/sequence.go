@@ -0,0 +1,144 @@
+package raytracer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"time"
+)
+
+// EncodeGIF writes frames as a looping animated gif, delay apart
+// (dithered down to the web-safe palette, so expect some banding)
+func EncodeGIF(w io.Writer, frames []*image.NRGBA, delay time.Duration) error {
+	anim := &gif.GIF{}
+	for _, frame := range frames {
+		paletted := image.NewPaletted(frame.Bounds(), palette.WebSafe)
+		draw.FloydSteinberg.Draw(paletted, frame.Bounds(), frame, frame.Bounds().Min)
+		anim.Image = append(anim.Image, paletted)
+		anim.Delay = append(anim.Delay, int(delay/(10*time.Millisecond))) // 100ths of a second
+	}
+	return gif.EncodeAll(w, anim)
+}
+
+// EncodeAPNG writes frames (all the same size) as a looping animated png, delay apart
+func EncodeAPNG(w io.Writer, frames []*image.NRGBA, delay time.Duration) error {
+	if len(frames) == 0 {
+		return fmt.Errorf("no frames")
+	}
+
+	// each frame is encoded as a png, then its image data moved into the animation
+	var header []byte
+	seq := uint32(0)
+	var body bytes.Buffer
+	for i, frame := range frames {
+		// the encoder leaves out alpha for opaque images, so keep every frame the same
+		opaque := image.NewNRGBA(frame.Bounds())
+		draw.Draw(opaque, opaque.Bounds(), image.NewUniform(color.NRGBA{A: 0xff}), image.Point{}, draw.Src)
+		draw.Draw(opaque, opaque.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, opaque); err != nil {
+			return err
+		}
+		chunks, err := pngChunks(buf.Bytes())
+		if err != nil {
+			return err
+		}
+
+		for _, c := range chunks {
+			if c.kind == "IHDR" {
+				if header == nil {
+					header = c.data
+				} else if !bytes.Equal(header, c.data) {
+					return fmt.Errorf("frame %d is a different size", i)
+				}
+			}
+		}
+
+		// frame control: size, offset, delay, no disposal, replace the previous frame
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[0:], seq)
+		copy(fctl[4:12], header[0:8]) // width and height
+		binary.BigEndian.PutUint16(fctl[20:], uint16(delay/time.Millisecond))
+		binary.BigEndian.PutUint16(fctl[22:], 1000)
+		writeChunk(&body, "fcTL", fctl)
+		seq++
+
+		for _, c := range chunks {
+			if c.kind != "IDAT" {
+				continue
+			}
+			if i == 0 {
+				// the first frame doubles as the still image
+				writeChunk(&body, "IDAT", c.data)
+				continue
+			}
+			data := make([]byte, 4+len(c.data))
+			binary.BigEndian.PutUint32(data, seq)
+			copy(data[4:], c.data)
+			writeChunk(&body, "fdAT", data)
+			seq++
+		}
+	}
+
+	// animation control: frame count, looping forever
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl, uint32(len(frames)))
+
+	var out bytes.Buffer
+	out.WriteString(pngSignature)
+	writeChunk(&out, "IHDR", header)
+	writeChunk(&out, "acTL", actl)
+	out.Write(body.Bytes())
+	writeChunk(&out, "IEND", nil)
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+type pngChunk struct {
+	kind string
+	data []byte
+}
+
+// pngChunks splits an encoded png into its chunks
+func pngChunks(b []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(b, []byte(pngSignature)) {
+		return nil, fmt.Errorf("not a png")
+	}
+	b = b[len(pngSignature):]
+
+	var chunks []pngChunk
+	for len(b) >= 12 {
+		n := int(binary.BigEndian.Uint32(b))
+		if len(b) < 12+n {
+			return nil, fmt.Errorf("truncated png chunk")
+		}
+		chunks = append(chunks, pngChunk{kind: string(b[4:8]), data: b[8 : 8+n]})
+		b = b[12+n:]
+	}
+	return chunks, nil
+}
+
+func writeChunk(w *bytes.Buffer, kind string, data []byte) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(data)))
+	w.Write(n[:])
+
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(kind))
+	crc.Write(data)
+	w.WriteString(kind)
+	w.Write(data)
+	binary.BigEndian.PutUint32(n[:], crc.Sum32())
+	w.Write(n[:])
+}
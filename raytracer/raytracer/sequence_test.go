@@ -0,0 +1,79 @@
+package raytracer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+	"time"
+)
+
+func testFrames(n int) []*image.NRGBA {
+	frames := make([]*image.NRGBA, n)
+	for i := range frames {
+		img := image.NewNRGBA(image.Rect(0, 0, 8, 6))
+		for p := 0; p < len(img.Pix); p += 4 {
+			img.Pix[p], img.Pix[p+1], img.Pix[p+2], img.Pix[p+3] = uint8(i*60), uint8(p), 0x80, 0xff
+		}
+		frames[i] = img
+	}
+	return frames
+}
+
+func TestEncodeGIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodeGIF(&buf, testFrames(3), 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 3 || anim.Delay[0] != 5 {
+		t.Errorf("got %d frames with delay %v, want 3 with delay 5", len(anim.Image), anim.Delay)
+	}
+}
+
+func TestEncodeAPNG(t *testing.T) {
+	frames := testFrames(3)
+	var buf bytes.Buffer
+	if err := EncodeAPNG(&buf, frames, 40*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	// players without apng support show the first frame
+	still, err := png.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := color.NRGBAModel.Convert(still.At(3, 2)), frames[0].At(3, 2); got != want {
+		t.Errorf("still image pixel = %v, want %v", got, want)
+	}
+
+	chunks, err := pngChunks(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []string
+	for _, c := range chunks {
+		kinds = append(kinds, c.kind)
+	}
+	want := []string{"IHDR", "acTL", "fcTL", "IDAT", "fcTL", "fdAT", "fcTL", "fdAT", "IEND"}
+	if len(kinds) != len(want) {
+		t.Fatalf("chunks = %v, want %v", kinds, want)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Fatalf("chunks = %v, want %v", kinds, want)
+		}
+	}
+}
+
+func TestEncodeAPNGSizeMismatch(t *testing.T) {
+	frames := append(testFrames(1), image.NewNRGBA(image.Rect(0, 0, 4, 4)))
+	if err := EncodeAPNG(&bytes.Buffer{}, frames, time.Second); err == nil {
+		t.Errorf("frames of different sizes encoded without error")
+	}
+}
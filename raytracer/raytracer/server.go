@@ -0,0 +1,548 @@
+package raytracer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RenderServer renders scene files POSTed to it over http, in the background,
+// a sample per pixel at a time, serving their progress and images as they
+// converge:
+//
+//	POST   /jobs                 start rendering the scene file in the body (see below), returning its status
+//	GET    /jobs                 the status of every job
+//	GET    /jobs/{id}            a job's status
+//	DELETE /jobs/{id}            cancel a job (or forget it, once it's finished)
+//	GET    /jobs/{id}/image.png  the image so far
+//	GET    /jobs/{id}/image.exr  the unclamped colour so far, as OpenEXR
+//	GET    /jobs/{id}/events     server-sent events, of the job's status after each pass
+//	GET    /jobs/{id}/stream     motion jpeg, of the image after each pass (for an <img>)
+//
+// POST takes width, height, frame and samples (per pixel) query parameters,
+// which default to the scene file's (or 341x256, frame 0)
+//
+// finished jobs (and their images) are kept until they're deleted, or until
+// there are more than MaxFinished of them, when the oldest are forgotten
+type RenderServer struct {
+	Dir         string // directory scene files' envmaps are loaded from (they can't reach outside it)
+	MaxJobs     int    // jobs rendered at once, 1 if 0 (each render uses every cpu anyway)
+	MaxQueue    int    // jobs waiting their turn before more are turned away, 16 if 0
+	MaxPixels   int    // largest width x height, 4096x4096 if 0
+	MaxSamples  int    // most samples per pixel, 1024 if 0
+	MaxDepth    int    // deepest ray recursion a scene file can ask for, 16 if 0
+	MaxFinished int    // finished jobs kept, 16 if 0
+
+	once    sync.Once
+	slots   chan empty // semaphore pattern, for MaxJobs
+	mu      sync.Mutex
+	jobs    map[string]*job
+	order   []string // job ids, oldest first
+	queued  int
+	envmaps map[string]*image.NRGBA
+}
+
+// JobState is how far along a render job is
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRendering JobState = "rendering"
+	JobDone      JobState = "done"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+)
+
+// finished reports whether a job in this state is over
+func (s JobState) finished() bool {
+	return s == JobDone || s == JobFailed || s == JobCancelled
+}
+
+// JobStatus is a render job, as reported by a RenderServer
+type JobStatus struct {
+	ID           string    `json:"id"`
+	State        JobState  `json:"state"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	Frame        float64   `json:"frame"`
+	Samples      int       `json:"samples"` // per pixel, so far
+	TotalSamples int       `json:"total_samples"`
+	Progress     float64   `json:"progress"` // 0 to 1
+	Error        string    `json:"error,omitempty"`
+	Created      time.Time `json:"created"`
+	Elapsed      float64   `json:"elapsed"` // seconds spent rendering
+}
+
+type job struct {
+	scene  *Scene
+	camera *Camera
+	envmap string // path, loaded when the job starts
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	status  JobStatus
+	img     *image.NRGBA // copies of the image and colour after the last pass (nil before the first)
+	colour  *FloatImage
+	changed chan empty // closed (and replaced) whenever the status changes
+}
+
+func (s *RenderServer) init() {
+	if s.MaxJobs <= 0 {
+		s.MaxJobs = 1
+	}
+	if s.MaxQueue <= 0 {
+		s.MaxQueue = 16
+	}
+	if s.MaxPixels <= 0 {
+		s.MaxPixels = 4096 * 4096
+	}
+	if s.MaxSamples <= 0 {
+		s.MaxSamples = 1024
+	}
+	if s.MaxDepth <= 0 {
+		s.MaxDepth = 16
+	}
+	if s.MaxFinished <= 0 {
+		s.MaxFinished = 16
+	}
+	s.slots = make(chan empty, s.MaxJobs)
+	s.jobs = make(map[string]*job)
+	s.envmaps = make(map[string]*image.NRGBA)
+}
+
+func (s *RenderServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.once.Do(s.init)
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "jobs" || len(parts) > 3 {
+		http.NotFound(w, r)
+		return
+	}
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			s.mu.Lock()
+			statuses := make([]JobStatus, len(s.order))
+			for i, id := range s.order {
+				statuses[i], _ = s.jobs[id].snapshot()
+			}
+			s.mu.Unlock()
+			writeJSON(w, http.StatusOK, statuses)
+		case http.MethodPost:
+			s.post(w, r)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	j := s.jobs[parts[1]]
+	s.mu.Unlock()
+	if j == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if len(parts) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			status, _ := j.snapshot()
+			writeJSON(w, http.StatusOK, status)
+		case http.MethodDelete:
+			s.delete(w, j)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+		}
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	switch parts[2] {
+	case "image.png", "image.exr":
+		j.mu.Lock()
+		img, colour := j.img, j.colour
+		j.mu.Unlock()
+		if img == nil {
+			http.Error(w, "no image yet", http.StatusNotFound)
+			return
+		}
+		if parts[2] == "image.png" {
+			w.Header().Set("Content-Type", "image/png")
+			png.Encode(w, img)
+			return
+		}
+		w.Header().Set("Content-Type", "image/x-exr")
+		EncodeEXR(w, []EXRLayer{{Channels: []string{"R", "G", "B"}, Image: colour}}, false)
+	case "events":
+		j.events(w, r)
+	case "stream":
+		j.stream(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// post starts a job rendering the scene file in the request
+func (s *RenderServer) post(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	file, err := ParseSceneFile(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	width, height := file.Width, file.Height
+	if width <= 0 || height <= 0 {
+		width, height = 341, 256
+	}
+	width, err1 := intParam(q.Get("width"), width)
+	height, err2 := intParam(q.Get("height"), height)
+	samples, err3 := intParam(q.Get("samples"), file.Camera.Samples)
+	frame, err4 := 0.0, error(nil)
+	if f := q.Get("frame"); f != "" {
+		frame, err4 = strconv.ParseFloat(f, 64)
+	}
+	for _, err := range []error{err1, err2, err3, err4} {
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	switch {
+	case width <= 0 || height <= 0:
+		http.Error(w, fmt.Sprintf("%dx%d isn't a size", width, height), http.StatusBadRequest)
+		return
+	case width > s.MaxPixels/height: // (width*height could overflow)
+		http.Error(w, fmt.Sprintf("%dx%d is too big (up to %d pixels)", width, height, s.MaxPixels), http.StatusBadRequest)
+		return
+	case samples > s.MaxSamples:
+		http.Error(w, fmt.Sprintf("%d samples is too many (up to %d)", samples, s.MaxSamples), http.StatusBadRequest)
+		return
+	case file.MaxDepth > s.MaxDepth:
+		// (a column of pixels is rendered before a cancelled job stops)
+		http.Error(w, fmt.Sprintf("a max_depth of %d is too deep (up to %d)", file.MaxDepth, s.MaxDepth), http.StatusBadRequest)
+		return
+	}
+
+	// the envmap's loaded when the job starts, as that can take a while
+	scene, camera, err := file.Build(nil, frame)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	camera.Samples = samples
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		scene:  scene,
+		camera: camera,
+		cancel: cancel,
+		status: JobStatus{
+			ID:           hex.EncodeToString(id),
+			State:        JobQueued,
+			Width:        width,
+			Height:       height,
+			Frame:        frame,
+			TotalSamples: camera.SampleCount(),
+			Created:      time.Now(),
+		},
+		changed: make(chan empty),
+	}
+	if file.EnvMap != "" {
+		// (cleaned as an absolute path, so it can't climb out of Dir)
+		j.envmap = filepath.Join(s.Dir, filepath.FromSlash(path.Clean("/"+filepath.ToSlash(file.EnvMap))))
+	}
+
+	s.mu.Lock()
+	if s.queued >= s.MaxQueue {
+		s.mu.Unlock()
+		cancel()
+		http.Error(w, "too many jobs queued", http.StatusServiceUnavailable)
+		return
+	}
+	s.queued++
+	s.jobs[j.status.ID] = j
+	s.order = append(s.order, j.status.ID)
+	s.mu.Unlock()
+
+	go s.run(ctx, j)
+
+	w.Header().Set("Location", "/jobs/"+j.status.ID)
+	status, _ := j.snapshot()
+	writeJSON(w, http.StatusCreated, status)
+}
+
+// delete cancels a job, or forgets it if it's finished
+func (s *RenderServer) delete(w http.ResponseWriter, j *job) {
+	status, _ := j.snapshot()
+	if !status.State.finished() {
+		j.cancel()
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	s.mu.Lock()
+	s.forgetLocked(status.ID)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// forgetLocked drops a job (with s.mu held)
+func (s *RenderServer) forgetLocked(id string) {
+	delete(s.jobs, id)
+	for i, other := range s.order {
+		if other == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// evict forgets the oldest finished jobs, beyond MaxFinished
+func (s *RenderServer) evict() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var finished []string
+	for _, id := range s.order {
+		if status, _ := s.jobs[id].snapshot(); status.State.finished() {
+			finished = append(finished, id)
+		}
+	}
+	for len(finished) > s.MaxFinished {
+		s.forgetLocked(finished[0])
+		finished = finished[1:]
+	}
+}
+
+// run waits for a slot, then renders the job
+func (s *RenderServer) run(ctx context.Context, j *job) {
+	defer s.evict()
+	defer j.cancel()
+
+	select {
+	case s.slots <- empty{}:
+	case <-ctx.Done():
+		s.dequeue()
+		j.finish(nil, ctx.Err())
+		return
+	}
+	defer func() { <-s.slots }()
+	s.dequeue()
+
+	began := time.Now()
+	j.setState(JobRendering)
+	envmap, err := s.envmap(j.envmap)
+	if err != nil {
+		j.finish(nil, err)
+		return
+	}
+	j.scene.EnvMap = envmap
+
+	width, height := j.status.Width, j.status.Height
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	passes := NewPasses(width, height)
+	err = RenderProgressive(ctx, img, width, height, j.camera, j.scene, passes, func(samples int) {
+		j.update(img, passes.Colour, samples, time.Since(began))
+	})
+	j.finish(&began, err)
+}
+
+// dequeue counts a job leaving the queue
+func (s *RenderServer) dequeue() {
+	s.mu.Lock()
+	s.queued--
+	s.mu.Unlock()
+}
+
+// envmap loads (or recalls) an envmap, or returns a black one if path is ""
+func (s *RenderServer) envmap(path string) (*image.NRGBA, error) {
+	if path == "" {
+		img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+		img.Pix[3] = 0xff
+		return img, nil
+	}
+	s.mu.Lock()
+	img := s.envmaps[path]
+	s.mu.Unlock()
+	if img != nil {
+		return img, nil
+	}
+	img, err := LoadImage(path)
+	if err != nil {
+		return nil, fmt.Errorf("envmap: %w", err)
+	}
+	s.mu.Lock()
+	s.envmaps[path] = img
+	s.mu.Unlock()
+	return img, nil
+}
+
+// snapshot returns the job's status, and a channel that's closed when it next changes
+func (j *job) snapshot() (JobStatus, chan empty) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status, j.changed
+}
+
+// changedLocked tells anyone watching that the status has changed
+func (j *job) changedLocked() {
+	close(j.changed)
+	j.changed = make(chan empty)
+}
+
+func (j *job) setState(state JobState) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.State = state
+	j.changedLocked()
+}
+
+// update copies out the image and colour after a pass
+func (j *job) update(img *image.NRGBA, colour *FloatImage, samples int, elapsed time.Duration) {
+	c := &FloatImage{Width: colour.Width, Height: colour.Height, Pix: append([]Vector3f(nil), colour.Pix...)}
+	i := &image.NRGBA{Pix: append([]uint8(nil), img.Pix...), Stride: img.Stride, Rect: img.Rect}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.img, j.colour = i, c
+	j.status.Samples = samples
+	j.status.Progress = float64(samples) / float64(j.status.TotalSamples)
+	j.status.Elapsed = elapsed.Seconds()
+	j.changedLocked()
+}
+
+// finish ends the job, which failed with err (if not nil), having started
+// rendering at began (if it got that far)
+func (j *job) finish(began *time.Time, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch {
+	case errors.Is(err, context.Canceled):
+		j.status.State = JobCancelled
+	case err != nil:
+		j.status.State = JobFailed
+		j.status.Error = err.Error()
+	default:
+		j.status.State = JobDone
+	}
+	if began != nil {
+		j.status.Elapsed = time.Since(*began).Seconds()
+	}
+	j.changedLocked()
+}
+
+// events sends the job's status as server-sent events, until it's finished
+func (j *job) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	for {
+		status, changed := j.snapshot()
+		data, _ := json.Marshal(status)
+		if _, err := fmt.Fprintf(w, "event: status\ndata: %s\n\n", data); err != nil {
+			return
+		}
+		flusher.Flush()
+		if status.State.finished() {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// stream sends the image after each pass as motion jpeg, until the job's finished
+func (j *job) stream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	mw := multipart.NewWriter(w)
+	defer mw.Close()
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+mw.Boundary())
+	w.Header().Set("Cache-Control", "no-cache")
+
+	var sent *image.NRGBA
+	for {
+		j.mu.Lock()
+		status, changed, img := j.status, j.changed, j.img
+		j.mu.Unlock()
+
+		if img != nil && img != sent {
+			part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"image/jpeg"}})
+			if err != nil {
+				return
+			}
+			if err := jpeg.Encode(part, img, &jpeg.Options{Quality: 90}); err != nil {
+				return
+			}
+			flusher.Flush()
+			sent = img
+		}
+		if status.State.finished() {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// intParam parses an integer query parameter, which is def if missing
+func intParam(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	return strconv.Atoi(s)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,288 @@
+package raytracer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderProgressive(t *testing.T) {
+	const width, height = 40, 30
+	want := image.NewNRGBA(image.Rect(0, 0, width, height))
+	Render(want, width, height, &Camera{FOV: math.Pi / 3, Samples: 4, Seed: 1}, testScene())
+
+	camera := &Camera{FOV: math.Pi / 3, Samples: 4, Seed: 1}
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	var passes []int
+	err := RenderProgressive(context.Background(), img, width, height, camera, testScene(), nil, func(samples int) {
+		passes = append(passes, samples)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passes) != 4 || passes[3] != 4 {
+		t.Errorf("passes = %v, want 1 to 4", passes)
+	}
+	if !bytes.Equal(img.Pix, want.Pix) {
+		t.Errorf("progressive render differs from Render")
+	}
+
+	// cancelling stops after the pass
+	ctx, cancel := context.WithCancel(context.Background())
+	passes = nil
+	err = RenderProgressive(ctx, img, width, height, camera, testScene(), nil, func(samples int) {
+		passes = append(passes, samples)
+		cancel()
+	})
+	if err != context.Canceled || len(passes) != 1 {
+		t.Errorf("cancelled after %v, with %v", passes, err)
+	}
+}
+
+// postJob posts a scene file to the server, returning the job's status
+func postJob(t *testing.T, url string, scene []byte, query string) (JobStatus, int) {
+	t.Helper()
+	resp, err := http.Post(url+"/jobs?"+query, "application/json", bytes.NewReader(scene))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var status JobStatus
+	if resp.StatusCode == http.StatusCreated {
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+		if loc := resp.Header.Get("Location"); loc != "/jobs/"+status.ID {
+			t.Errorf("Location = %q", loc)
+		}
+	}
+	return status, resp.StatusCode
+}
+
+// waitJob follows a job's events until it's finished, returning its statuses
+func waitJob(t *testing.T, url, id string) []JobStatus {
+	t.Helper()
+	resp, err := http.Get(url + "/jobs/" + id + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("events Content-Type = %q", ct)
+	}
+
+	var statuses []JobStatus
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if data := strings.TrimPrefix(scanner.Text(), "data: "); data != scanner.Text() {
+			var status JobStatus
+			if err := json.Unmarshal([]byte(data), &status); err != nil {
+				t.Fatal(err)
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	if len(statuses) == 0 || !statuses[len(statuses)-1].State.finished() {
+		t.Fatalf("events ended before the job finished: %v", statuses)
+	}
+	return statuses
+}
+
+func TestRenderServer(t *testing.T) {
+	scene, dir := testSceneFile(t)
+	server := httptest.NewServer(&RenderServer{Dir: dir})
+	defer server.Close()
+
+	status, code := postJob(t, server.URL, scene, "width=48&height=36&samples=3&frame=20")
+	if code != http.StatusCreated {
+		t.Fatalf("POST = %v", code)
+	}
+	statuses := waitJob(t, server.URL, status.ID)
+	last := statuses[len(statuses)-1]
+	if last.State != JobDone || last.Samples != 3 || last.Progress != 1 {
+		t.Errorf("finished with %+v", last)
+	}
+
+	// the image is the same as rendering the scene file directly
+	file, _ := ParseSceneFile(scene)
+	envmap, _ := LoadImage(file.EnvMapPath(dir))
+	s, camera, _ := file.Build(envmap, 20)
+	camera.Samples = 3
+	want := image.NewNRGBA(image.Rect(0, 0, 48, 36))
+	Render(want, 48, 36, camera, s)
+
+	resp, err := http.Get(server.URL + "/jobs/" + status.ID + "/image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := image.NewNRGBA(img.Bounds())
+	draw.Draw(got, got.Bounds(), img, image.Point{}, draw.Src)
+	if !bytes.Equal(got.Pix, want.Pix) {
+		t.Errorf("served image differs from a direct render")
+	}
+
+	resp, err = http.Get(server.URL + "/jobs/" + status.ID + "/image.exr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exr, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.HasPrefix(exr, []byte{0x76, 0x2f, 0x31, 0x01}) {
+		t.Errorf("image.exr isn't an EXR file")
+	}
+
+	// a finished job's stream is its final image
+	resp, err = http.Get(server.URL + "/jobs/" + status.ID + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	part, err := multipart.NewReader(resp.Body, params["boundary"]).NextPart()
+	if err != nil || part.Header.Get("Content-Type") != "image/jpeg" {
+		t.Errorf("stream part %v, %v", part, err)
+	}
+	resp.Body.Close()
+
+	// bad requests
+	for _, bad := range []struct {
+		scene, query string
+	}{
+		{`{"spheres": [{"radius": 1, "material": "unobtainium"}]}`, ""},
+		{`not json`, ""},
+		{string(scene), "width=100000&height=100000"},
+		{string(scene), "width=4097&height=4096"},
+		{string(scene), "width=4294967296&height=4294967296"}, // (overflows width*height)
+		{string(scene), "width=9223372036854775807&height=2"},
+		{string(scene), "width=-4&height=-4"},
+		{`{"camera": {}}`, "width=4294967296&height=4294967296"},
+		{string(scene), "samples=lots"},
+		{`{"max_depth": 100000}`, ""},
+		{`{"max_depth": -1}`, ""},
+	} {
+		if _, code := postJob(t, server.URL, []byte(bad.scene), bad.query); code != http.StatusBadRequest {
+			t.Errorf("POST %.20s?%s = %v, want 400", bad.scene, bad.query, code)
+		}
+	}
+
+	// forgetting the job
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+"/jobs/"+status.ID, nil)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE = %v, %v", resp.StatusCode, err)
+	}
+	if resp, err := http.Get(server.URL + "/jobs/" + status.ID); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET deleted job = %v, %v", resp.StatusCode, err)
+	}
+}
+
+func TestRenderServerLimits(t *testing.T) {
+	scene, dir := testSceneFile(t)
+	server := httptest.NewServer(&RenderServer{Dir: dir, MaxJobs: 1, MaxQueue: 1})
+	defer server.Close()
+
+	// a long job renders, the next waits its turn, and there's no room for a third
+	slow, code := postJob(t, server.URL, scene, "width=200&height=150&samples=1000")
+	if code != http.StatusCreated {
+		t.Fatalf("POST = %v", code)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		resp, err := http.Get(server.URL + "/jobs/" + slow.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewDecoder(resp.Body).Decode(&slow)
+		resp.Body.Close()
+		if slow.State == JobRendering || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	queued, code := postJob(t, server.URL, scene, "width=8&height=8")
+	if code != http.StatusCreated || queued.State != JobQueued {
+		t.Fatalf("second POST = %v, %v", code, queued.State)
+	}
+	if _, code := postJob(t, server.URL, scene, "width=8&height=8"); code != http.StatusServiceUnavailable {
+		t.Errorf("third POST = %v, want 503", code)
+	}
+
+	// cancelling the long job lets the next one run
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+"/jobs/"+slow.ID, nil)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("DELETE = %v, %v", resp, err)
+	}
+	if statuses := waitJob(t, server.URL, slow.ID); statuses[len(statuses)-1].State != JobCancelled {
+		t.Errorf("cancelled job finished as %v", statuses[len(statuses)-1].State)
+	}
+	if statuses := waitJob(t, server.URL, queued.ID); statuses[len(statuses)-1].State != JobDone {
+		t.Errorf("queued job finished as %v", statuses[len(statuses)-1].State)
+	}
+
+	resp, err := http.Get(server.URL + "/jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all []JobStatus
+	json.NewDecoder(resp.Body).Decode(&all)
+	resp.Body.Close()
+	if len(all) != 2 || all[0].ID != slow.ID || all[1].ID != queued.ID {
+		t.Errorf("jobs = %+v, want the two accepted, in order", all)
+	}
+}
+
+func TestRenderServerEviction(t *testing.T) {
+	scene, dir := testSceneFile(t)
+	server := httptest.NewServer(&RenderServer{Dir: dir, MaxFinished: 2})
+	defer server.Close()
+
+	var ids []string
+	for i := 0; i < 4; i++ {
+		status, code := postJob(t, server.URL, scene, "width=8&height=8")
+		if code != http.StatusCreated {
+			t.Fatalf("POST = %v", code)
+		}
+		waitJob(t, server.URL, status.ID)
+		ids = append(ids, status.ID)
+	}
+
+	// (each job's evicted the others as it finished, just after)
+	var all []JobStatus
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		resp, err := http.Get(server.URL + "/jobs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = nil
+		json.NewDecoder(resp.Body).Decode(&all)
+		resp.Body.Close()
+		if len(all) <= 2 {
+			break
+		}
+	}
+	if len(all) != 2 || all[0].ID != ids[2] || all[1].ID != ids[3] {
+		t.Errorf("jobs = %+v, want the last two", all)
+	}
+	if resp, err := http.Get(server.URL + "/jobs/" + ids[0] + "/image.png"); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET evicted job's image = %v, %v", resp.StatusCode, err)
+	}
+}
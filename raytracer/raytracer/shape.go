@@ -27,3 +27,97 @@ func (s *Sphere) RayIntersect(origin Vector3f, direction Vector3f, t0 *float64)
 	}
 	return *t0 > 0.0
 }
+
+// SurfaceAt returns the surface geometry at point (which should lie on the sphere)
+// uvs use the same equirectangular mapping as the envmap
+func (s *Sphere) SurfaceAt(point Vector3f) Hit {
+	n := point.Sub(s.Centre).Normalised()
+
+	// tangent follows lines of latitude (d/du), bitangent runs pole to pole (d/dv)
+	t := Vector3f{X: -n.Z, Y: 0, Z: n.X}
+	if t.Norm() < 1e-9 {
+		t, _ = OrthonormalBasis(n) // at a pole
+	}
+	t = t.Normalised()
+
+	return Hit{
+		Point:     point,
+		Local:     point.Sub(s.Centre),
+		Normal:    n,
+		Tangent:   t,
+		Bitangent: n.Cross(t),
+		U:         0.5 + (math.Atan2(n.Z, n.X) / (2 * math.Pi)),
+		V:         0.5 - (math.Asin(n.Y) / math.Pi),
+		Material:  &s.Material,
+	}
+}
+
+func (s *Sphere) Intersect(ray Ray, tMax float64) (float64, Hit, bool) {
+	origin, direction := ray.Origin, ray.Direction
+	var t float64
+	if !s.RayIntersect(origin, direction, &t) || t >= tMax {
+		return 0, Hit{}, false
+	}
+	return t, s.SurfaceAt(origin.Add(direction.Multiply(t))), true
+}
+
+func (s *Sphere) Bounds() AABB {
+	r := Vector3f{X: s.Radius, Y: s.Radius, Z: s.Radius}
+	return AABB{Min: s.Centre.Sub(r), Max: s.Centre.Add(r)}
+}
+
+// Plane is an infinite plane through Point, facing Normal
+type Plane struct {
+	Point    Vector3f
+	Normal   Vector3f
+	Material Material
+	TileSize float64 // world-space size of one texture repeat (defaults to 1)
+}
+
+// check if a given ray (originating from origin, with direction) intersects with plane
+func (p *Plane) RayIntersect(origin Vector3f, direction Vector3f, t0 *float64) bool {
+	n := p.Normal.Normalised()
+	denom := direction.Dot(n)
+	if math.Abs(denom) < 1.0/1000 {
+		return false // parallel to the plane
+	}
+	*t0 = p.Point.Sub(origin).Dot(n) / denom
+	return *t0 > 0.0
+}
+
+// SurfaceAt returns the surface geometry at point (which should lie on the plane)
+func (p *Plane) SurfaceAt(point Vector3f) Hit {
+	n := p.Normal.Normalised()
+	t, b := OrthonormalBasis(n)
+
+	size := p.TileSize
+	if size == 0 {
+		size = 1
+	}
+	d := point.Sub(p.Point).Multiply(1 / size)
+	u, v := d.Dot(t), d.Dot(b)
+
+	return Hit{
+		Point:     point,
+		Local:     point.Sub(p.Point),
+		Normal:    n,
+		Tangent:   t,
+		Bitangent: b,
+		U:         u - math.Floor(u),
+		V:         v - math.Floor(v),
+		Material:  &p.Material,
+	}
+}
+
+func (p *Plane) Intersect(ray Ray, tMax float64) (float64, Hit, bool) {
+	origin, direction := ray.Origin, ray.Direction
+	var t float64
+	if !p.RayIntersect(origin, direction, &t) || t >= tMax {
+		return 0, Hit{}, false
+	}
+	return t, p.SurfaceAt(origin.Add(direction.Multiply(t))), true
+}
+
+func (p *Plane) Bounds() AABB {
+	return InfiniteAABB()
+}
@@ -0,0 +1,211 @@
+package raytracer
+
+import (
+	"math"
+	"testing"
+)
+
+const testEpsilon = 1e-6
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < testEpsilon
+}
+
+func nearVec(a, b Vector3f) bool {
+	return near(a.X, b.X) && near(a.Y, b.Y) && near(a.Z, b.Z)
+}
+
+// rayCase is a ray against a shape, and where (if anywhere) it should hit
+type rayCase struct {
+	name       string
+	origin     Vector3f
+	direction  Vector3f
+	miss       bool
+	wantT      float64
+	wantNormal Vector3f
+}
+
+func checkRays(t *testing.T, s Shape, cases []rayCase) {
+	t.Helper()
+	for _, c := range cases {
+		ray := Ray{Origin: c.origin, Direction: c.direction.Normalised()}
+		dist, hit, ok := s.Intersect(ray, math.MaxFloat64)
+		if c.miss {
+			if ok {
+				t.Errorf("%s: expected miss, hit at t=%v (%v)", c.name, dist, hit.Point)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%s: expected hit at t=%v, missed", c.name, c.wantT)
+			continue
+		}
+		if !near(dist, c.wantT) {
+			t.Errorf("%s: t = %v, want %v", c.name, dist, c.wantT)
+		}
+		if !nearVec(hit.Normal, c.wantNormal) {
+			t.Errorf("%s: normal = %v, want %v", c.name, hit.Normal, c.wantNormal)
+		}
+		if want := ray.At(dist); !nearVec(hit.Point, want) {
+			t.Errorf("%s: point = %v, want %v", c.name, hit.Point, want)
+		}
+		if !near(hit.Tangent.Dot(hit.Normal), 0) || !near(hit.Tangent.Norm(), 1) {
+			t.Errorf("%s: tangent %v is not a unit vector perpendicular to the normal", c.name, hit.Tangent)
+		}
+		if hit.U < 0 || hit.U > 1 || hit.V < 0 || hit.V > 1 {
+			t.Errorf("%s: uv (%v, %v) out of range", c.name, hit.U, hit.V)
+		}
+		if hit.Material == nil {
+			t.Errorf("%s: no material", c.name)
+		}
+
+		// nothing should be hit if tMax is before the hit
+		if _, _, ok := s.Intersect(ray, dist*0.99); ok {
+			t.Errorf("%s: hit beyond tMax", c.name)
+		}
+	}
+}
+
+func TestSphereIntersect(t *testing.T) {
+	s := &Sphere{Centre: Vector3f{Z: -5}, Radius: 1}
+	checkRays(t, s, []rayCase{
+		{name: "front", direction: Vector3f{Z: -1}, wantT: 4, wantNormal: Vector3f{Z: 1}},
+		{name: "inside", origin: Vector3f{Z: -5}, direction: Vector3f{X: 1}, wantT: 1, wantNormal: Vector3f{X: 1}},
+		{name: "graze inside", origin: Vector3f{X: 0.999}, direction: Vector3f{Z: -1}, wantT: 5 - math.Sqrt(1-0.999*0.999), wantNormal: Vector3f{X: 0.999, Z: math.Sqrt(1 - 0.999*0.999)}},
+		{name: "graze outside", origin: Vector3f{X: 1.001}, direction: Vector3f{Z: -1}, miss: true},
+		{name: "behind", direction: Vector3f{Z: 1}, miss: true},
+	})
+}
+
+func TestBoxIntersect(t *testing.T) {
+	b := &Box{Min: Vector3f{X: -1, Y: -1, Z: -6}, Max: Vector3f{X: 1, Y: 1, Z: -4}}
+	checkRays(t, b, []rayCase{
+		{name: "front", direction: Vector3f{Z: -1}, wantT: 4, wantNormal: Vector3f{Z: 1}},
+		{name: "side", origin: Vector3f{X: -5, Z: -5}, direction: Vector3f{X: 1}, wantT: 4, wantNormal: Vector3f{X: -1}},
+		{name: "inside", origin: Vector3f{Z: -5}, direction: Vector3f{Y: 1}, wantT: 1, wantNormal: Vector3f{Y: 1}},
+		{name: "graze inside", origin: Vector3f{X: 0.999}, direction: Vector3f{Z: -1}, wantT: 4, wantNormal: Vector3f{Z: 1}},
+		{name: "graze outside", origin: Vector3f{X: 1.001}, direction: Vector3f{Z: -1}, miss: true},
+		{name: "diagonal miss", direction: Vector3f{X: 1, Z: -1}, miss: true},
+	})
+}
+
+func TestOrientedBoxIntersect(t *testing.T) {
+	// a unit cube rotated 45 degrees around y, so a corner faces the camera
+	s := math.Sqrt(0.5)
+	b := &OrientedBox{
+		Centre:   Vector3f{Z: -5},
+		Axes:     [3]Vector3f{{X: s, Z: s}, {Y: 1}, {X: -s, Z: s}},
+		HalfSize: Vector3f{X: 1, Y: 1, Z: 1},
+	}
+	checkRays(t, b, []rayCase{
+		{name: "face", origin: Vector3f{X: 0.5}, direction: Vector3f{Z: -1}, wantT: 5 - math.Sqrt2 + 0.5, wantNormal: Vector3f{X: s, Z: s}},
+		{name: "inside", origin: Vector3f{Z: -5}, direction: Vector3f{Y: -1}, wantT: 1, wantNormal: Vector3f{Y: -1}},
+		{name: "graze outside", origin: Vector3f{X: math.Sqrt2 + 0.001}, direction: Vector3f{Z: -1}, miss: true},
+	})
+	if bounds := b.Bounds(); !near(bounds.Max.X, math.Sqrt2) || !near(bounds.Min.Z, -5-math.Sqrt2) {
+		t.Errorf("bounds = %v", bounds)
+	}
+}
+
+func TestCylinderIntersect(t *testing.T) {
+	c := &Cylinder{Base: Vector3f{Y: -1, Z: -5}, Axis: Vector3f{Y: 1}, Radius: 1, Height: 2}
+	checkRays(t, c, []rayCase{
+		{name: "side", direction: Vector3f{Z: -1}, wantT: 4, wantNormal: Vector3f{Z: 1}},
+		{name: "top cap", origin: Vector3f{Y: 5, Z: -5}, direction: Vector3f{Y: -1}, wantT: 4, wantNormal: Vector3f{Y: 1}},
+		{name: "bottom cap", origin: Vector3f{Y: -5, Z: -5}, direction: Vector3f{Y: 1}, wantT: 4, wantNormal: Vector3f{Y: -1}},
+		{name: "inside side", origin: Vector3f{Z: -5}, direction: Vector3f{X: 1}, wantT: 1, wantNormal: Vector3f{X: 1}},
+		{name: "inside cap", origin: Vector3f{Z: -5}, direction: Vector3f{Y: 1}, wantT: 1, wantNormal: Vector3f{Y: 1}},
+		{name: "graze inside", origin: Vector3f{X: 0.999}, direction: Vector3f{Z: -1}, wantT: 5 - math.Sqrt(1-0.999*0.999), wantNormal: Vector3f{X: 0.999, Z: math.Sqrt(1 - 0.999*0.999)}},
+		{name: "graze outside", origin: Vector3f{X: 1.001}, direction: Vector3f{Z: -1}, miss: true},
+		{name: "over the top", origin: Vector3f{Y: 1.001}, direction: Vector3f{Z: -1}, miss: true},
+	})
+}
+
+func TestConeIntersect(t *testing.T) {
+	// 45 degree cone, apex at y=1
+	c := &Cone{Base: Vector3f{Y: -1, Z: -5}, Axis: Vector3f{Y: 1}, Radius: 2, Height: 2}
+	s := math.Sqrt(0.5)
+	checkRays(t, c, []rayCase{
+		{name: "side", direction: Vector3f{Z: -1}, wantT: 4, wantNormal: Vector3f{Y: s, Z: s}},
+		{name: "base", origin: Vector3f{Y: -5, Z: -5}, direction: Vector3f{Y: 1}, wantT: 4, wantNormal: Vector3f{Y: -1}},
+		{name: "inside", origin: Vector3f{Z: -5}, direction: Vector3f{X: 1}, wantT: 1, wantNormal: Vector3f{X: s, Y: s}},
+		{name: "inside base", origin: Vector3f{Z: -5}, direction: Vector3f{Y: -1}, wantT: 1, wantNormal: Vector3f{Y: -1}},
+		{name: "above apex", origin: Vector3f{Y: 1.001}, direction: Vector3f{Z: -1}, miss: true},
+		{name: "graze outside", origin: Vector3f{X: 2.001, Y: -0.999}, direction: Vector3f{Z: -1}, miss: true},
+	})
+}
+
+func TestCapsuleIntersect(t *testing.T) {
+	c := &Capsule{A: Vector3f{Y: -1, Z: -5}, B: Vector3f{Y: 1, Z: -5}, Radius: 1}
+	checkRays(t, c, []rayCase{
+		{name: "middle", direction: Vector3f{Z: -1}, wantT: 4, wantNormal: Vector3f{Z: 1}},
+		{name: "top", origin: Vector3f{Y: 5, Z: -5}, direction: Vector3f{Y: -1}, wantT: 3, wantNormal: Vector3f{Y: 1}},
+		{name: "bottom end", origin: Vector3f{Y: -1.5}, direction: Vector3f{Z: -1}, wantT: 5 - math.Sqrt(0.75), wantNormal: Vector3f{Y: -0.5, Z: math.Sqrt(0.75)}},
+		{name: "inside", origin: Vector3f{Z: -5}, direction: Vector3f{Y: 1}, wantT: 2, wantNormal: Vector3f{Y: 1}},
+		{name: "graze outside", origin: Vector3f{X: 1.001}, direction: Vector3f{Z: -1}, miss: true},
+		{name: "past the end", origin: Vector3f{Y: 2.001}, direction: Vector3f{Z: -1}, miss: true},
+	})
+}
+
+func TestTorusIntersect(t *testing.T) {
+	tr := &Torus{Centre: Vector3f{Z: -10}, Axis: Vector3f{Y: 1}, MajorRadius: 2, MinorRadius: 0.5}
+	checkRays(t, tr, []rayCase{
+		{name: "through the hole", origin: Vector3f{Y: 5, Z: -10}, direction: Vector3f{Y: -1}, miss: true},
+		{name: "tube from above", origin: Vector3f{X: 2, Y: 5, Z: -10}, direction: Vector3f{Y: -1}, wantT: 4.5, wantNormal: Vector3f{Y: 1}},
+		{name: "across", origin: Vector3f{X: -10, Z: -10}, direction: Vector3f{X: 1}, wantT: 7.5, wantNormal: Vector3f{X: -1}},
+		{name: "inside tube", origin: Vector3f{X: 2, Z: -10}, direction: Vector3f{X: 1}, wantT: 0.5, wantNormal: Vector3f{X: 1}},
+		{name: "inside hole", origin: Vector3f{Z: -10}, direction: Vector3f{X: -1}, wantT: 1.5, wantNormal: Vector3f{X: 1}},
+		{name: "graze inside", origin: Vector3f{X: -10, Y: 0.499, Z: -10}, direction: Vector3f{X: 1}, wantT: 8 - math.Sqrt(0.25-0.499*0.499), wantNormal: Vector3f{X: -math.Sqrt(0.25 - 0.499*0.499), Y: 0.499}.Multiply(2)},
+		{name: "graze outside", origin: Vector3f{X: -10, Y: 0.501, Z: -10}, direction: Vector3f{X: 1}, miss: true},
+	})
+}
+
+func TestInstanceIntersect(t *testing.T) {
+	// a unit sphere stretched into an ellipsoid along x
+	e := &Instance{
+		Shape:     &Sphere{Radius: 1},
+		Transform: Scale(Vector3f{X: 2, Y: 1, Z: 1}).Then(Translate(Vector3f{Z: -5})),
+	}
+	checkRays(t, e, []rayCase{
+		{name: "front", direction: Vector3f{Z: -1}, wantT: 4, wantNormal: Vector3f{Z: 1}},
+		{name: "end", origin: Vector3f{X: 5, Z: -5}, direction: Vector3f{X: -1}, wantT: 3, wantNormal: Vector3f{X: 1}},
+		{name: "inside", origin: Vector3f{Z: -5}, direction: Vector3f{X: 1}, wantT: 2, wantNormal: Vector3f{X: 1}},
+		{name: "beyond the unscaled radius", origin: Vector3f{X: 1.5}, direction: Vector3f{Z: -1}, wantT: 5 - math.Sqrt(1-0.75*0.75), wantNormal: Vector3f{X: 0.75 / 2, Z: math.Sqrt(1 - 0.75*0.75)}.Normalised()},
+	})
+}
+
+func TestInstanceNormals(t *testing.T) {
+	// an ellipsoid, rotated and stretched unevenly: its normals must match the
+	// gradient of its implicit surface (x/a)^2 + (y/b)^2 + (z/c)^2 = 1, which
+	// transforming them like directions would get wrong
+	scale := Vector3f{X: 3, Y: 1, Z: 0.5}
+	rotate := RotateY(0.7).Then(RotateX(-0.4))
+	e := &Instance{
+		Shape:     &Sphere{Radius: 1},
+		Transform: Scale(scale).Then(rotate).Then(Translate(Vector3f{Z: -10})),
+	}
+	r := NewRNG(3, 4)
+	for i := 0; i < 100; i++ {
+		target := Vector3f{X: r.Float64() - 0.5, Y: r.Float64() - 0.5, Z: -10}
+		ray := Ray{Direction: target.Normalised()}
+		_, hit, ok := e.Intersect(ray, math.MaxFloat64)
+		if !ok {
+			continue
+		}
+		local := rotate.InverseDirection(hit.Point.Sub(Vector3f{Z: -10}))
+		gradient := Vector3f{X: local.X / (scale.X * scale.X), Y: local.Y / (scale.Y * scale.Y), Z: local.Z / (scale.Z * scale.Z)}
+		want := rotate.Direction(gradient).Normalised()
+		if !nearVec(hit.Normal, want) {
+			t.Errorf("normal at %v = %v, want %v", hit.Point, hit.Normal, want)
+		}
+	}
+}
+
+func BenchmarkSphereRayIntersect(b *testing.B) {
+	s := &Sphere{Centre: Vector3f{Z: -10}, Radius: 2}
+	origin, direction := Vector3f{}, Vector3f{X: 0.1, Z: -1}.Normalised()
+	var t float64
+	for i := 0; i < b.N; i++ {
+		s.RayIntersect(origin, direction, &t)
+	}
+}
@@ -0,0 +1,105 @@
+package raytracer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// RenderStats counts the work a render did (set Scene.Stats to collect them)
+type RenderStats struct {
+	PrimaryRays, ReflectionRays, RefractionRays, ShadowRays int64
+
+	BoxTests   int64 // ray-box tests while traversing BVHs
+	ShapeTests int64 // ray-shape tests (of the shapes the BVHs didn't cull)
+
+	Tiles   []time.Duration // how long each tile (a column of pixels) took
+	Elapsed time.Duration
+
+	traced, depths int64 // number and total recursion depth of camera, reflection and refraction rays
+}
+
+// Rays returns the total number of rays cast
+func (s *RenderStats) Rays() int64 {
+	return s.PrimaryRays + s.ReflectionRays + s.RefractionRays + s.ShadowRays
+}
+
+// AverageDepth returns the average recursion depth of the rays traced for
+// colour (0 for camera rays, 1 for their reflections and refractions, ...)
+func (s *RenderStats) AverageDepth() float64 {
+	if s.traced == 0 {
+		return 0
+	}
+	return float64(s.depths) / float64(s.traced)
+}
+
+// trace counts a ray traced for colour at depth (a camera ray at 0)
+// (this and the other counters do nothing for nil, so rays needn't have stats)
+func (s *RenderStats) trace(depth int) {
+	if s == nil {
+		return
+	}
+	s.traced++
+	s.depths += int64(depth)
+	if depth == 0 {
+		s.PrimaryRays++
+	}
+}
+
+func (s *RenderStats) secondary() {
+	if s != nil {
+		s.ReflectionRays++
+		s.RefractionRays++
+	}
+}
+
+func (s *RenderStats) shadow() {
+	if s != nil {
+		s.ShadowRays++
+	}
+}
+
+// add adds a tile's counts (not times) to s
+func (s *RenderStats) add(t *RenderStats) {
+	s.PrimaryRays += t.PrimaryRays
+	s.ReflectionRays += t.ReflectionRays
+	s.RefractionRays += t.RefractionRays
+	s.ShadowRays += t.ShadowRays
+	s.BoxTests += t.BoxTests
+	s.ShapeTests += t.ShapeTests
+	s.traced += t.traced
+	s.depths += t.depths
+}
+
+// String reports the stats over a few lines
+func (s *RenderStats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "rays: %d (%d primary, %d reflection, %d refraction, %d shadow)\n",
+		s.Rays(), s.PrimaryRays, s.ReflectionRays, s.RefractionRays, s.ShadowRays)
+	perRay := 0.0
+	if rays := s.Rays(); rays > 0 {
+		perRay = float64(s.ShapeTests) / float64(rays)
+	}
+	fmt.Fprintf(&b, "intersection tests: %d shape (%.1f per ray), %d box\n", s.ShapeTests, perRay, s.BoxTests)
+	fmt.Fprintf(&b, "average depth: %.2f\n", s.AverageDepth())
+	if len(s.Tiles) > 0 {
+		least, most, total := time.Duration(math.MaxInt64), time.Duration(0), time.Duration(0)
+		for _, d := range s.Tiles {
+			if d < least {
+				least = d
+			}
+			if d > most {
+				most = d
+			}
+			total += d
+		}
+		fmt.Fprintf(&b, "tiles: %d, %v min, %v mean, %v max\n", len(s.Tiles), least, total/time.Duration(len(s.Tiles)), most)
+	}
+	rate := 0.0
+	if s.Elapsed > 0 {
+		rate = float64(s.Rays()) / s.Elapsed.Seconds()
+	}
+	fmt.Fprintf(&b, "elapsed: %v (%.2fM rays/s)", s.Elapsed, rate/1e6)
+	return b.String()
+}
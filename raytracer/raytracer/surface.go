@@ -0,0 +1,133 @@
+package raytracer
+
+import "math"
+
+// Hit describes the local surface geometry at a ray intersection
+type Hit struct {
+	Point     Vector3f
+	Local     Vector3f // point in the shape's own (object) space
+	Normal    Vector3f // geometric normal (unit length, facing out of the shape)
+	Tangent   Vector3f // direction of increasing U
+	Bitangent Vector3f // direction of increasing V
+	U, V      float64  // texture coordinates, in [0,1]
+	Material  *Material
+	Object    int // which of the scene's objects was hit (see Scene.Intersect)
+}
+
+// ShadingNormal returns the normal to shade with at hit, perturbed by the
+// material's normal map and bump map (if any)
+func (m *Material) ShadingNormal(hit Hit) Vector3f {
+	n := hit.Normal
+	t, b := hit.Tangent, hit.Bitangent
+
+	if m.NormalMap != nil {
+		// which way round the frame is (uvs can be mirrored), to keep after
+		// re-orthogonalising
+		handedness := sign(b.Dot(n.Cross(t)))
+
+		// tangent-space normal, stored as rgb in [0,1] -> xyz in [-1,1]
+		c := m.NormalMap.Evaluate(hit)
+		x, y, z := c.X*2-1, c.Y*2-1, c.Z*2-1
+		n = t.Multiply(x).Add(b.Multiply(y)).Add(n.Multiply(z)).Normalised()
+
+		// re-orthogonalise the frame so a bump map can be layered on top
+		t = t.Sub(n.Multiply(n.Dot(t))).Normalised()
+		b = n.Cross(t).Multiply(handedness)
+	}
+
+	if m.BumpMap != nil && m.BumpScale != 0 {
+		// finite difference of the height field, stepping one texel (or a
+		// small distance, for procedural maps) along the tangent and bitangent
+		du, dv := 1.0/1000, 1.0/1000
+		if img, ok := m.BumpMap.(*ImageTexture); ok {
+			du, dv = img.TexelSize()
+		}
+		h := m.BumpMap.Evaluate(hit).X
+		dhdu := (m.BumpMap.Evaluate(hit.offset(du, 0)).X - h) / du
+		dhdv := (m.BumpMap.Evaluate(hit.offset(0, dv)).X - h) / dv
+
+		n = n.Sub(t.Multiply(dhdu * m.BumpScale)).Sub(b.Multiply(dhdv * m.BumpScale)).Normalised()
+	}
+
+	// never let the perturbed normal flip under the surface
+	if n.Dot(hit.Normal) <= 0 {
+		return hit.Normal
+	}
+	return n
+}
+
+// offset returns hit moved by du along the tangent and dv along the bitangent
+// (in both uv and position), for taking finite differences of textures
+func (h Hit) offset(du, dv float64) Hit {
+	d := h.Tangent.Multiply(du).Add(h.Bitangent.Multiply(dv))
+	h.Point = h.Point.Add(d)
+	h.Local = h.Local.Add(d)
+	h.U += du
+	h.V += dv
+	return h
+}
+
+// frame is a local orthonormal coordinate system, for shapes defined along an axis
+// (local y is the axis)
+type frame struct {
+	origin, x, y, z Vector3f
+}
+
+func newFrame(origin, axis Vector3f) frame {
+	y := axis.Normalised()
+	x, _ := OrthonormalBasis(y)
+	return frame{origin: origin, x: x, y: y, z: x.Cross(y)}
+}
+
+func (f frame) toLocal(p Vector3f) Vector3f {
+	return f.toLocalDir(p.Sub(f.origin))
+}
+
+func (f frame) toLocalDir(v Vector3f) Vector3f {
+	return Vector3f{X: v.Dot(f.x), Y: v.Dot(f.y), Z: v.Dot(f.z)}
+}
+
+func (f frame) toWorld(p Vector3f) Vector3f {
+	return f.origin.Add(f.toWorldDir(p))
+}
+
+func (f frame) toWorldDir(v Vector3f) Vector3f {
+	return f.x.Multiply(v.X).Add(f.y.Multiply(v.Y)).Add(f.z.Multiply(v.Z))
+}
+
+// toWorldHit converts a hit in the frame's local space to world space
+// (Local is left in the frame's space, for object-space textures)
+func (f frame) toWorldHit(h Hit) Hit {
+	h.Local = h.Point
+	h.Point = f.toWorld(h.Point)
+	h.Normal = f.toWorldDir(h.Normal)
+	h.Tangent = f.toWorldDir(h.Tangent)
+	h.Bitangent = f.toWorldDir(h.Bitangent)
+	return h
+}
+
+// TriangleTangentFrame calculates the tangent and bitangent of a triangle
+// from its vertex positions and texture coordinates (u[i], v[i] for vertex i),
+// for use by mesh shapes when building a Hit
+func TriangleTangentFrame(p0, p1, p2 Vector3f, u, v [3]float64) (Vector3f, Vector3f) {
+	e1, e2 := p1.Sub(p0), p2.Sub(p0)
+	du1, dv1 := u[1]-u[0], v[1]-v[0]
+	du2, dv2 := u[2]-u[0], v[2]-v[0]
+
+	n := e1.Cross(e2).Normalised()
+	det := du1*dv2 - du2*dv1
+	if math.Abs(det) < 1e-12 {
+		// degenerate uv mapping, any frame will do
+		return OrthonormalBasis(n)
+	}
+
+	r := 1.0 / det
+	t := e1.Multiply(dv2).Sub(e2.Multiply(dv1)).Multiply(r)
+	t = t.Sub(n.Multiply(n.Dot(t))).Normalised() // gram-schmidt
+	b := n.Cross(t)
+	if e2.Multiply(du1).Sub(e1.Multiply(du2)).Multiply(r).Dot(b) < 0 {
+		// mirrored uvs
+		b = b.Multiply(-1)
+	}
+	return t, b
+}
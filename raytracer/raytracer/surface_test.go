@@ -0,0 +1,127 @@
+package raytracer
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestBumpMapNonSquare(t *testing.T) {
+	// 8x2 texels, dark along the top row and light along the bottom, so the
+	// height ramps from 0 to 1 between the rows' centres (v = 0.25 and 0.75)
+	// and back down again across the wrap
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 2))
+	for x := 0; x < 8; x++ {
+		img.SetNRGBA(x, 0, color.NRGBA{A: 0xff})
+		img.SetNRGBA(x, 1, color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff})
+	}
+	m := &Material{BumpMap: NewImageTexture(img), BumpScale: 0.1}
+	hit := Hit{Normal: Vector3f{Z: 1}, Tangent: Vector3f{X: 1}, Bitangent: Vector3f{Y: 1}, U: 0.5, V: 0.3}
+
+	// stepping a texel down (0.5 in v) from 0.1 lands at 0.9: a slope of 1.6
+	// (stepping an 8th, a texel across, would measure the ramp's 2)
+	want := Vector3f{Y: -0.16, Z: 1}.Normalised()
+	if got := m.ShadingNormal(hit); !nearVec(got, want) {
+		t.Errorf("ShadingNormal = %v, want %v", got, want)
+	}
+}
+
+func TestNormalMap(t *testing.T) {
+	hit := Hit{Normal: Vector3f{Z: 1}, Tangent: Vector3f{X: 1}, Bitangent: Vector3f{Y: 1}}
+	for _, c := range []struct {
+		name   string
+		colour Vector3f
+		want   Vector3f
+	}{
+		{"flat", Vector3f{X: 0.5, Y: 0.5, Z: 1}, Vector3f{Z: 1}},
+		{"towards the tangent", Vector3f{X: 1, Y: 0.5, Z: 1}, Vector3f{X: 1, Z: 1}.Normalised()},
+		{"towards the bitangent", Vector3f{X: 0.5, Y: 0, Z: 1}, Vector3f{Y: -1, Z: 1}.Normalised()},
+		{"under the surface", Vector3f{X: 0.5, Y: 0.5, Z: 0}, Vector3f{Z: 1}},
+	} {
+		m := &Material{NormalMap: constantTexture(c.colour)}
+		if got := m.ShadingNormal(hit); !nearVec(got, c.want) {
+			t.Errorf("%s: ShadingNormal = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestNormalMapKeepsHandedness(t *testing.T) {
+	// a bump map layered over a flat normal map should tilt the normal just
+	// as it does alone, including where the uvs are mirrored (so the
+	// bitangent is -(normal x tangent))
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(y * 0x40), A: 0xff})
+		}
+	}
+	bump := NewImageTexture(img)
+	for _, bitangent := range []Vector3f{{Y: 1}, {Y: -1}} {
+		hit := Hit{Normal: Vector3f{Z: 1}, Tangent: Vector3f{X: 1}, Bitangent: bitangent, U: 0.5, V: 0.4}
+		want := (&Material{BumpMap: bump, BumpScale: 0.2}).ShadingNormal(hit)
+		got := (&Material{BumpMap: bump, BumpScale: 0.2, NormalMap: constantTexture{X: 0.5, Y: 0.5, Z: 1}}).ShadingNormal(hit)
+		if !nearVec(got, want) {
+			t.Errorf("bitangent %v: ShadingNormal = %v, want %v (as without the normal map)", bitangent, got, want)
+		}
+		if near(want.Y, 0) {
+			t.Errorf("bitangent %v: the bump map didn't tilt the normal", bitangent)
+		}
+	}
+}
+
+func TestImageTextureSample(t *testing.T) {
+	// 2x2 texels: black, red / green, white
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	img.SetNRGBA(0, 0, color.NRGBA{A: 0xff})
+	img.SetNRGBA(1, 0, color.NRGBA{R: 0xff, A: 0xff})
+	img.SetNRGBA(0, 1, color.NRGBA{G: 0xff, A: 0xff})
+	img.SetNRGBA(1, 1, color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff})
+	tex := NewImageTexture(img)
+
+	for _, c := range []struct {
+		u, v float64
+		want Vector3f
+	}{
+		{0.25, 0.25, Vector3f{}}, // texel centres
+		{0.75, 0.25, Vector3f{X: 1}},
+		{0.25, 0.75, Vector3f{Y: 1}},
+		{0.5, 0.25, Vector3f{X: 0.5}},                 // between black and red
+		{0.5, 0.5, Vector3f{X: 0.5, Y: 0.5, Z: 0.25}}, // between all four
+		{0, 0.25, Vector3f{X: 0.5}},                   // wrapping around between red and black
+		{1.75, -0.75, Vector3f{X: 1}},                 // outside [0,1]
+	} {
+		if got := tex.Sample(c.u, c.v); !nearVec(got, c.want) {
+			t.Errorf("Sample(%v, %v) = %v, want %v", c.u, c.v, got, c.want)
+		}
+	}
+	if du, dv := tex.TexelSize(); du != 0.5 || dv != 0.5 {
+		t.Errorf("TexelSize = %v, %v, want 0.5, 0.5", du, dv)
+	}
+}
+
+func TestTriangleTangentFrame(t *testing.T) {
+	p0, p1, p2 := Vector3f{}, Vector3f{X: 2}, Vector3f{Y: 2}
+	for _, c := range []struct {
+		name           string
+		u, v           [3]float64
+		wantT, wantB   Vector3f
+		anyOrthonormal bool
+	}{
+		{name: "aligned", u: [3]float64{0, 1, 0}, v: [3]float64{0, 0, 1}, wantT: Vector3f{X: 1}, wantB: Vector3f{Y: 1}},
+		{name: "swapped", u: [3]float64{0, 0, 1}, v: [3]float64{0, 1, 0}, wantT: Vector3f{Y: 1}, wantB: Vector3f{X: 1}},
+		{name: "mirrored", u: [3]float64{1, 0, 1}, v: [3]float64{0, 0, 1}, wantT: Vector3f{X: -1}, wantB: Vector3f{Y: 1}},
+		{name: "degenerate", u: [3]float64{0, 1, 2}, v: [3]float64{0, 1, 2}, anyOrthonormal: true},
+	} {
+		tangent, bitangent := TriangleTangentFrame(p0, p1, p2, c.u, c.v)
+		if c.anyOrthonormal {
+			n := Vector3f{Z: 1}
+			if !near(tangent.Norm(), 1) || !near(bitangent.Norm(), 1) || !near(tangent.Dot(n), 0) || !near(bitangent.Dot(n), 0) || !near(tangent.Dot(bitangent), 0) {
+				t.Errorf("%s: tangent %v, bitangent %v aren't an orthonormal frame on the triangle", c.name, tangent, bitangent)
+			}
+			continue
+		}
+		if !nearVec(tangent, c.wantT) || !nearVec(bitangent, c.wantB) {
+			t.Errorf("%s: tangent %v, bitangent %v, want %v, %v", c.name, tangent, bitangent, c.wantT, c.wantB)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package raytracer
+
+import "image/color"
+
+// xterm's 256 colour palette: the 16 system colours, then a 6x6x6 cube, then
+// 24 greys (the system colours vary from terminal to terminal, so aren't used)
+var xtermLevels = [6]int{0, 95, 135, 175, 215, 255}
+
+// Xterm256 returns the xterm 256 colour palette index nearest to c (ignoring
+// alpha), for terminals without 24 bit colour
+func Xterm256(c color.NRGBA) uint8 {
+	// nearest in the cube, per channel
+	level := func(v uint8) int {
+		switch {
+		case v < 48:
+			return 0
+		case v < 115:
+			return 1
+		default:
+			return (int(v) - 35) / 40
+		}
+	}
+	r, g, b := level(c.R), level(c.G), level(c.B)
+	cube := 16 + 36*r + 6*g + b
+	cubeDist := sqDist(c, xtermLevels[r], xtermLevels[g], xtermLevels[b])
+
+	// nearest grey (8 to 238, in steps of 10), to the mean
+	mean := (int(c.R) + int(c.G) + int(c.B)) / 3
+	k := (mean - 3) / 10
+	if k < 0 {
+		k = 0
+	} else if k > 23 {
+		k = 23
+	}
+	grey := 8 + 10*k
+	if sqDist(c, grey, grey, grey) < cubeDist {
+		return uint8(232 + k)
+	}
+	return uint8(cube)
+}
+
+func sqDist(c color.NRGBA, r, g, b int) int {
+	dr, dg, db := int(c.R)-r, int(c.G)-g, int(c.B)-b
+	return dr*dr + dg*dg + db*db
+}
@@ -0,0 +1,50 @@
+package raytracer
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestXterm256(t *testing.T) {
+	tests := []struct {
+		c    color.NRGBA
+		want uint8
+	}{
+		{color.NRGBA{0, 0, 0, 0xff}, 16},
+		{color.NRGBA{0xff, 0xff, 0xff, 0xff}, 231},
+		{color.NRGBA{0xff, 0, 0, 0xff}, 196},
+		{color.NRGBA{0, 0xff, 0, 0xff}, 46},
+		{color.NRGBA{0, 0, 0xff, 0xff}, 21},
+		{color.NRGBA{95, 135, 175, 0xff}, 16 + 36*1 + 6*2 + 3},
+		{color.NRGBA{128, 128, 128, 0xff}, 244}, // (a grey, rather than the cube's 102)
+		{color.NRGBA{238, 238, 238, 0xff}, 255},
+	}
+	for _, tt := range tests {
+		if got := Xterm256(tt.c); got != tt.want {
+			t.Errorf("Xterm256(%v) = %v, want %v", tt.c, got, tt.want)
+		}
+	}
+
+	// every colour maps to something no further than the cube's worst case
+	for r := 0; r < 256; r += 5 {
+		for g := 0; g < 256; g += 5 {
+			for b := 0; b < 256; b += 5 {
+				c := color.NRGBA{uint8(r), uint8(g), uint8(b), 0xff}
+				pr, pg, pb := xtermRGB(Xterm256(c))
+				if d := sqDist(c, pr, pg, pb); d > 3*48*48 {
+					t.Fatalf("Xterm256(%v) is %v away", c, d)
+				}
+			}
+		}
+	}
+}
+
+// xtermRGB returns the colour of a palette index (from the cube or greys)
+func xtermRGB(i uint8) (int, int, int) {
+	if i >= 232 {
+		v := 8 + 10*int(i-232)
+		return v, v, v
+	}
+	i -= 16
+	return xtermLevels[i/36], xtermLevels[i/6%6], xtermLevels[i%6]
+}
@@ -0,0 +1,69 @@
+package raytracer
+
+import (
+	"image"
+	"math"
+)
+
+// Texture is a colour (or scalar, read from X) that varies over a surface
+type Texture interface {
+	// Evaluate returns the value at hit, with each channel nominally in [0,1]
+	Evaluate(hit Hit) Vector3f
+}
+
+// ImageTexture is an image sampled with wrapping, bilinearly filtered uv lookups
+type ImageTexture struct {
+	Image *image.NRGBA
+}
+
+func NewImageTexture(img *image.NRGBA) *ImageTexture {
+	return &ImageTexture{Image: img}
+}
+
+// TexelSize returns the size of one pixel in uv space
+func (t *ImageTexture) TexelSize() (float64, float64) {
+	b := t.Image.Bounds()
+	return 1.0 / float64(b.Dx()), 1.0 / float64(b.Dy())
+}
+
+func (t *ImageTexture) Evaluate(hit Hit) Vector3f {
+	return t.Sample(hit.U, hit.V)
+}
+
+// Sample returns the colour at (u, v) with each channel in [0,1]
+// (u and v wrap around outside [0,1])
+func (t *ImageTexture) Sample(u, v float64) Vector3f {
+	b := t.Image.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	// texel centres are at half-integer coordinates
+	x := (u-math.Floor(u))*float64(w) - 0.5
+	y := (v-math.Floor(v))*float64(h) - 0.5
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+
+	c00 := t.texel(int(x0), int(y0))
+	c10 := t.texel(int(x0)+1, int(y0))
+	c01 := t.texel(int(x0), int(y0)+1)
+	c11 := t.texel(int(x0)+1, int(y0)+1)
+
+	top := c00.Multiply(1 - fx).Add(c10.Multiply(fx))
+	bottom := c01.Multiply(1 - fx).Add(c11.Multiply(fx))
+	return top.Multiply(1 - fy).Add(bottom.Multiply(fy))
+}
+
+// texel returns the pixel at (x, y), wrapping at the image edges
+func (t *ImageTexture) texel(x, y int) Vector3f {
+	b := t.Image.Bounds()
+	w, h := b.Dx(), b.Dy()
+	x = ((x % w) + w) % w
+	y = ((y % h) + h) % h
+
+	i := t.Image.PixOffset(b.Min.X+x, b.Min.Y+y)
+	p := t.Image.Pix[i : i+3 : i+3]
+	return Vector3f{
+		X: float64(p[0]) / 0xff,
+		Y: float64(p[1]) / 0xff,
+		Z: float64(p[2]) / 0xff,
+	}
+}
@@ -0,0 +1,286 @@
+package raytracer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Interpolation is how a track moves from one key to the next
+type Interpolation int
+
+const (
+	LinearInterpolation Interpolation = iota
+	BezierInterpolation               // cubic, through the keys' handles
+	StepInterpolation                 // hold the key's value until the next key
+)
+
+// Key is a track's value at a frame
+type Key struct {
+	Frame         float64
+	Value         Vector3f // scalar targets use X
+	Interpolation Interpolation
+
+	// bezier handles, as offsets from Value, shaping the curve into (In) and
+	// out of (Out) the key (zero for easing in and out)
+	In, Out Vector3f
+}
+
+// Track animates one target through its keys (sorted by frame), holding
+// still before the first and after the last
+type Track struct {
+	// what the track animates:
+	//  camera.position, camera.pitch, camera.yaw, camera.fov, camera.aperture, camera.focus
+	//  lights[i].position, lights[i].intensity
+	//  spheres[i].centre, spheres[i].radius, spheres[i].material.<field>
+	//  planes[i].point, planes[i].normal, planes[i].material.<field>
+	//  shapes[i].<field> for spheres, instances (translation, rotation, scale,
+	//  material.<field>) and moving shapes (which also take their velocity from the track)
+	// where material fields are diffuse (rgb, 0 to 1), specular_exponent,
+	// albedo[0..3], refractive_index, absorption and bump_scale
+	Target string
+	Keys   []Key
+}
+
+// At returns the track's value at frame
+func (t *Track) At(frame float64) Vector3f {
+	if len(t.Keys) == 0 {
+		return Vector3f{}
+	}
+	if frame <= t.Keys[0].Frame {
+		return t.Keys[0].Value
+	}
+	for i := 1; i < len(t.Keys); i++ {
+		if frame < t.Keys[i].Frame {
+			a, b := t.Keys[i-1], t.Keys[i]
+			f := (frame - a.Frame) / (b.Frame - a.Frame)
+			switch a.Interpolation {
+			case StepInterpolation:
+				return a.Value
+			case BezierInterpolation:
+				return bezier(f, a.Value, a.Value.Add(a.Out), b.Value.Add(b.In), b.Value)
+			default:
+				return a.Value.Lerp(b.Value, f)
+			}
+		}
+	}
+	return t.Keys[len(t.Keys)-1].Value
+}
+
+// bezier evaluates the cubic bezier curve with control points p0..p3 at t
+func bezier(t float64, p0, p1, p2, p3 Vector3f) Vector3f {
+	s := 1 - t
+	return p0.Multiply(s * s * s).
+		Add(p1.Multiply(3 * s * s * t)).
+		Add(p2.Multiply(3 * s * t * t)).
+		Add(p3.Multiply(t * t * t))
+}
+
+// Timeline is a set of tracks animating a scene and its camera
+type Timeline struct {
+	Tracks []*Track
+}
+
+// End returns the frame of the last key on any track
+func (tl *Timeline) End() float64 {
+	end := 0.0
+	for _, track := range tl.Tracks {
+		if n := len(track.Keys); n > 0 && track.Keys[n-1].Frame > end {
+			end = track.Keys[n-1].Frame
+		}
+	}
+	return end
+}
+
+// Apply sets every track's target to its value at frame
+// (before rendering, as the scene's acceleration structure is built on first use)
+func (tl *Timeline) Apply(scene *Scene, camera *Camera, frame float64) error {
+	// instances are placed once all of their tracks are known
+	placements := make(map[*Instance]*Keyframe)
+
+	for _, track := range tl.Tracks {
+		if err := applyTrack(scene, camera, track, frame, placements); err != nil {
+			return fmt.Errorf("track %q: %w", track.Target, err)
+		}
+	}
+	for instance, k := range placements {
+		instance.Transform = k.Transform()
+	}
+	return nil
+}
+
+func applyTrack(scene *Scene, camera *Camera, track *Track, frame float64, placements map[*Instance]*Keyframe) error {
+	v := track.At(frame)
+	name, index, field, err := parseTarget(track.Target)
+	if err != nil {
+		return err
+	}
+
+	switch name {
+	case "camera":
+		if camera == nil {
+			return fmt.Errorf("no camera")
+		}
+		switch field {
+		case "position":
+			camera.Position = v
+		case "pitch":
+			camera.Pitch = v.X
+		case "yaw":
+			camera.Yaw = v.X
+		case "fov":
+			camera.FOV = v.X
+		case "aperture":
+			camera.ApertureRadius = v.X
+		case "focus":
+			camera.FocalDistance = v.X
+		default:
+			return fmt.Errorf("unknown camera field %q", field)
+		}
+
+	case "lights":
+		if index >= len(scene.Lights) {
+			return fmt.Errorf("no light %d", index)
+		}
+		light := scene.Lights[index]
+		switch field {
+		case "position":
+			light.Position = v
+		case "intensity":
+			light.Intensity = v.X
+		default:
+			return fmt.Errorf("unknown light field %q", field)
+		}
+
+	case "spheres":
+		if index >= len(scene.Spheres) {
+			return fmt.Errorf("no sphere %d", index)
+		}
+		return applySphere(scene.Spheres[index], field, v)
+
+	case "planes":
+		if index >= len(scene.Planes) {
+			return fmt.Errorf("no plane %d", index)
+		}
+		plane := scene.Planes[index]
+		switch {
+		case field == "point":
+			plane.Point = v
+		case field == "normal":
+			plane.Normal = v.Normalised()
+		case strings.HasPrefix(field, "material."):
+			return applyMaterial(&plane.Material, strings.TrimPrefix(field, "material."), v)
+		default:
+			return fmt.Errorf("unknown plane field %q", field)
+		}
+
+	case "shapes":
+		if index >= len(scene.Shapes) {
+			return fmt.Errorf("no shape %d", index)
+		}
+		return applyShape(scene.Shapes[index], field, track, frame, placements)
+
+	default:
+		return fmt.Errorf("unknown target %q", name)
+	}
+	return nil
+}
+
+func applyShape(shape Shape, field string, track *Track, frame float64, placements map[*Instance]*Keyframe) error {
+	v := track.At(frame)
+
+	switch s := shape.(type) {
+	case *Sphere:
+		return applySphere(s, field, v)
+
+	case *Instance:
+		k, ok := placements[s]
+		if !ok {
+			// starting from where the instance is, so the parts of its
+			// placement that aren't animated are kept
+			placement := keyframeOf(s.Transform)
+			k = &placement
+			placements[s] = k
+		}
+		switch {
+		case field == "translation":
+			k.Translation = v
+		case field == "rotation":
+			k.Rotation = v
+		case field == "scale":
+			k.Scale = v
+		case strings.HasPrefix(field, "material.") && s.Material != nil:
+			// copied, as the material may be shared with other objects
+			m := *s.Material
+			s.Material = &m
+			return applyMaterial(s.Material, strings.TrimPrefix(field, "material."), v)
+		default:
+			return fmt.Errorf("unknown instance field %q", field)
+		}
+
+	case *Moving:
+		// moving shapes carry on at the track's speed over the shutter interval
+		if field == "centre" || field == "translation" {
+			s.Motion = LinearMotion{Velocity: track.At(frame + 1).Sub(v)}
+		}
+		return applyShape(s.Shape, field, track, frame, placements)
+
+	default:
+		return fmt.Errorf("can't animate a %T", shape)
+	}
+	return nil
+}
+
+func applySphere(sphere *Sphere, field string, v Vector3f) error {
+	switch {
+	case field == "centre":
+		sphere.Centre = v
+	case field == "radius":
+		sphere.Radius = v.X
+	case strings.HasPrefix(field, "material."):
+		return applyMaterial(&sphere.Material, strings.TrimPrefix(field, "material."), v)
+	default:
+		return fmt.Errorf("unknown sphere field %q", field)
+	}
+	return nil
+}
+
+func applyMaterial(m *Material, field string, v Vector3f) error {
+	switch field {
+	case "diffuse":
+		m.DiffuseColour = FloatToRGB(v.X, v.Y, v.Z)
+	case "specular_exponent":
+		m.SpecularExponent = v.X
+	case "albedo[0]", "albedo[1]", "albedo[2]", "albedo[3]":
+		m.Albedo[field[len("albedo[")]-'0'] = v.X
+	case "refractive_index":
+		m.RefractiveIndex = v.X
+	case "absorption":
+		m.Absorption = v
+	case "bump_scale":
+		m.BumpScale = v.X
+	default:
+		return fmt.Errorf("unknown material field %q", field)
+	}
+	return nil
+}
+
+// parseTarget splits a track target such as "spheres[2].material.diffuse"
+// into its object ("spheres"), index (2, or 0 without one) and field ("material.diffuse")
+func parseTarget(target string) (name string, index int, field string, err error) {
+	name, field, ok := strings.Cut(target, ".")
+	if !ok || field == "" {
+		return "", 0, "", fmt.Errorf("no field in target")
+	}
+	if open := strings.IndexByte(name, '['); open >= 0 {
+		if !strings.HasSuffix(name, "]") {
+			return "", 0, "", fmt.Errorf("unclosed index in target")
+		}
+		index, err = strconv.Atoi(name[open+1 : len(name)-1])
+		if err != nil || index < 0 {
+			return "", 0, "", fmt.Errorf("bad index in target")
+		}
+		name = name[:open]
+	}
+	return name, index, field, nil
+}
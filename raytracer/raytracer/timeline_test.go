@@ -0,0 +1,137 @@
+package raytracer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTrackInterpolation(t *testing.T) {
+	a, b := Vector3f{X: 0, Y: 2}, Vector3f{X: 10, Y: 4}
+	tests := []struct {
+		name          string
+		interpolation Interpolation
+		out, in       Vector3f
+		frame         float64
+		want          Vector3f
+	}{
+		{"before first key", LinearInterpolation, Vector3f{}, Vector3f{}, -5, a},
+		{"after last key", LinearInterpolation, Vector3f{}, Vector3f{}, 20, b},
+		{"linear", LinearInterpolation, Vector3f{}, Vector3f{}, 2.5, Vector3f{X: 2.5, Y: 2.5}},
+		{"step", StepInterpolation, Vector3f{}, Vector3f{}, 9.9, a},
+		{"bezier midpoint", BezierInterpolation, Vector3f{}, Vector3f{}, 5, Vector3f{X: 5, Y: 3}},
+		// without handles, bezier eases in: slower than linear near the start
+		{"bezier ease", BezierInterpolation, Vector3f{}, Vector3f{}, 1, Vector3f{X: 0.28, Y: 2.056}},
+		// handles pointing along the line make it linear
+		{"bezier handles", BezierInterpolation, Vector3f{X: 10.0 / 3, Y: 2.0 / 3}, Vector3f{X: -10.0 / 3, Y: -2.0 / 3}, 1, Vector3f{X: 1, Y: 2.2}},
+	}
+
+	for _, tt := range tests {
+		track := &Track{Keys: []Key{
+			{Frame: 0, Value: a, Interpolation: tt.interpolation, Out: tt.out},
+			{Frame: 10, Value: b, In: tt.in},
+		}}
+		if got := track.At(tt.frame); !nearVec(got, tt.want) {
+			t.Errorf("%s: At(%v) = %v, want %v", tt.name, tt.frame, got, tt.want)
+		}
+	}
+}
+
+func TestTimelineApply(t *testing.T) {
+	sphere := &Sphere{Radius: 1, Material: Ivory}
+	instance := &Instance{Shape: &Sphere{Radius: 1}, Transform: IdentityTransform(), Material: &Ivory}
+	moving := &Moving{Shape: &Sphere{Radius: 1}, Motion: LinearMotion{}}
+	placed := Keyframe{Scale: Vector3f{X: 2, Y: 1, Z: 0.5}, Rotation: Vector3f{Y: 0.5}}
+	stretched := &Instance{Shape: &Sphere{Radius: 1}, Transform: placed.Transform()}
+	scene := &Scene{
+		Lights:  []*Light{{Intensity: 1}},
+		Spheres: []*Sphere{sphere},
+		Shapes:  []Shape{instance, moving, stretched},
+	}
+	camera := &Camera{}
+
+	constant := func(target string, v Vector3f) *Track {
+		return &Track{Target: target, Keys: []Key{{Frame: 0, Value: v}}}
+	}
+	timeline := &Timeline{Tracks: []*Track{
+		constant("camera.position", Vector3f{X: 1, Y: 2, Z: 3}),
+		constant("camera.fov", Vector3f{X: 1}),
+		constant("lights[0].intensity", Vector3f{X: 2}),
+		constant("spheres[0].radius", Vector3f{X: 3}),
+		constant("spheres[0].material.albedo[2]", Vector3f{X: 0.5}),
+		constant("spheres[0].material.diffuse", Vector3f{X: 1}),
+		constant("shapes[0].translation", Vector3f{X: 4}),
+		constant("shapes[0].material.refractive_index", Vector3f{X: 1.5}),
+		{Target: "shapes[1].centre", Keys: []Key{{Frame: 0}, {Frame: 10, Value: Vector3f{Z: 10}}}},
+		constant("shapes[2].translation", Vector3f{Y: 3}),
+	}}
+
+	if err := timeline.Apply(scene, camera, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	if camera.Position != (Vector3f{X: 1, Y: 2, Z: 3}) || camera.FOV != 1 {
+		t.Errorf("camera = %+v", camera)
+	}
+	if scene.Lights[0].Intensity != 2 {
+		t.Errorf("light intensity = %v, want 2", scene.Lights[0].Intensity)
+	}
+	if sphere.Radius != 3 || sphere.Material.Albedo[2] != 0.5 || sphere.Material.DiffuseColour.R != 0xff {
+		t.Errorf("sphere = %+v", sphere)
+	}
+	if got := instance.Transform.Point(Vector3f{}); !nearVec(got, Vector3f{X: 4}) {
+		t.Errorf("instance origin = %v, want (4, 0, 0)", got)
+	}
+	// only the translation is animated, so the scale and rotation stay
+	placed.Translation = Vector3f{Y: 3}
+	for _, p := range []Vector3f{{}, {X: 1}, {Y: 1}, {Z: 1}} {
+		if got, want := stretched.Transform.Point(p), placed.Transform().Point(p); !nearVec(got, want) {
+			t.Errorf("stretched instance moves %v to %v, want %v", p, got, want)
+		}
+	}
+	if instance.Material.RefractiveIndex != 1.5 || Ivory.RefractiveIndex == 1.5 {
+		t.Errorf("instance material wasn't copied before changing")
+	}
+	if got := moving.Shape.(*Sphere).Centre; !nearVec(got, Vector3f{Z: 5}) {
+		t.Errorf("moving centre = %v, want (0, 0, 5)", got)
+	}
+	if got := moving.Motion.(LinearMotion).Velocity; !nearVec(got, Vector3f{Z: 1}) {
+		t.Errorf("moving velocity = %v, want (0, 0, 1)", got)
+	}
+	if end := timeline.End(); end != 10 {
+		t.Errorf("End() = %v, want 10", end)
+	}
+}
+
+func TestTimelineApplyErrors(t *testing.T) {
+	scene := &Scene{Spheres: []*Sphere{{Radius: 1}}, Shapes: []Shape{&Box{}}}
+	for _, target := range []string{
+		"camera",
+		"camera.zoom",
+		"spheres[1].radius",
+		"spheres[-1].radius",
+		"spheres[0.radius",
+		"spheres[0].material.shininess",
+		"shapes[0].translation",
+		"teapots[0].radius",
+	} {
+		timeline := &Timeline{Tracks: []*Track{{Target: target, Keys: []Key{{}}}}}
+		if err := timeline.Apply(scene, &Camera{}, 0); err == nil {
+			t.Errorf("Apply(%q) succeeded, want an error", target)
+		}
+	}
+}
+
+func TestDemoTimeline(t *testing.T) {
+	// the demo loops, and matches the viewer's old sin(i) path
+	timeline := DemoTimeline()
+	track := timeline.Tracks[0]
+	if !nearVec(track.At(0), track.At(timeline.End())) {
+		t.Errorf("demo timeline doesn't loop")
+	}
+	for _, frame := range []float64{0, 25, 120, 250} {
+		want := demoGlassCentre(8*math.Sin(frame*0.02) + 5)
+		if got := track.At(frame); got.Sub(want).Norm() > 0.5 {
+			t.Errorf("frame %v: centre %v, want near %v", frame, got, want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package raytracer
+
+import "math"
+
+// Torus is a ring around Centre, in the plane perpendicular to Axis
+type Torus struct {
+	Centre      Vector3f
+	Axis        Vector3f
+	MajorRadius float64 // distance from the centre to the middle of the tube
+	MinorRadius float64 // radius of the tube
+	Material    Material
+}
+
+func (tr *Torus) Intersect(ray Ray, tMax float64) (float64, Hit, bool) {
+	origin, direction := ray.Origin, ray.Direction
+	f := newFrame(tr.Centre, tr.Axis)
+	o, d := f.toLocal(origin), f.toLocalDir(direction)
+	R, r := tr.MajorRadius, tr.MinorRadius
+
+	// skip to the bounding sphere first, the quartic loses precision far from the torus
+	start := 0.0
+	bound := R + r
+	b := o.Dot(d)
+	c := o.Dot(o) - bound*bound
+	if c > 0 {
+		if b > 0 || b*b < c {
+			return 0, Hit{}, false // outside the bounding sphere, and never entering
+		}
+		start = -b - math.Sqrt(b*b-c)
+		o = o.Add(d.Multiply(start))
+	}
+
+	// substitute the ray into (x^2 + y^2 + z^2 + R^2 - r^2)^2 = 4R^2(x^2 + z^2)
+	// (d is unit length, so the t^4 coefficient is 1)
+	m := o.Dot(o)
+	n := o.Dot(d)
+	k := m + R*R - r*r
+	R2 := 4 * R * R
+	roots, count := solveQuartic(
+		1,
+		4*n,
+		2*k+4*n*n-R2*(d.X*d.X+d.Z*d.Z),
+		4*n*k-2*R2*(o.X*d.X+o.Z*d.Z),
+		k*k-R2*(o.X*o.X+o.Z*o.Z),
+	)
+
+	best := math.Inf(1)
+	for i := 0; i < count; i++ {
+		t := roots[i] + start
+		if t > 1e-6 && t < best && t < tMax {
+			best = t
+		}
+	}
+	if math.IsInf(best, 1) {
+		return 0, Hit{}, false
+	}
+
+	p := o.Add(d.Multiply(best - start))
+
+	// the normal points away from the nearest point on the tube's centre circle
+	rho := math.Sqrt(p.X*p.X + p.Z*p.Z)
+	radial := Vector3f{X: 1}
+	if rho > 1e-12 {
+		radial = Vector3f{X: p.X / rho, Z: p.Z / rho}
+	}
+	normal := p.Sub(radial.Multiply(R)).Normalised()
+	tangent := Vector3f{X: -radial.Z, Z: radial.X}
+	psi := math.Atan2(p.Y, rho-R)
+
+	hit := Hit{
+		Point:     p,
+		Normal:    normal,
+		Tangent:   tangent,
+		Bitangent: radial.Multiply(-math.Sin(psi)).Add(Vector3f{Y: math.Cos(psi)}),
+		U:         0.5 + math.Atan2(p.Z, p.X)/(2*math.Pi),
+		V:         0.5 + psi/(2*math.Pi),
+	}
+	hit = f.toWorldHit(hit)
+	hit.Material = &tr.Material
+	return best, hit, true
+}
+
+func (tr *Torus) Bounds() AABB {
+	// the centre circle's disc, grown by the tube radius in every direction
+	r := Vector3f{X: tr.MinorRadius, Y: tr.MinorRadius, Z: tr.MinorRadius}
+	b := discBounds(tr.Centre, tr.Axis, tr.MajorRadius)
+	return AABB{Min: b.Min.Sub(r), Max: b.Max.Add(r)}
+}
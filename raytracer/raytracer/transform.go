@@ -0,0 +1,184 @@
+package raytracer
+
+import "math"
+
+// Transform is an affine transformation, kept alongside its inverse
+type Transform struct {
+	Matrix  Matrix4x4
+	Inverse Matrix4x4
+}
+
+// NewTransform creates a transform from a matrix, which must be invertible
+func NewTransform(m Matrix4x4) Transform {
+	inv, ok := m.Inverse()
+	if !ok {
+		panic("transform matrix is not invertible")
+	}
+	return Transform{Matrix: m, Inverse: inv}
+}
+
+func IdentityTransform() Transform {
+	return Transform{Matrix: IdentityMatrix(), Inverse: IdentityMatrix()}
+}
+
+func Translate(v Vector3f) Transform {
+	m := IdentityMatrix()
+	m[0][3], m[1][3], m[2][3] = v.X, v.Y, v.Z
+	inv := IdentityMatrix()
+	inv[0][3], inv[1][3], inv[2][3] = -v.X, -v.Y, -v.Z
+	return Transform{Matrix: m, Inverse: inv}
+}
+
+// Scale scales along each axis, non-uniform scales are allowed (but not zero)
+func Scale(v Vector3f) Transform {
+	m := IdentityMatrix()
+	m[0][0], m[1][1], m[2][2] = v.X, v.Y, v.Z
+	inv := IdentityMatrix()
+	inv[0][0], inv[1][1], inv[2][2] = 1/v.X, 1/v.Y, 1/v.Z
+	return Transform{Matrix: m, Inverse: inv}
+}
+
+// RotateX rotates by theta radians around the x-axis
+func RotateX(theta float64) Transform {
+	c, s := math.Cos(theta), math.Sin(theta)
+	m := Matrix4x4{
+		{1, 0, 0, 0},
+		{0, c, -s, 0},
+		{0, s, c, 0},
+		{0, 0, 0, 1},
+	}
+	// rotations are orthogonal, so the inverse is the transpose
+	return Transform{Matrix: m, Inverse: m.Transpose()}
+}
+
+// RotateY rotates by theta radians around the y-axis
+func RotateY(theta float64) Transform {
+	c, s := math.Cos(theta), math.Sin(theta)
+	m := Matrix4x4{
+		{c, 0, s, 0},
+		{0, 1, 0, 0},
+		{-s, 0, c, 0},
+		{0, 0, 0, 1},
+	}
+	return Transform{Matrix: m, Inverse: m.Transpose()}
+}
+
+// RotateZ rotates by theta radians around the z-axis
+func RotateZ(theta float64) Transform {
+	c, s := math.Cos(theta), math.Sin(theta)
+	m := Matrix4x4{
+		{c, -s, 0, 0},
+		{s, c, 0, 0},
+		{0, 0, 1, 0},
+		{0, 0, 0, 1},
+	}
+	return Transform{Matrix: m, Inverse: m.Transpose()}
+}
+
+// Rotate rotates by a quaternion (normalised)
+func Rotate(q Quaternion) Transform {
+	m := q.Matrix()
+	return Transform{Matrix: m, Inverse: m.Transpose()}
+}
+
+// Then returns the transform that applies t, followed by u
+// e.g. Scale(s).Then(RotateY(a)).Then(Translate(p))
+func (t Transform) Then(u Transform) Transform {
+	return Transform{
+		Matrix:  u.Matrix.Multiply(t.Matrix),
+		Inverse: t.Inverse.Multiply(u.Inverse),
+	}
+}
+
+func (t Transform) Point(p Vector3f) Vector3f {
+	return t.Matrix.MultiplyPoint(p)
+}
+
+func (t Transform) Direction(v Vector3f) Vector3f {
+	return t.Matrix.MultiplyDirection(v)
+}
+
+// Normal transforms a surface normal, using the normal matrix (the inverse
+// transpose) so normals stay perpendicular under non-uniform scaling
+// the result is not normalised
+func (t Transform) Normal(n Vector3f) Vector3f {
+	return t.Inverse.Transpose().MultiplyDirection(n)
+}
+
+func (t Transform) InversePoint(p Vector3f) Vector3f {
+	return t.Inverse.MultiplyPoint(p)
+}
+
+func (t Transform) InverseDirection(v Vector3f) Vector3f {
+	return t.Inverse.MultiplyDirection(v)
+}
+
+// Bounds returns an axis-aligned box containing the transformed box b
+func (t Transform) Bounds(b AABB) AABB {
+	if b.IsInfinite() {
+		return b
+	}
+	res := EmptyAABB()
+	for i := 0; i < 8; i++ {
+		corner := b.Min
+		if i&1 != 0 {
+			corner.X = b.Max.X
+		}
+		if i&2 != 0 {
+			corner.Y = b.Max.Y
+		}
+		if i&4 != 0 {
+			corner.Z = b.Max.Z
+		}
+		res = res.Extend(t.Point(corner))
+	}
+	return res
+}
+
+// Instance places a shared shape in the scene with its own transform (and
+// optionally its own material), so e.g. a single mesh can be drawn many
+// times without copying it, or a sphere can be stretched into an ellipsoid
+type Instance struct {
+	Shape     Shape
+	Transform Transform
+	Material  *Material // overrides the shape's material if set
+}
+
+func (inst *Instance) Intersect(ray Ray, tMax float64) (float64, Hit, bool) {
+	t, hit, ok := intersectTransformed(inst.Shape, inst.Transform, ray, tMax)
+	if ok && inst.Material != nil {
+		hit.Material = inst.Material
+	}
+	return t, hit, ok
+}
+
+// intersectTransformed intersects the ray with shape, placed in the world by transform
+func intersectTransformed(shape Shape, transform Transform, ray Ray, tMax float64) (float64, Hit, bool) {
+	// trace the ray in object space, shapes expect a unit direction, so
+	// rescale distances to match (t is the same in both spaces before normalising)
+	d := transform.InverseDirection(ray.Direction)
+	scale := d.Norm()
+	local := Ray{
+		Origin:    transform.InversePoint(ray.Origin),
+		Direction: d.Multiply(1 / scale),
+		Time:      ray.Time,
+		stats:     ray.stats,
+	}
+
+	t, hit, ok := shape.Intersect(local, tMax*scale)
+	if !ok {
+		return 0, Hit{}, false
+	}
+	t /= scale
+
+	// back to world space (Local stays in object space, so textures follow the shape)
+	hit.Point = ray.At(t)
+	hit.Normal = transform.Normal(hit.Normal).Normalised()
+	hit.Tangent = transform.Direction(hit.Tangent).Normalised()
+	hit.Bitangent = transform.Direction(hit.Bitangent).Normalised()
+	return t, hit, true
+}
+
+func (inst *Instance) Bounds() AABB {
+	return inst.Transform.Bounds(inst.Shape.Bounds())
+}
@@ -69,6 +69,99 @@ func (a Vector3f) Norm() float64 {
 	return a.Length()
 }
 
+// Negate returns the vector pointing the opposite way
+func (a Vector3f) Negate() Vector3f {
+	return Vector3f{-a.X, -a.Y, -a.Z}
+}
+
+// MultiplyComponents returns the component-wise product (e.g. to tint a colour)
+func (a Vector3f) MultiplyComponents(b Vector3f) Vector3f {
+	return Vector3f{
+		a.X * b.X,
+		a.Y * b.Y,
+		a.Z * b.Z,
+	}
+}
+
+// DivideComponents returns the component-wise quotient
+func (a Vector3f) DivideComponents(b Vector3f) Vector3f {
+	return Vector3f{
+		a.X / b.X,
+		a.Y / b.Y,
+		a.Z / b.Z,
+	}
+}
+
+// Min returns the smaller of each component
+func (a Vector3f) Min(b Vector3f) Vector3f {
+	return Vector3f{
+		math.Min(a.X, b.X),
+		math.Min(a.Y, b.Y),
+		math.Min(a.Z, b.Z),
+	}
+}
+
+// Max returns the larger of each component
+func (a Vector3f) Max(b Vector3f) Vector3f {
+	return Vector3f{
+		math.Max(a.X, b.X),
+		math.Max(a.Y, b.Y),
+		math.Max(a.Z, b.Z),
+	}
+}
+
+// Lerp interpolates linearly from a (t = 0) to b (t = 1)
+func (a Vector3f) Lerp(b Vector3f, t float64) Vector3f {
+	return a.Add(b.Sub(a).Multiply(t))
+}
+
+// nearZero is how close to zero a component must be for NearZero
+const nearZero = 1e-8
+
+// NearZero reports whether every component is within 1e-8 of zero (e.g. a
+// direction too short to normalise)
+func (a Vector3f) NearZero() bool {
+	return math.Abs(a.X) < nearZero && math.Abs(a.Y) < nearZero && math.Abs(a.Z) < nearZero
+}
+
+// Reflect returns the direction a bounces off a surface with normal n
+// (normalised)
+func (a Vector3f) Reflect(n Vector3f) Vector3f {
+	return a.Sub(n.Multiply(2 * a.Dot(n)))
+}
+
+// Refract returns the direction a (normalised) bends to on passing through
+// a surface with normal n (normalised, facing against a) by snell's law,
+// where eta is the ratio of refractive indices (from, over into); or false for
+// total internal reflection
+func (a Vector3f) Refract(n Vector3f, eta float64) (Vector3f, bool) {
+	cosi := -math.Max(-1, math.Min(1, a.Dot(n)))
+	k := 1 - eta*eta*(1-cosi*cosi)
+	if k < 0 {
+		return Vector3f{}, false
+	}
+	return a.Multiply(eta).Add(n.Multiply(eta*cosi - math.Sqrt(k))), true
+}
+
+// Extend returns the vector with a fourth component, w (1 for a point, 0 for
+// a direction)
+func (a Vector3f) Extend(w float64) Vector4f {
+	return Vector4f{a.X, a.Y, a.Z, w}
+}
+
+// OrthonormalBasis returns two unit vectors perpendicular to n (normalised)
+// and each other, forming a right-handed basis (t, b, n)
+func OrthonormalBasis(n Vector3f) (Vector3f, Vector3f) {
+	// pick the world axis least aligned with n to avoid a degenerate cross product
+	a := Vector3f{X: 1}
+	if math.Abs(n.X) > 0.9 {
+		a = Vector3f{Y: 1}
+	}
+	t := a.Cross(n).Normalised()
+	b := n.Cross(t)
+	return t, b
+}
+
 // Vector4f
 type Vector4f struct {
 	X, Y, Z, W float64
@@ -124,8 +217,10 @@ func (a Vector4f) Length() float64 {
 	return math.Sqrt(a.Dot(a))
 }
 
+// Cross returns the cross product of the vectors' first three components, as
+// a direction (w = 0) (there's no cross product of two 4D vectors)
 func (a Vector4f) Cross(b Vector4f) Vector4f {
-	panic("cross product is not defined for 4-vectors")
+	return a.XYZ().Cross(b.XYZ()).Extend(0)
 }
 
 func (a Vector4f) Normalised() Vector4f {
@@ -137,47 +232,170 @@ func (a Vector4f) Norm() float64 {
 	return a.Length()
 }
 
-// Multiply4 multiplies a 3D vector by a 4D vector, returning a new 3D vector
-// The fourth component of the result may need to be divided by the
-// result's W component to get the correct 3-vector result.
-func (a Vector3f) Multiply4(b Vector4f) Vector3f {
-	// Construct a 4-vector with W=0 to represent a 3D vector.
-	a4 := Vector4f{X: a.X, Y: a.Y, Z: a.Z, W: 0}
-
-	// Multiply the 4-vectors element-wise.
-	result := Vector4f{
-		X: a4.X * b.X,
-		Y: a4.Y * b.Y,
-		Z: a4.Z * b.Z,
-		W: a4.W * b.W,
+// MultiplyComponents returns the component-wise product
+func (a Vector4f) MultiplyComponents(b Vector4f) Vector4f {
+	return Vector4f{
+		a.X * b.X,
+		a.Y * b.Y,
+		a.Z * b.Z,
+		a.W * b.W,
 	}
+}
 
-	// Divide the first three components by the fourth component,
-	// if the fourth component is not zero.
-	if result.W != 0 {
-		result.X /= result.W
-		result.Y /= result.W
-		result.Z /= result.W
+// Lerp interpolates linearly from a (t = 0) to b (t = 1)
+func (a Vector4f) Lerp(b Vector4f, t float64) Vector4f {
+	return a.Add(b.Sub(a).Multiply(t))
+}
+
+// XYZ returns the first three components
+func (a Vector4f) XYZ() Vector3f {
+	return Vector3f{a.X, a.Y, a.Z}
+}
+
+// Homogenised returns the 3D point a homogeneous vector represents (divided
+// by w), or just its first three components if w is 0 (a direction)
+func (a Vector4f) Homogenised() Vector3f {
+	if a.W == 0 {
+		return a.XYZ()
 	}
+	return a.XYZ().Multiply(1 / a.W)
+}
 
-	// Return the result as a 3D vector.
-	return Vector3f{X: result.X, Y: result.Y, Z: result.Z}
+// Multiply4 returns the component-wise product of a and b's first three
+// components (b's w would only ever multiply a's 0)
+//
+// Deprecated: use MultiplyComponents
+func (a Vector3f) Multiply4(b Vector4f) Vector3f {
+	return a.MultiplyComponents(b.XYZ())
 }
 
-// Matrix4x4 is a 4x4 matrix
+// Matrix4x4 is a 4x4 matrix, indexed by row then column
 type Matrix4x4 [4][4]float64
 
-// Multiply the vector by a 4x4 matrix
-func (v Vector3f) MultiplyMatrix4x4(m [4][4]float64) Vector3f {
-	// Create a Vector4f with w=1
-	v4 := Vector4f{v.X, v.Y, v.Z, 1.0}
+// MultiplyMatrix4x4 transforms the vector as a point (w = 1) by the matrix
+func (v Vector3f) MultiplyMatrix4x4(m Matrix4x4) Vector3f {
+	return m.MultiplyVector4(v.Extend(1)).Homogenised()
+}
 
-	// Multiply the 4-vector by the matrix
-	res := Vector4f{}
+// IdentityMatrix returns the 4x4 identity matrix
+func IdentityMatrix() Matrix4x4 {
+	return Matrix4x4{
+		{1, 0, 0, 0},
+		{0, 1, 0, 0},
+		{0, 0, 1, 0},
+		{0, 0, 0, 1},
+	}
+}
+
+// Multiply returns the matrix product m * n
+// (as vectors are columns, the result applies n first, then m)
+func (m Matrix4x4) Multiply(n Matrix4x4) Matrix4x4 {
+	var res Matrix4x4
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			for k := 0; k < 4; k++ {
+				res[i][j] += m[i][k] * n[k][j]
+			}
+		}
+	}
+	return res
+}
+
+// Transpose returns the matrix with rows and columns swapped
+func (m Matrix4x4) Transpose() Matrix4x4 {
+	var res Matrix4x4
 	for i := 0; i < 4; i++ {
-		res.Set(i, v4.X*m[i][0]+v4.Y*m[i][1]+v4.Z*m[i][2]+v4.W*m[i][3])
+		for j := 0; j < 4; j++ {
+			res[i][j] = m[j][i]
+		}
+	}
+	return res
+}
+
+// Inverse returns the inverse of the matrix (by gauss-jordan elimination
+// with partial pivoting), and false if the matrix is singular
+func (m Matrix4x4) Inverse() (Matrix4x4, bool) {
+	a := m
+	inv := IdentityMatrix()
+
+	for col := 0; col < 4; col++ {
+		// swap in the row with the largest pivot, for numerical stability
+		pivot := col
+		for row := col + 1; row < 4; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return Matrix4x4{}, false
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		inv[col], inv[pivot] = inv[pivot], inv[col]
+
+		// scale the pivot row to 1, then eliminate the column from every other row
+		p := 1.0 / a[col][col]
+		for j := 0; j < 4; j++ {
+			a[col][j] *= p
+			inv[col][j] *= p
+		}
+		for row := 0; row < 4; row++ {
+			if row == col {
+				continue
+			}
+			f := a[row][col]
+			for j := 0; j < 4; j++ {
+				a[row][j] -= f * a[col][j]
+				inv[row][j] -= f * inv[col][j]
+			}
+		}
 	}
+	return inv, true
+}
+
+// Determinant returns the matrix's determinant (0 for a singular matrix), by
+// cofactor expansion along the top row
+func (m Matrix4x4) Determinant() float64 {
+	// 2x2 determinants of the bottom two rows' columns i and j
+	minor := func(i, j int) float64 {
+		return m[2][i]*m[3][j] - m[2][j]*m[3][i]
+	}
+	// 3x3 determinants of the bottom three rows, without column c
+	cofactor := func(c int) float64 {
+		var cols [3]int
+		n := 0
+		for i := 0; i < 4; i++ {
+			if i != c {
+				cols[n] = i
+				n++
+			}
+		}
+		a, b, d := cols[0], cols[1], cols[2]
+		return m[1][a]*minor(b, d) - m[1][b]*minor(a, d) + m[1][d]*minor(a, b)
+	}
+	return m[0][0]*cofactor(0) - m[0][1]*cofactor(1) + m[0][2]*cofactor(2) - m[0][3]*cofactor(3)
+}
 
-	// Divide the resulting 4-vector by its fourth component
-	return Vector3f{res.X / res.W, res.Y / res.W, res.Z / res.W}
+// MultiplyVector4 returns the product of the matrix and a column vector
+func (m Matrix4x4) MultiplyVector4(v Vector4f) Vector4f {
+	return Vector4f{
+		m[0][0]*v.X + m[0][1]*v.Y + m[0][2]*v.Z + m[0][3]*v.W,
+		m[1][0]*v.X + m[1][1]*v.Y + m[1][2]*v.Z + m[1][3]*v.W,
+		m[2][0]*v.X + m[2][1]*v.Y + m[2][2]*v.Z + m[2][3]*v.W,
+		m[3][0]*v.X + m[3][1]*v.Y + m[3][2]*v.Z + m[3][3]*v.W,
+	}
+}
+
+// MultiplyPoint transforms a point by the matrix (w=1, so translation applies)
+func (m Matrix4x4) MultiplyPoint(p Vector3f) Vector3f {
+	return p.MultiplyMatrix4x4(m)
+}
+
+// MultiplyDirection transforms a direction by the matrix (w=0, so translation
+// is ignored)
+func (m Matrix4x4) MultiplyDirection(v Vector3f) Vector3f {
+	return Vector3f{
+		m[0][0]*v.X + m[0][1]*v.Y + m[0][2]*v.Z,
+		m[1][0]*v.X + m[1][1]*v.Y + m[1][2]*v.Z,
+		m[2][0]*v.X + m[2][1]*v.Y + m[2][2]*v.Z,
+	}
 }
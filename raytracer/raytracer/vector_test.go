@@ -0,0 +1,119 @@
+package raytracer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestVectorComponents(t *testing.T) {
+	a, b := Vector3f{X: 1, Y: -2, Z: 3}, Vector3f{X: 4, Y: 5, Z: -6}
+	for _, c := range []struct {
+		name      string
+		got, want Vector3f
+	}{
+		{"MultiplyComponents", a.MultiplyComponents(b), Vector3f{X: 4, Y: -10, Z: -18}},
+		{"DivideComponents", a.DivideComponents(b), Vector3f{X: 0.25, Y: -0.4, Z: -0.5}},
+		{"Min", a.Min(b), Vector3f{X: 1, Y: -2, Z: -6}},
+		{"Max", a.Max(b), Vector3f{X: 4, Y: 5, Z: 3}},
+		{"Lerp", a.Lerp(b, 0.5), Vector3f{X: 2.5, Y: 1.5, Z: -1.5}},
+		{"Negate", a.Negate(), Vector3f{X: -1, Y: 2, Z: -3}},
+		{"Multiply4", a.Multiply4(Vector4f{X: 4, Y: 5, Z: -6, W: 7}), Vector3f{X: 4, Y: -10, Z: -18}},
+	} {
+		if !nearVec(c.got, c.want) {
+			t.Errorf("%v = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+
+	if !(Vector3f{X: 1e-9}).NearZero() || (Vector3f{Z: 1e-6}).NearZero() {
+		t.Errorf("NearZero is wrong")
+	}
+}
+
+func TestVector4f(t *testing.T) {
+	a, b := Vector4f{X: 1, W: 5}, Vector4f{Y: 1, W: 7}
+	if c := a.Cross(b); c != (Vector4f{Z: 1}) {
+		t.Errorf("Cross = %v, want (0, 0, 1, 0)", c)
+	}
+	if p := (Vector4f{X: 2, Y: 4, Z: 6, W: 2}).Homogenised(); !nearVec(p, Vector3f{X: 1, Y: 2, Z: 3}) {
+		t.Errorf("Homogenised = %v, want (1, 2, 3)", p)
+	}
+	if d := (Vector4f{X: 2, Y: 4, Z: 6}).Homogenised(); !nearVec(d, Vector3f{X: 2, Y: 4, Z: 6}) {
+		t.Errorf("Homogenised direction = %v, want (2, 4, 6)", d)
+	}
+}
+
+func TestReflectRefract(t *testing.T) {
+	n := Vector3f{Y: 1}
+	in := Vector3f{X: 1, Y: -1}.Normalised()
+	if r := in.Reflect(n); !nearVec(r, Vector3f{X: 1, Y: 1}.Normalised()) {
+		t.Errorf("Reflect = %v", r)
+	}
+
+	// snell's law: n1 sin(i) = n2 sin(r)
+	r, ok := in.Refract(n, 1/1.5)
+	if !ok {
+		t.Fatal("Refract into glass reflected")
+	}
+	if sinI, sinR := math.Sqrt(0.5), r.X; !near(sinI, 1.5*sinR) || r.Y >= 0 || !near(r.Norm(), 1) {
+		t.Errorf("Refract = %v, want sin %v", r, sinI/1.5)
+	}
+	// past the critical angle, going out of glass
+	if _, ok := (Vector3f{X: 0.9, Y: -math.Sqrt(1 - 0.81)}).Refract(n, 1.5); ok {
+		t.Errorf("Refract past the critical angle didn't reflect")
+	}
+	// straight through
+	if r, _ := (Vector3f{Y: -1}).Refract(n, 1/1.5); !nearVec(r, Vector3f{Y: -1}) {
+		t.Errorf("Refract along the normal = %v", r)
+	}
+}
+
+func TestOrthonormalBasis(t *testing.T) {
+	for _, n := range []Vector3f{{X: 1}, {Y: -1}, {Z: 1}, Vector3f{X: 1, Y: 2, Z: 3}.Normalised()} {
+		u, v := OrthonormalBasis(n)
+		if !near(u.Norm(), 1) || !near(v.Norm(), 1) || !near(u.Dot(v), 0) || !near(u.Dot(n), 0) || !near(v.Dot(n), 0) {
+			t.Errorf("basis of %v = %v, %v isn't orthonormal", n, u, v)
+		}
+		if !nearVec(u.Cross(v), n) {
+			t.Errorf("basis of %v = %v, %v isn't right handed", n, u, v)
+		}
+	}
+}
+
+func TestMatrix(t *testing.T) {
+	m := Scale(Vector3f{X: 2, Y: 3, Z: 4}).Then(RotateY(0.7)).Then(Translate(Vector3f{X: 1, Y: -2, Z: 5})).Matrix
+
+	if d := m.Determinant(); !near(d, 24) {
+		t.Errorf("Determinant = %v, want 24", d)
+	}
+	if d := IdentityMatrix().Determinant(); d != 1 {
+		t.Errorf("identity Determinant = %v, want 1", d)
+	}
+	singular := Matrix4x4{{1, 2, 3, 4}, {2, 4, 6, 8}, {0, 1, 0, 0}, {0, 0, 0, 1}}
+	if d := singular.Determinant(); d != 0 {
+		t.Errorf("singular Determinant = %v, want 0", d)
+	}
+	if _, ok := singular.Inverse(); ok {
+		t.Errorf("singular matrix has an inverse")
+	}
+
+	inv, ok := m.Inverse()
+	if !ok {
+		t.Fatal("no inverse")
+	}
+	product := m.Multiply(inv)
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			if !near(product[i][j], IdentityMatrix()[i][j]) {
+				t.Fatalf("m * inverse = %v, want the identity", product)
+			}
+		}
+	}
+	if d := m.Transpose().Determinant(); !near(d, m.Determinant()) {
+		t.Errorf("transposed Determinant = %v, want %v", d, m.Determinant())
+	}
+
+	p := Vector3f{X: 1, Y: 1, Z: 1}
+	if a, b := p.MultiplyMatrix4x4(m), m.MultiplyVector4(p.Extend(1)).XYZ(); !nearVec(a, b) {
+		t.Errorf("MultiplyMatrix4x4 = %v, MultiplyVector4 = %v", a, b)
+	}
+}